@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Bind requests with the rules of the domain, so the binding tags of request
+// bodies can use them and name fields as the domain does.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		domain.RegisterRules(v)
+	}
+}
+
+// abortInvalidRequest answers a request whose body cannot be read, saying
+// what is wrong with it: field by field for fields that break a rule or
+// hold a value of the wrong type.
+func abortInvalidRequest(c *gin.Context, err error) {
+	if fields, ok := domain.FieldErrors(err); ok {
+		infrastructures.AbortWithProblem(c, fields)
+		return
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		infrastructures.AbortWithProblem(c, &domain.ValidationError{Fields: []domain.FieldError{
+			{Field: typeErr.Field, Message: "cannot be a " + typeErr.Value},
+		}})
+		return
+	}
+	infrastructures.AbortWithProblem(c, domain.ErrInvalidRequest.Reword(err.Error()))
+}
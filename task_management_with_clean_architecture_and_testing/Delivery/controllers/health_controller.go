@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"task_with_clean_arc_and_test/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the storage ping of a readiness probe, so a hung
+// database fails the probe instead of hanging it.
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler answers the probes of the container orchestrator.
+type HealthHandler struct {
+	storage repository.Pinger
+}
+
+func NewHealthHandler(storage repository.Pinger) *HealthHandler {
+	return &HealthHandler{storage: storage}
+}
+
+// Live reports that the process is up and serving, without touching the
+// storage: a database outage must not get the server restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether the storage backend answers, so traffic is only sent
+// to servers that can handle it.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := h.storage.Ping(ctx); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "storage is not reachable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
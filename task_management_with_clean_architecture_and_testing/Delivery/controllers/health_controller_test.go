@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingerFunc is a storage whose health the test decides.
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestHealthProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var storageErr error
+	handler := NewHealthHandler(pingerFunc(func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline, "the ping must be bounded")
+		return storageErr
+	}))
+	router := gin.New()
+	router.GET("/healthz", handler.Live)
+	router.GET("/readyz", handler.Ready)
+	probe := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := probe("/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	storageErr = errors.New("connection refused")
+	w = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","error":"storage is not reachable"}`, w.Body.String())
+
+	// liveness ignores the storage
+	w = probe("/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
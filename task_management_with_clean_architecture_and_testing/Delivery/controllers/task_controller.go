@@ -3,8 +3,12 @@ package controllers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
 	"task_with_clean_arc_and_test/usecases"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,36 +22,143 @@ func NewTaskHandler(usecase usecases.TaskUsecase) *TaskHandler {
 }
 
 func (h *TaskHandler) GetTasks(c *gin.Context) {
-	tasks, err := h.usecase.GetTasks()
+	query, err := taskQueryFromRequest(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to retrieve tasks"})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tasks) // Ensure that only the tasks slice is returned
+
+	page, err := h.usecase.GetTasks(c.Request.Context(), query, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
+// taskQueryFromRequest reads the listing filters from the query string:
+// status, assignee, due_after, due_before, q, sort, order, limit and cursor.
+func taskQueryFromRequest(c *gin.Context) (domain.TaskQuery, error) {
+	query := domain.TaskQuery{
+		Status:   c.Query("status"),
+		Assignee: c.Query("assignee"),
+		Text:     c.Query("q"),
+		SortBy:   c.Query("sort"),
+		Cursor:   c.Query("cursor"),
+	}
+
+	switch order := c.Query("order"); order {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, domain.ErrInvalidOrder.Reword(fmt.Sprintf("order must be asc or desc, got %q", order))
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, domain.ErrInvalidLimit
+		}
+		query.Limit = n
+	}
+
+	var err error
+	if query.DueAfter, err = parseDateParam(c, "due_after", false); err != nil {
+		return query, err
+	}
+	if query.DueBefore, err = parseDateParam(c, "due_before", true); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseDateParam accepts an RFC 3339 timestamp or a plain YYYY-MM-DD date. A
+// plain date used as an upper bound covers the whole day.
+func parseDateParam(c *gin.Context, name string, endOfDay bool) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Time{}, domain.ErrInvalidDate.Reword(fmt.Sprintf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name))
+}
+
+// GetTaskByID answers the task with its version as ETag, or 304 Not
+// Modified if If-None-Match names that version.
 func (h *TaskHandler) GetTaskByID(c *gin.Context) {
 	id := c.Param("id")
-	task, err := h.usecase.GetTaskByID(id)
+	task, err := h.usecase.GetTaskByID(c.Request.Context(), id, infrastructures.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	etag := taskETag(task)
+	c.Header("ETag", etag)
+	if noneMatch := c.GetHeader("If-None-Match"); noneMatch != "" && etagListed(noneMatch, etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, task)
 }
 
+// taskETag is the entity tag of a task, its quoted version.
+func taskETag(task domain.Task) string {
+	return `"` + strconv.FormatInt(task.Version, 10) + `"`
+}
+
+// etagListed reports whether the If-None-Match header value list names etag
+// or is "*". Tags compare weakly, ignoring a W/ prefix.
+func etagListed(list, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion reads the version of the task a change is based on from the
+// If-Match header, which must name it as an ETag, or be "*" for whatever
+// version is stored. Any other value matches no version.
+func ifMatchVersion(c *gin.Context) (int64, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" {
+		return 0, domain.ErrIfMatchRequired
+	}
+	if value == "*" {
+		return domain.AnyVersion, nil
+	}
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, domain.ErrVersionMismatch
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, domain.ErrVersionMismatch
+	}
+	return version, nil
+}
+
 func (h *TaskHandler) AddTask(c *gin.Context) {
 	var newTask domain.Task
 
 	if err := c.ShouldBindJSON(&newTask); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortInvalidRequest(c, err)
 		return
 	}
 
-	err := h.usecase.AddTask(newTask)
+	err := h.usecase.AddTask(c.Request.Context(), newTask, infrastructures.ActorFromContext(c))
 	if err != nil {
-		fmt.Print("ufff", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"message": "Task created"})
@@ -55,27 +166,117 @@ func (h *TaskHandler) AddTask(c *gin.Context) {
 
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	id := c.Param("id")
-	err := h.usecase.DeleteTask(id)
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Task not found"})
-		return // Return early to avoid sending a success response
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	err = h.usecase.DeleteTask(c.Request.Context(), id, version, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "successfully deleted!"})
 }
 
 func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	id := c.Param("id")
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
 	var task domain.Task
-	if err := c.BindJSON(&task); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if err := c.ShouldBindJSON(&task); err != nil {
+		abortInvalidRequest(c, err)
 		return
 	}
 
-	err := h.usecase.UpdateTask(id, task)
+	updated, err := h.usecase.UpdateTask(c.Request.Context(), id, version, task, infrastructures.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Task update failed"})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
 
+	c.Header("ETag", taskETag(updated))
 	c.JSON(http.StatusOK, gin.H{"message": "successfully updated!"})
 }
+
+// mergePatchContentType is the media type of JSON merge patches, RFC 7386.
+const mergePatchContentType = "application/merge-patch+json"
+
+// PatchTask changes the fields of a task a JSON merge patch names, and
+// answers the task as saved. Plain JSON is accepted as a merge patch too.
+func (h *TaskHandler) PatchTask(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	if ct := c.ContentType(); ct != mergePatchContentType && ct != gin.MIMEJSON {
+		infrastructures.AbortWithProblem(c, domain.ErrUnsupportedFormat.Reword(
+			fmt.Sprintf("a task is patched with %s, got %q", mergePatchContentType, ct)))
+		return
+	}
+	patch, err := c.GetRawData()
+	if err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+
+	task, err := h.usecase.PatchTask(c.Request.Context(), c.Param("id"), version, patch, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, task)
+}
+
+type transitionRequest struct {
+	Status string `json:"status" binding:"required,status"`
+}
+
+func (h *TaskHandler) TransitionTask(c *gin.Context) {
+	var req transitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+
+	task, err := h.usecase.TransitionTask(c.Request.Context(), c.Param("id"), req.Status, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, task)
+}
+
+// GetTrash lists the deleted tasks, filtered, sorted and paged like
+// GetTasks.
+func (h *TaskHandler) GetTrash(c *gin.Context) {
+	query, err := taskQueryFromRequest(c)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+
+	page, err := h.usecase.GetTrash(c.Request.Context(), query, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// RestoreTask takes a task out of the trash and answers it.
+func (h *TaskHandler) RestoreTask(c *gin.Context) {
+	task, err := h.usecase.RestoreTask(c.Request.Context(), c.Param("id"), infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, task)
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -23,29 +25,72 @@ type MockTaskUsecase struct {
 	mock.Mock
 }
 
-func (m *MockTaskUsecase) GetTasks() ([]domain.Task, error) {
-	args := m.Called()
-	return args.Get(0).([]domain.Task), args.Error(1)
+func (m *MockTaskUsecase) GetTasks(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (domain.TaskPage, error) {
+	args := m.Called(query, actor)
+	return args.Get(0).(domain.TaskPage), args.Error(1)
 }
 
-func (m *MockTaskUsecase) GetTaskByID(id string) (domain.Task, error) {
-	args := m.Called(id)
+func (m *MockTaskUsecase) GetTaskByID(ctx context.Context, id string, actor domain.Actor) (domain.Task, error) {
+	args := m.Called(id, actor)
 	return args.Get(0).(domain.Task), args.Error(1)
 }
 
-func (m *MockTaskUsecase) AddTask(task domain.Task) error {
-	args := m.Called(task)
+func (m *MockTaskUsecase) AddTask(ctx context.Context, task domain.Task, actor domain.Actor) error {
+	args := m.Called(task, actor)
 	return args.Error(0)
 }
 
-func (m *MockTaskUsecase) DeleteTask(id string) error {
-	args := m.Called(id)
+func (m *MockTaskUsecase) DeleteTask(ctx context.Context, id string, version int64, actor domain.Actor) error {
+	args := m.Called(id, version, actor)
 	return args.Error(0)
 }
 
-func (m *MockTaskUsecase) UpdateTask(id string, task domain.Task) error {
-	args := m.Called(id, task)
-	return args.Error(0)
+func (m *MockTaskUsecase) UpdateTask(ctx context.Context, id string, version int64, task domain.Task, actor domain.Actor) (domain.Task, error) {
+	args := m.Called(id, version, task, actor)
+	return args.Get(0).(domain.Task), args.Error(1)
+}
+
+func (m *MockTaskUsecase) PatchTask(ctx context.Context, id string, version int64, patch []byte, actor domain.Actor) (domain.Task, error) {
+	args := m.Called(id, version, string(patch), actor)
+	return args.Get(0).(domain.Task), args.Error(1)
+}
+
+func (m *MockTaskUsecase) TransitionTask(ctx context.Context, id, status string, actor domain.Actor) (domain.Task, error) {
+	args := m.Called(id, status, actor)
+	return args.Get(0).(domain.Task), args.Error(1)
+}
+
+func (m *MockTaskUsecase) GetTrash(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (domain.TaskPage, error) {
+	args := m.Called(query, actor)
+	return args.Get(0).(domain.TaskPage), args.Error(1)
+}
+
+func (m *MockTaskUsecase) RestoreTask(ctx context.Context, id string, actor domain.Actor) (domain.Task, error) {
+	args := m.Called(id, actor)
+	return args.Get(0).(domain.Task), args.Error(1)
+}
+
+func (m *MockTaskUsecase) PurgeTrash(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// activeSessions accepts every session and user, the tests issue their own tokens.
+type activeSessions struct{}
+
+func (activeSessions) SessionActive(context.Context, string) (bool, error) { return true, nil }
+func (activeSessions) UserActive(context.Context, string) (bool, error)    { return true, nil }
+func (activeSessions) AuthenticateAPIKey(context.Context, string) (domain.APIKey, string, error) {
+	return domain.APIKey{}, "", domain.ErrInvalidAPIKey
+}
+
+// newTestAuth returns a token service with a fresh key, and the auth
+// middleware accepting its tokens.
+func newTestAuth(t *testing.T) (*infrastructures.TokenService, gin.HandlerFunc) {
+	keys, err := infrastructures.GenerateKeySet(infrastructures.SigningMethodEdDSA.Alg())
+	require.NoError(t, err)
+	tokens := infrastructures.NewTokenService(keys)
+	return tokens, infrastructures.NewAuthenticator(tokens, activeSessions{}, domain.DefaultRoles(), nil).AuthUser()
 }
 
 // Test suite for TaskHandler
@@ -54,6 +99,7 @@ type TaskHandlerTestSuite struct {
 	router      *gin.Engine
 	mockUsecase *MockTaskUsecase
 	handler     *TaskHandler
+	tokens      *infrastructures.TokenService
 }
 
 func (suite *TaskHandlerTestSuite) SetupTest() {
@@ -66,18 +112,75 @@ func (suite *TaskHandlerTestSuite) SetupTest() {
 	// Create a mock usecase and handler
 	suite.mockUsecase = new(MockTaskUsecase)
 	suite.handler = &TaskHandler{usecase: suite.mockUsecase}
+	tokens, auth := newTestAuth(suite.T())
+	suite.tokens = tokens
 
 	allowed := suite.router.Group("")
-	allowed.Use(infrastructures.AuthUser())
+	allowed.Use(auth)
 	allowed.GET("/tasks", suite.handler.GetTasks)
 	allowed.GET("/tasks/:id", suite.handler.GetTaskByID)
+	allowed.POST("/tasks", suite.handler.AddTask)
+	allowed.PUT("/tasks/:id", suite.handler.UpdateTask)
+	allowed.PATCH("/tasks/:id", suite.handler.PatchTask)
+	allowed.DELETE("/tasks/:id", suite.handler.DeleteTask)
+	allowed.POST("/tasks/:id/transitions", suite.handler.TransitionTask)
 
 	// Routes for admin users
 	protected := suite.router.Group("/admin")
-	protected.Use(infrastructures.AuthMiddleware("admin"))
+	protected.Use(auth, infrastructures.RequirePermission(domain.PermTasksManage))
 	protected.PUT("/tasks/:id", suite.handler.UpdateTask)
 	protected.DELETE("/tasks/:id", suite.handler.DeleteTask)
 	protected.POST("/tasks", suite.handler.AddTask)
+	protected.GET("/tasks/trash", suite.handler.GetTrash)
+	protected.POST("/tasks/:id/restore", suite.handler.RestoreTask)
+}
+
+func (suite *TaskHandlerTestSuite) TestGetTrash_Success() {
+	deleted := time.Date(2024, 8, 13, 16, 29, 6, 0, time.UTC)
+	page := domain.TaskPage{Tasks: []domain.Task{{ID: "1", Title: "Task 1", Version: 2, Deleted: &domain.Deletion{By: "admin", At: deleted}}}, Total: 1}
+	suite.mockUsecase.On("GetTrash", domain.TaskQuery{Text: "task", Limit: 5}, mock.Anything).Return(page, nil)
+
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "admin", Role: "admin"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodGet, "/admin/tasks/trash?q=task&limit=5", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"deleted":{"by":"admin","at":"2024-08-13T16:29:06Z"}`)
+	assert.Contains(suite.T(), w.Body.String(), `"total":1`)
+	suite.mockUsecase.AssertExpectations(suite.T())
+}
+
+func (suite *TaskHandlerTestSuite) TestRestoreTask_Success() {
+	suite.mockUsecase.On("RestoreTask", "1", mock.Anything).Return(domain.Task{ID: "1", Title: "Task 1", Version: 3}, nil)
+
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "admin", Role: "admin"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodPost, "/admin/tasks/1/restore", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"3"`, w.Header().Get("ETag"))
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Task 1"`)
+	assert.NotContains(suite.T(), w.Body.String(), `"deleted"`)
+}
+
+func (suite *TaskHandlerTestSuite) TestRestoreTask_NotInTrash() {
+	suite.mockUsecase.On("RestoreTask", "7", mock.Anything).Return(domain.Task{}, domain.ErrNotInTrash)
+
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "admin", Role: "admin"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodPost, "/admin/tasks/7/restore", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"code":"task_not_in_trash"`)
 }
 
 func (suite *TaskHandlerTestSuite) TestGetTasks_Success() {
@@ -104,7 +207,7 @@ func (suite *TaskHandlerTestSuite) TestGetTasks_Success() {
 	}
 
 	// Mock usecase
-	suite.mockUsecase.On("GetTasks").Return(tasks, nil)
+	suite.mockUsecase.On("GetTasks", domain.TaskQuery{}, mock.Anything).Return(domain.TaskPage{Tasks: tasks, NextCursor: "next", Total: 3}, nil)
 
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -112,7 +215,7 @@ func (suite *TaskHandlerTestSuite) TestGetTasks_Success() {
 		Username: "test_user",
 		Role:     "user", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Create a new GET request with the token
@@ -130,13 +233,16 @@ func (suite *TaskHandlerTestSuite) TestGetTasks_Success() {
 	// Print the raw JSON response for debugging
 	fmt.Println("Response Body:", w.Body.String())
 
-	// Unmarshal the response body into a slice of tasks
-	var returnedTasks []domain.Task
-	err = json.Unmarshal(w.Body.Bytes(), &returnedTasks)
+	// Unmarshal the response body into a page of tasks
+	var page domain.TaskPage
+	err = json.Unmarshal(w.Body.Bytes(), &page)
 	if err != nil {
 		suite.Fail("Failed to unmarshal response: %v", err)
 		return
 	}
+	returnedTasks := page.Tasks
+	assert.Equal(suite.T(), "next", page.NextCursor)
+	assert.Equal(suite.T(), int64(3), page.Total)
 
 	// Assert the response and ensure it matches the expected values
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
@@ -150,6 +256,67 @@ func (suite *TaskHandlerTestSuite) TestGetTasks_Success() {
 	}
 }
 
+func (suite *TaskHandlerTestSuite) TestGetTasks_QueryParameters() {
+	expected := domain.TaskQuery{
+		Status:     "in_progress",
+		Assignee:   "alice",
+		Text:       "docs",
+		SortBy:     "due_date",
+		Descending: true,
+		Limit:      10,
+		Cursor:     "abc",
+		DueAfter:   time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+		DueBefore:  time.Date(2024, 8, 31, 23, 59, 59, 999999999, time.UTC),
+	}
+	suite.mockUsecase.On("GetTasks", expected, mock.Anything).Return(domain.TaskPage{Tasks: []domain.Task{}}, nil)
+
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "test_user", Role: "user"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodGet, "/tasks?status=in_progress&assignee=alice&q=docs&sort=due_date&order=desc"+
+		"&limit=10&cursor=abc&due_after=2024-08-01&due_before=2024-08-31", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"tasks":[],"total":0}`, w.Body.String())
+	suite.mockUsecase.AssertExpectations(suite.T())
+}
+
+func (suite *TaskHandlerTestSuite) TestGetTasks_Timeout() {
+	suite.mockUsecase.On("GetTasks", domain.TaskQuery{}, mock.Anything).Return(domain.TaskPage{}, fmt.Errorf("%w: %w", domain.ErrTimeout, context.DeadlineExceeded))
+
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "test_user", Role: "user"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Gateway Timeout","status":504,"detail":"the operation timed out, please try again","instance":"/tasks","code":"timeout"}`, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) TestGetTasks_BadQuery() {
+	token, err := suite.tokens.GenerateToken(domain.User{ID: primitive.NewObjectID(), Username: "test_user", Role: "user"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	for _, query := range []string{"order=sideways", "limit=ten", "due_after=yesterday"} {
+		req, _ := http.NewRequest(http.MethodGet, "/tasks?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, query)
+	}
+
+	suite.mockUsecase.On("GetTasks", mock.Anything, mock.Anything).Return(domain.TaskPage{}, domain.ErrInvalidCursor)
+	req, _ := http.NewRequest(http.MethodGet, "/tasks?cursor=stale", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
 func (suite *TaskHandlerTestSuite) TestGetTaskByID_Success() {
 	fixedTime := time.Date(2024, 8, 13, 16, 29, 6, 0, time.Local)
 	task := domain.Task{
@@ -158,10 +325,15 @@ func (suite *TaskHandlerTestSuite) TestGetTaskByID_Success() {
 		Description: "Task Description",
 		DueDate:     fixedTime,
 		Status:      "pending",
+		Priority:    domain.PriorityHigh,
+		Assignee:    "test_user",
+		CreatedAt:   fixedTime,
+		UpdatedAt:   fixedTime,
+		Version:     3,
 	}
 
 	// Set up the mock to expect a call with the ID "1" and return the mock task
-	suite.mockUsecase.On("GetTaskByID", "1").Return(task, nil)
+	suite.mockUsecase.On("GetTaskByID", "1", mock.Anything).Return(task, nil)
 
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -169,7 +341,7 @@ func (suite *TaskHandlerTestSuite) TestGetTaskByID_Success() {
 		Username: "test_user",
 		Role:     "user", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Create a new GET request with the token
@@ -186,15 +358,48 @@ func (suite *TaskHandlerTestSuite) TestGetTaskByID_Success() {
 
 	// Assert the response status
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"3"`, w.Header().Get("ETag"))
 
 	// Prepare the expected response body
 	expectedBody := `{"id":"1","title":"Test Task","description":"Task Description","due_date":"` +
-		task.DueDate.Format(time.RFC3339) + `","status":"pending"}`
+		task.DueDate.Format(time.RFC3339) + `","status":"pending","priority":"high","assignee":"test_user",` +
+		`"created_at":"` + fixedTime.Format(time.RFC3339) + `","updated_at":"` + fixedTime.Format(time.RFC3339) + `","version":3}`
 
 	// Compare the expected body with the actual response
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
+func (suite *TaskHandlerTestSuite) TestGetTaskByID_NotModified() {
+	suite.mockUsecase.On("GetTaskByID", "1", mock.Anything).Return(domain.Task{ID: "1", Title: "Test Task", Version: 3}, nil)
+	user := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "test_user",
+		Role:     "user",
+	}
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	for noneMatch, status := range map[string]int{
+		`"3"`:         http.StatusNotModified,
+		`"2", W/"3"`:  http.StatusNotModified,
+		`*`:           http.StatusNotModified,
+		`"2"`:         http.StatusOK,
+		`"3-unknown"`: http.StatusOK,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/tasks/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-None-Match", noneMatch)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), status, w.Code, noneMatch)
+		assert.Equal(suite.T(), `"3"`, w.Header().Get("ETag"), noneMatch)
+		if status == http.StatusNotModified {
+			assert.Empty(suite.T(), w.Body.String(), noneMatch)
+		}
+	}
+}
+
 func (suite *TaskHandlerTestSuite) TestGetTaskByID_NotFound() {
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -202,11 +407,11 @@ func (suite *TaskHandlerTestSuite) TestGetTaskByID_NotFound() {
 		Username: "test_user",
 		Role:     "user", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Mock the usecase to return an error indicating the task was not found
-	suite.mockUsecase.On("GetTaskByID", "1").Return(domain.Task{}, errors.New("Task not found"))
+	suite.mockUsecase.On("GetTaskByID", "1", mock.Anything).Return(domain.Task{}, domain.ErrTaskNotFound)
 
 	// Create a new GET request with the token
 	req, err := http.NewRequest(http.MethodGet, "/tasks/1", nil)
@@ -224,7 +429,7 @@ func (suite *TaskHandlerTestSuite) TestGetTaskByID_NotFound() {
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
 
 	// Prepare the expected response body
-	expectedBody := `{"error":"Task not found"}`
+	expectedBody := `{"type":"about:blank","title":"Not Found","status":404,"detail":"Task not found","instance":"/tasks/1","code":"task_not_found"}`
 
 	// Compare the expected body with the actual response
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
@@ -249,14 +454,14 @@ func (suite *TaskHandlerTestSuite) TestAddTask_Success() {
 			task.Title == newTask.Title &&
 			task.Description == newTask.Description &&
 			task.Status == newTask.Status
-	})).Return(nil)
+	}), mock.Anything).Return(nil)
 	// Generate a valid JWT token for an admin user
 	adminUser := domain.User{
 		ID:       primitive.NewObjectID(), // Generate a new ObjectID
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	fmt.Println("Generated Token: ", token) // Debugging the generated token
 
@@ -289,7 +494,7 @@ func (suite *TaskHandlerTestSuite) TestAddTask_BadRequest() {
 	invalidPayload := []byte(``)
 
 	// Mock the usecase to ensure it doesn't get called
-	suite.mockUsecase.On("AddTask", mock.Anything).Return(nil).Maybe()
+	suite.mockUsecase.On("AddTask", mock.Anything, mock.Anything).Return(nil).Maybe()
 
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -297,7 +502,7 @@ func (suite *TaskHandlerTestSuite) TestAddTask_BadRequest() {
 		Username: "test_user",
 		Role:     "admin", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	fmt.Println("Generated Token: ", token) // Debugging the generated token
 
@@ -317,18 +522,18 @@ func (suite *TaskHandlerTestSuite) TestAddTask_BadRequest() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 
 	// Assert that the response body contains the appropriate error message
-	expectedBody := `{"error":"EOF"}`
+	expectedBody := `{"type":"about:blank","title":"Bad Request","status":400,"detail":"EOF","instance":"/admin/tasks","code":"invalid_request"}`
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
 func (suite *TaskHandlerTestSuite) TestDeleteTask_Success() {
-	suite.mockUsecase.On("DeleteTask", "1").Return(nil)
+	suite.mockUsecase.On("DeleteTask", "1", int64(1), mock.Anything).Return(nil)
 	user := domain.User{
 		ID:       primitive.NewObjectID(), // Generate a new ObjectID
 		Username: "test_user",
 		Role:     "admin", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	fmt.Println("Generated Token: ", token) // Debugging the generated token
 
@@ -337,6 +542,7 @@ func (suite *TaskHandlerTestSuite) TestDeleteTask_Success() {
 	suite.NoError(err) // Ensure there is no error creating the request
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
@@ -345,9 +551,96 @@ func (suite *TaskHandlerTestSuite) TestDeleteTask_Success() {
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
+func (suite *TaskHandlerTestSuite) userRequest(method, url string, body string) *httptest.ResponseRecorder {
+	user := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "test_user",
+		Role:     "user",
+	}
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *TaskHandlerTestSuite) TestDeleteTask_PassesActor() {
+	actor := domain.DefaultRoles().Actor("test_user", domain.RoleUser)
+	suite.mockUsecase.On("DeleteTask", "1", int64(1), actor).Return(nil)
+
+	w := suite.userRequest(http.MethodDelete, "/tasks/1", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockUsecase.AssertExpectations(suite.T())
+}
+
+func (suite *TaskHandlerTestSuite) TestDeleteTask_Forbidden() {
+	suite.mockUsecase.On("DeleteTask", "1", int64(1), mock.Anything).Return(domain.ErrForbidden)
+
+	w := suite.userRequest(http.MethodDelete, "/tasks/1", "")
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Forbidden","status":403,"detail":"you are not allowed to change this task","instance":"/tasks/1","code":"task_forbidden"}`, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) TestUpdateTask_NotFound() {
+	suite.mockUsecase.On("UpdateTask", "1", int64(1), mock.Anything, mock.Anything).Return(domain.Task{}, domain.ErrTaskNotFound)
+
+	w := suite.userRequest(http.MethodPut, "/tasks/1", `{"title":"Task","description":"Description"}`)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Not Found","status":404,"detail":"Task not found","instance":"/tasks/1","code":"task_not_found"}`, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) TestUpdateTask_Preconditions() {
+	user := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "test_user",
+		Role:     "user",
+	}
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	suite.mockUsecase.On("UpdateTask", "1", int64(2), mock.Anything, mock.Anything).Return(domain.Task{}, domain.ErrVersionMismatch)
+	suite.mockUsecase.On("UpdateTask", "1", domain.AnyVersion, mock.Anything, mock.Anything).Return(domain.Task{ID: "1", Version: 5}, nil)
+
+	put := func(ifMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPut, "/tasks/1", bytes.NewBufferString(`{"title":"Task","description":"Description"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := put("")
+	assert.Equal(suite.T(), http.StatusPreconditionRequired, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Precondition Required","status":428,"detail":"If-Match must name the version the change is based on","instance":"/tasks/1","code":"if_match_required"}`, w.Body.String())
+
+	w = put(`"2"`)
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Precondition Failed","status":412,"detail":"the task was changed since that version","instance":"/tasks/1","code":"version_mismatch"}`, w.Body.String())
+
+	// weak tags never match for a change
+	w = put(`W/"2"`)
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+
+	w = put(`*`)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"5"`, w.Header().Get("ETag"))
+	suite.mockUsecase.AssertNumberOfCalls(suite.T(), "UpdateTask", 2)
+}
+
 func (suite *TaskHandlerTestSuite) TestDeleteTask_InternalServerError() {
 	// Mock the usecase to simulate an internal server error
-	suite.mockUsecase.On("DeleteTask", "10").Return(errors.New("Task not found"))
+	suite.mockUsecase.On("DeleteTask", "10", int64(1), mock.Anything).Return(errors.New("Task not found"))
 
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -355,7 +648,7 @@ func (suite *TaskHandlerTestSuite) TestDeleteTask_InternalServerError() {
 		Username: "test_user",
 		Role:     "admin", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	fmt.Println("Generated Token: ", token) // Debugging the generated token
 
@@ -364,6 +657,7 @@ func (suite *TaskHandlerTestSuite) TestDeleteTask_InternalServerError() {
 	suite.NoError(err) // Ensure there is no error creating the request
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 
 	// Create a response recorder to capture the response
 	w := httptest.NewRecorder()
@@ -377,8 +671,8 @@ func (suite *TaskHandlerTestSuite) TestDeleteTask_InternalServerError() {
 	// Assert that the response status code is 500 Internal Server Error
 	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 
-	// Assert that the response body contains the appropriate error message
-	expectedBody := `{"error":"Task not found"}`
+	// Assert that the response body hides the cause of the failure
+	expectedBody := `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"the server could not complete the request","instance":"/admin/tasks/10","code":"internal"}`
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
@@ -390,29 +684,31 @@ func (suite *TaskHandlerTestSuite) TestUpdateTask_Success() {
 		Status:      "completed",
 	}
 	payload, _ := json.Marshal(newTask)
-	suite.mockUsecase.On("UpdateTask", "1", mock.MatchedBy(func(task domain.Task) bool {
+	suite.mockUsecase.On("UpdateTask", "1", int64(1), mock.MatchedBy(func(task domain.Task) bool {
 		return task.ID == newTask.ID &&
 			task.Title == newTask.Title &&
 			task.Description == newTask.Description &&
 			task.Status == newTask.Status
-	})).Return(nil)
+	}), mock.Anything).Return(domain.Task{ID: "1", Version: 2}, nil)
 
 	adminUser := domain.User{
 		ID:       primitive.NewObjectID(), // Generate a new ObjectID
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	req, _ := http.NewRequest(http.MethodPut, "/admin/tasks/1", bytes.NewBuffer(payload))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"2"`, w.Header().Get("ETag"))
 	expectedBody := `{"message":"successfully updated!"}`
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
@@ -431,13 +727,13 @@ func (suite *TaskHandlerTestSuite) TestUpdateTask_InternalServerError() {
 	payload, _ := json.Marshal(updatedTask)
 
 	// Mock the usecase to simulate an internal server error
-	suite.mockUsecase.On("UpdateTask", "1", mock.MatchedBy(func(task domain.Task) bool {
+	suite.mockUsecase.On("UpdateTask", "1", int64(1), mock.MatchedBy(func(task domain.Task) bool {
 		// Match based on ID and other fields except DueDate
 		return task.ID == updatedTask.ID &&
 			task.Title == updatedTask.Title &&
 			task.Description == updatedTask.Description &&
 			task.Status == updatedTask.Status
-	})).Return(errors.New("Task update failed"))
+	}), mock.Anything).Return(domain.Task{}, errors.New("Task update failed"))
 
 	// Generate a valid JWT token for an authenticated user
 	user := domain.User{
@@ -445,7 +741,7 @@ func (suite *TaskHandlerTestSuite) TestUpdateTask_InternalServerError() {
 		Username: "test_user",
 		Role:     "admin", // Ensure this role has permissions for the endpoint
 	}
-	token, err := infrastructures.GenerateToken(user)
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	fmt.Println("Generated Token: ", token) // Debugging the generated token
 
@@ -454,6 +750,7 @@ func (suite *TaskHandlerTestSuite) TestUpdateTask_InternalServerError() {
 	suite.NoError(err) // Ensure there is no error creating the request
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
 
 	// Create a response recorder to capture the response
 	w := httptest.NewRecorder()
@@ -467,11 +764,131 @@ func (suite *TaskHandlerTestSuite) TestUpdateTask_InternalServerError() {
 	// Assert that the response status code is 500 Internal Server Error
 	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 
-	// Assert that the response body contains the appropriate error message
-	expectedBody := `{"error":"Task update failed"}`
+	// Assert that the response body hides the cause of the failure
+	expectedBody := `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"the server could not complete the request","instance":"/admin/tasks/1","code":"internal"}`
+	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) TestUpdateTask_InvalidPriority() {
+	payload := []byte(`{"title":"Updated Task","description":"Updated Description","priority":"critical"}`)
+	suite.mockUsecase.On("UpdateTask", "1", int64(1), mock.Anything, mock.Anything).Return(domain.Task{}, domain.ErrInvalidPriority)
+
+	adminUser := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "admin_user",
+		Role:     "admin",
+	}
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+	req, _ := http.NewRequest(http.MethodPut, "/admin/tasks/1", bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	expectedBody := `{"type":"about:blank","title":"Bad Request","status":400,"detail":"priority must be one of low, normal, high or urgent","instance":"/admin/tasks/1","code":"invalid_priority"}`
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
+func (suite *TaskHandlerTestSuite) patch(contentType, body string) *httptest.ResponseRecorder {
+	user := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "test_user",
+		Role:     "user",
+	}
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/tasks/1", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *TaskHandlerTestSuite) TestPatchTask_Success() {
+	actor := domain.DefaultRoles().Actor("test_user", domain.RoleUser)
+	suite.mockUsecase.On("PatchTask", "1", int64(1), `{"assignee":null}`, actor).
+		Return(domain.Task{ID: "1", Title: "Task", Description: "Description"}, nil)
+
+	w := suite.patch("application/merge-patch+json", `{"assignee":null}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var task domain.Task
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	assert.Equal(suite.T(), "1", task.ID)
+	assert.Empty(suite.T(), task.Assignee)
+}
+
+func (suite *TaskHandlerTestSuite) TestPatchTask_UnsupportedFormat() {
+	w := suite.patch("text/plain", `title=Task`)
+
+	assert.Equal(suite.T(), http.StatusUnsupportedMediaType, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Unsupported Media Type","status":415,"detail":"a task is patched with application/merge-patch+json, got \"text/plain\"","instance":"/tasks/1","code":"unsupported_format"}`, w.Body.String())
+	suite.mockUsecase.AssertNotCalled(suite.T(), "PatchTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *TaskHandlerTestSuite) TestPatchTask_ReadOnlyField() {
+	suite.mockUsecase.On("PatchTask", "1", int64(1), `{"status":"done"}`, mock.Anything).
+		Return(domain.Task{}, &domain.ValidationError{Fields: []domain.FieldError{{Field: "status", Message: "cannot be changed"}}})
+
+	w := suite.patch("application/merge-patch+json", `{"status":"done"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Bad Request","status":400,"detail":"some fields are invalid","instance":"/tasks/1","code":"invalid_fields","errors":[{"field":"status","message":"cannot be changed"}]}`, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) transition(body string) *httptest.ResponseRecorder {
+	user := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "test_user",
+		Role:     "user",
+	}
+	token, err := suite.tokens.GenerateToken(user, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	req, _ := http.NewRequest(http.MethodPost, "/tasks/1/transitions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *TaskHandlerTestSuite) TestTransitionTask_Success() {
+	actor := domain.DefaultRoles().Actor("test_user", domain.RoleUser)
+	suite.mockUsecase.On("TransitionTask", "1", "in_progress", actor).
+		Return(domain.Task{ID: "1", Title: "Task", Status: domain.StatusInProgress}, nil)
+
+	w := suite.transition(`{"status":"in_progress"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var task domain.Task
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	assert.Equal(suite.T(), domain.StatusInProgress, task.Status)
+}
+
+func (suite *TaskHandlerTestSuite) TestTransitionTask_Illegal() {
+	suite.mockUsecase.On("TransitionTask", "1", "done", mock.Anything).
+		Return(domain.Task{}, &domain.TransitionError{From: domain.StatusPending, To: domain.StatusDone})
+
+	w := suite.transition(`{"status":"done"}`)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Conflict","status":409,"detail":"cannot move task from pending to done","instance":"/tasks/1/transitions","code":"invalid_transition"}`, w.Body.String())
+}
+
+func (suite *TaskHandlerTestSuite) TestTransitionTask_MissingStatus() {
+	w := suite.transition(`{}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockUsecase.AssertNotCalled(suite.T(), "TransitionTask", mock.Anything, mock.Anything, mock.Anything)
+}
+
 // Main function to run the test suite
 func TestTaskHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(TaskHandlerTestSuite))
@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
 	"task_with_clean_arc_and_test/usecases"
 
 	"github.com/gin-gonic/gin"
@@ -19,29 +23,77 @@ func NewUserHandler(u usecases.UserUsecase) *UserHandler {
 func (h *UserHandler) LoginUser(c *gin.Context) {
 	var user domain.User
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"erraor": err.Error()})
+		abortInvalidRequest(c, err)
 		return
 	}
-	token, err := h.Usecase.LoginUser(user)
+	result, err := h.Usecase.LoginUser(c.Request.Context(), user, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"erbror": err.Error()})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, result)
+}
+
+type completeLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// CompleteLogin finishes a login that requires a two-factor code.
+func (h *UserHandler) CompleteLogin(c *gin.Context) {
+	var req completeLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	tokens, err := h.Usecase.CompleteLogin(c.Request.Context(), req.ChallengeToken, req.Code, c.ClientIP())
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh trades a refresh token for a new access and refresh token.
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+
+	tokens, err := h.Usecase.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the session of the access token used for the request.
+func (h *UserHandler) Logout(c *gin.Context) {
+	if err := h.Usecase.Logout(c.Request.Context(), infrastructures.SessionIDFromContext(c)); err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
 func (h *UserHandler) RegisterUser(c *gin.Context) {
 	var user domain.User
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortInvalidRequest(c, err)
 		return
 	}
 
-	err := h.Usecase.Register(user)
+	err := h.Usecase.Register(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
-
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered"})
 }
 
@@ -49,48 +101,290 @@ func (h *UserHandler) RegisterAdmin(c *gin.Context) {
 	var newAdmin domain.User
 	err := c.ShouldBindJSON(&newAdmin)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "internal error"})
+		abortInvalidRequest(c, err)
 		return
 	}
-	err = h.Usecase.RegisterAdmin(newAdmin)
+	err = h.Usecase.RegisterAdmin(c.Request.Context(), newAdmin)
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
-
 	c.JSON(201, gin.H{"message": "Successfully registered!"})
 }
 func (h *UserHandler) Promote(c *gin.Context) {
 	username := c.Param("username")
 	var UpdatedUser domain.User
 	if err := c.ShouldBind(&UpdatedUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortInvalidRequest(c, err)
 		return
 	}
 	// fmt.Println(tasks)
-	err := h.Usecase.UpdateUser(username)
+	err := h.Usecase.AssignRole(c.Request.Context(), username, domain.RoleAdmin, infrastructures.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"}) // indicates the task with given id is not found in the db
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "User updated"}) // updates successfully
 }
+
+type assignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// AssignRole gives a user one of the configured roles and ends their
+// sessions, so tokens carrying the old role stop working.
+func (h *UserHandler) AssignRole(c *gin.Context) {
+	var req assignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+
+	err := h.Usecase.AssignRole(c.Request.Context(), c.Param("username"), req.Role, infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned", "role": req.Role})
+}
+
 func (h *UserHandler) Activate(c *gin.Context) {
 	username := c.Param("username")
-	err := h.Usecase.Activate(username)
+	err := h.Usecase.Activate(c.Request.Context(), username)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
 	c.JSON(200, gin.H{"message": "successfully activated!"})
 }
+
+type deactivateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// DeActivate disables an account. The body, with the reason, is optional.
 func (h *UserHandler) DeActivate(c *gin.Context) {
 	username := c.Param("username")
-	err := h.Usecase.Deactivate(username)
+	var req deactivateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			abortInvalidRequest(c, err)
+			return
+		}
+	}
+	err := h.Usecase.Deactivate(c.Request.Context(), username, req.Reason)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err})
+		infrastructures.AbortWithProblem(c, err)
 		return
 	}
 	c.JSON(200, gin.H{"message": "successfully deactivated!"})
 
 }
+
+// Unlock lifts the lockout that failed logins put on an account.
+func (h *UserHandler) Unlock(c *gin.Context) {
+	err := h.Usecase.Unlock(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "successfully unlocked!"})
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EnrollTwoFactor starts two-factor enrollment for the caller and returns
+// the secret for their authenticator.
+func (h *UserHandler) EnrollTwoFactor(c *gin.Context) {
+	enrollment, err := h.Usecase.EnrollTwoFactor(c.Request.Context(), infrastructures.ActorFromContext(c).Username)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor enables two-factor authentication for the caller and
+// returns their recovery codes.
+func (h *UserHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	codes, err := h.Usecase.ConfirmTwoFactor(c.Request.Context(), infrastructures.ActorFromContext(c).Username, req.Code)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off for the caller.
+func (h *UserHandler) DisableTwoFactor(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	err := h.Usecase.DisableTwoFactor(c.Request.Context(), infrastructures.ActorFromContext(c).Username, req.Code)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword replaces the caller's password. All of their sessions end,
+// this one included, so they have to log in again.
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	err := h.Usecase.ChangePassword(c.Request.Context(), infrastructures.ActorFromContext(c).Username, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, please log in again"})
+}
+
+type forgotPasswordRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// ForgotPassword sends a password reset token to the user. It answers the
+// same whether or not the user exists.
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	if err := h.Usecase.RequestPasswordReset(c.Request.Context(), req.Username); err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset token has been sent"})
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword.
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	err := h.Usecase.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, please log in"})
+}
+
+// ListUsers returns a page of users, filtered by the role and status query
+// parameters and paged with limit and cursor.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	query := domain.UserQuery{
+		Role:   c.Query("role"),
+		Status: domain.AccountState(c.Query("status")),
+		Cursor: c.Query("cursor"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			infrastructures.AbortWithProblem(c, domain.ErrInvalidUserLimit)
+			return
+		}
+		query.Limit = n
+	}
+
+	page, err := h.Usecase.ListUsers(c.Request.Context(), query)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUser returns one user, without their password or second factor.
+func (h *UserHandler) GetUser(c *gin.Context) {
+	profile, err := h.Usecase.GetUser(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// Demote gives a user the basic role back and ends their sessions.
+func (h *UserHandler) Demote(c *gin.Context) {
+	err := h.Usecase.Demote(c.Request.Context(), c.Param("username"), infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User demoted", "role": domain.RoleUser})
+}
+
+// DeleteUser removes a user. Their tasks go to the user named by the
+// reassign_to query parameter, or are left without owner and assignee.
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	reassigned, err := h.Usecase.DeleteUser(c.Request.Context(), c.Param("username"), c.Query("reassign_to"), infrastructures.ActorFromContext(c))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "reassigned_tasks": reassigned})
+}
+
+// CreateAPIKey mints an API key for the caller. The key is in the response
+// and cannot be retrieved again.
+func (h *UserHandler) CreateAPIKey(c *gin.Context) {
+	var req domain.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	created, err := h.Usecase.CreateAPIKey(c.Request.Context(), infrastructures.ActorFromContext(c), infrastructures.SecondFactorFromContext(c), req)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// ListAPIKeys returns the caller's API keys, without the keys themselves.
+func (h *UserHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.Usecase.ListAPIKeys(c.Request.Context(), infrastructures.ActorFromContext(c).Username)
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey deletes one of the caller's API keys.
+func (h *UserHandler) RevokeAPIKey(c *gin.Context) {
+	err := h.Usecase.RevokeAPIKey(c.Request.Context(), infrastructures.ActorFromContext(c).Username, c.Param("id"))
+	if err != nil {
+		infrastructures.AbortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
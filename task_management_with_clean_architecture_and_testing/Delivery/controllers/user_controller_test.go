@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"task_with_clean_arc_and_test/domain"
 	"task_with_clean_arc_and_test/infrastructures"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -21,33 +23,134 @@ type MockUserUsecase struct {
 	mock.Mock
 }
 
-func (m *MockUserUsecase) Register(user domain.User) error {
+func (m *MockUserUsecase) Register(ctx context.Context, user domain.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockUserUsecase) LoginUser(user domain.User) (string, error) {
-	args := m.Called(user)
-	return args.String(0), args.Error(1)
+func (m *MockUserUsecase) LoginUser(ctx context.Context, user domain.User, clientIP string) (domain.LoginResult, error) {
+	args := m.Called(user, clientIP)
+	return args.Get(0).(domain.LoginResult), args.Error(1)
 }
 
-func (m *MockUserUsecase) RegisterAdmin(user domain.User) error {
-	args := m.Called(user)
+func (m *MockUserUsecase) CompleteLogin(ctx context.Context, challengeToken, code, clientIP string) (domain.TokenPair, error) {
+	args := m.Called(challengeToken, code, clientIP)
+	return args.Get(0).(domain.TokenPair), args.Error(1)
+}
+
+func (m *MockUserUsecase) EnrollTwoFactor(ctx context.Context, username string) (domain.TwoFactorEnrollment, error) {
+	args := m.Called(username)
+	return args.Get(0).(domain.TwoFactorEnrollment), args.Error(1)
+}
+
+func (m *MockUserUsecase) ConfirmTwoFactor(ctx context.Context, username, code string) ([]string, error) {
+	args := m.Called(username, code)
+	codes, _ := args.Get(0).([]string)
+	return codes, args.Error(1)
+}
+
+func (m *MockUserUsecase) DisableTwoFactor(ctx context.Context, username, code string) error {
+	args := m.Called(username, code)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error {
+	args := m.Called(username, currentPassword, newPassword)
 	return args.Error(0)
 }
 
-func (m *MockUserUsecase) UpdateUser(username string) error {
+func (m *MockUserUsecase) RequestPasswordReset(ctx context.Context, username string) error {
 	args := m.Called(username)
 	return args.Error(0)
 }
 
-func (m *MockUserUsecase) Activate(username string) error {
+func (m *MockUserUsecase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	args := m.Called(token, newPassword)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) ListUsers(ctx context.Context, query domain.UserQuery) (domain.UserPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(domain.UserPage), args.Error(1)
+}
+
+func (m *MockUserUsecase) GetUser(ctx context.Context, username string) (domain.UserProfile, error) {
 	args := m.Called(username)
+	return args.Get(0).(domain.UserProfile), args.Error(1)
+}
+
+func (m *MockUserUsecase) Demote(ctx context.Context, username string, actor domain.Actor) error {
+	args := m.Called(username, actor)
 	return args.Error(0)
 }
 
-func (m *MockUserUsecase) Deactivate(username string) error {
+func (m *MockUserUsecase) DeleteUser(ctx context.Context, username, reassignTo string, actor domain.Actor) (int64, error) {
+	args := m.Called(username, reassignTo, actor)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserUsecase) CreateAPIKey(ctx context.Context, actor domain.Actor, secondFactor bool, request domain.APIKeyRequest) (domain.CreatedAPIKey, error) {
+	args := m.Called(actor, secondFactor, request)
+	return args.Get(0).(domain.CreatedAPIKey), args.Error(1)
+}
+
+func (m *MockUserUsecase) ListAPIKeys(ctx context.Context, username string) ([]domain.APIKeyInfo, error) {
 	args := m.Called(username)
+	return args.Get(0).([]domain.APIKeyInfo), args.Error(1)
+}
+
+func (m *MockUserUsecase) RevokeAPIKey(ctx context.Context, username, id string) error {
+	args := m.Called(username, id)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) AuthenticateAPIKey(ctx context.Context, token string) (domain.APIKey, string, error) {
+	args := m.Called(token)
+	return args.Get(0).(domain.APIKey), args.String(1), args.Error(2)
+}
+
+func (m *MockUserUsecase) Unlock(ctx context.Context, username string) error {
+	args := m.Called(username)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error) {
+	args := m.Called(refreshToken)
+	return args.Get(0).(domain.TokenPair), args.Error(1)
+}
+
+func (m *MockUserUsecase) Logout(ctx context.Context, sessionID string) error {
+	args := m.Called(sessionID)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	args := m.Called(sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserUsecase) UserActive(ctx context.Context, username string) (bool, error) {
+	args := m.Called(username)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserUsecase) RegisterAdmin(ctx context.Context, user domain.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) AssignRole(ctx context.Context, username, role string, actor domain.Actor) error {
+	args := m.Called(username, role, actor)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) Activate(ctx context.Context, username string) error {
+	args := m.Called(username)
+	return args.Error(0)
+}
+
+func (m *MockUserUsecase) Deactivate(ctx context.Context, username, reason string) error {
+	args := m.Called(username, reason)
 	return args.Error(0)
 }
 
@@ -57,6 +160,7 @@ type UserHandlerTestSuite struct {
 	router      *gin.Engine
 	mockUsecase *MockUserUsecase
 	handler     *UserHandler
+	tokens      *infrastructures.TokenService
 }
 
 func (suite *UserHandlerTestSuite) SetupTest() {
@@ -69,18 +173,36 @@ func (suite *UserHandlerTestSuite) SetupTest() {
 	// Create a mock usecase and handler
 	suite.mockUsecase = new(MockUserUsecase)
 	suite.handler = &UserHandler{Usecase: suite.mockUsecase}
+	tokens, auth := newTestAuth(suite.T())
+	suite.tokens = tokens
 	suite.router.POST("/register", suite.handler.RegisterUser)
 
 	allowed := suite.router.Group("")
 	allowed.POST("/login", suite.handler.LoginUser)
+	allowed.POST("/login/2fa", suite.handler.CompleteLogin)
+	allowed.POST("/refresh", suite.handler.Refresh)
+	allowed.POST("/logout", auth, suite.handler.Logout)
+	allowed.POST("/2fa/confirm", auth, suite.handler.ConfirmTwoFactor)
+	allowed.PUT("/me/password", auth, suite.handler.ChangePassword)
+	allowed.GET("/me/api-keys", auth, suite.handler.ListAPIKeys)
+	allowed.POST("/me/api-keys", auth, suite.handler.CreateAPIKey)
+	allowed.DELETE("/me/api-keys/:id", auth, suite.handler.RevokeAPIKey)
+	allowed.POST("/password/forgot", suite.handler.ForgotPassword)
+	allowed.POST("/password/reset", suite.handler.ResetPassword)
 
 	// Routes for admin users
 	protected := suite.router.Group("/admin")
-	protected.Use(infrastructures.AuthMiddleware("admin"))
+	protected.Use(auth, infrastructures.RequirePermission(domain.PermUsersManage))
 	protected.POST("/register", suite.handler.RegisterAdmin)
 	protected.POST("/activate/:username", suite.handler.Activate)
 	protected.POST("/deactivate/:username", suite.handler.DeActivate)
+	protected.POST("/unlock/:username", suite.handler.Unlock)
 	protected.GET("/promote/:username", suite.handler.Promote)
+	protected.PUT("/users/:username/role", suite.handler.AssignRole)
+	protected.GET("/users", suite.handler.ListUsers)
+	protected.GET("/users/:username", suite.handler.GetUser)
+	protected.DELETE("/users/:username", suite.handler.DeleteUser)
+	protected.POST("/users/:username/demote", suite.handler.Demote)
 }
 
 func (suite *UserHandlerTestSuite) TestRegisterUser_Success() {
@@ -126,7 +248,7 @@ func (suite *UserHandlerTestSuite) TestLoginUser_Success() {
 	token := "jwt_token"
 
 	// Mock the use case to return a token
-	suite.mockUsecase.On("LoginUser", user).Return(token, nil)
+	suite.mockUsecase.On("LoginUser", user, mock.Anything).Return(domain.LoginResult{TokenPair: domain.TokenPair{AccessToken: token, RefreshToken: "refresh_token"}}, nil)
 
 	// Create a new POST request with login credentials
 	payload, _ := json.Marshal(user)
@@ -143,12 +265,76 @@ func (suite *UserHandlerTestSuite) TestLoginUser_Success() {
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
 
 	// Define the expected response body
-	expectedBody := `{"token":"` + token + `"}`
+	expectedBody := `{"token":"` + token + `","refresh_token":"refresh_token"}`
 
 	// Check that the response body matches the expected JSON
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
+func (suite *UserHandlerTestSuite) login(user domain.User) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(user)
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UserHandlerTestSuite) TestLoginUser_InvalidCredentials() {
+	user := domain.User{Username: "test_user", Password: "wrong"}
+	suite.mockUsecase.On("LoginUser", user, mock.Anything).Return(domain.LoginResult{}, domain.ErrInvalidCredentials)
+
+	w := suite.login(user)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"invalid username or password","instance":"/login","code":"invalid_credentials"}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestLoginUser_Throttled() {
+	user := domain.User{Username: "test_user", Password: "password123"}
+	suite.mockUsecase.On("LoginUser", user, mock.Anything).Return(domain.LoginResult{}, &domain.ThrottledError{RetryAfter: 90500 * time.Millisecond})
+
+	w := suite.login(user)
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Equal(suite.T(), "91", w.Header().Get("Retry-After"))
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"too many failed login attempts, try again later","instance":"/login","code":"too_many_attempts"}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestLoginUser_TwoFactorRequired() {
+	user := domain.User{Username: "test_user", Password: "password123"}
+	suite.mockUsecase.On("LoginUser", user, mock.Anything).Return(domain.LoginResult{TwoFactorRequired: true, ChallengeToken: "challenge"}, nil)
+
+	w := suite.login(user)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"two_factor_required":true,"challenge_token":"challenge"}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestCompleteLogin() {
+	suite.mockUsecase.On("CompleteLogin", "challenge", "123456", mock.Anything).Return(domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil)
+	suite.mockUsecase.On("CompleteLogin", "challenge", "000000", mock.Anything).Return(domain.TokenPair{}, fmt.Errorf("%w: %w", domain.ErrLoginNotConfirmed, domain.ErrInvalidTwoFactorCode))
+
+	for code, want := range map[string]int{"123456": http.StatusOK, "000000": http.StatusUnauthorized} {
+		payload, _ := json.Marshal(gin.H{"challenge_token": "challenge", "code": code})
+		req, err := http.NewRequest(http.MethodPost, "/login/2fa", bytes.NewBuffer(payload))
+		suite.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), want, w.Code, code)
+	}
+}
+
+func (suite *UserHandlerTestSuite) TestConfirmTwoFactor_NotEnrolled() {
+	suite.mockUsecase.On("ConfirmTwoFactor", "admin_user", "123456").Return(nil, domain.ErrTwoFactorNotEnrolled)
+
+	w := suite.asAdmin(http.MethodPost, "/2fa/confirm", `{"code":"123456"}`)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
 func (suite *UserHandlerTestSuite) TestRegisterAdmin_Success() {
 	user := domain.User{
 		Username: "admin_user",
@@ -169,7 +355,7 @@ func (suite *UserHandlerTestSuite) TestRegisterAdmin_Success() {
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Create a new POST request with the admin registration data
@@ -204,7 +390,7 @@ func (suite *UserHandlerTestSuite) TestUpdateUser_Success() {
 	username := "test_user"
 
 	// Mock the use case to expect the update and return no error
-	suite.mockUsecase.On("UpdateUser", username).Return(nil)
+	suite.mockUsecase.On("AssignRole", username, domain.RoleAdmin, mock.Anything).Return(nil)
 
 	// Generate a valid JWT token for an admin user
 	adminUser := domain.User{
@@ -212,7 +398,7 @@ func (suite *UserHandlerTestSuite) TestUpdateUser_Success() {
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 	payload, _ := json.Marshal(user)
 
@@ -256,7 +442,7 @@ func (suite *UserHandlerTestSuite) TestActivate_Success() {
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Create a new POST request with the activation data
@@ -285,7 +471,7 @@ func (suite *UserHandlerTestSuite) TestDeactivate_Success() {
 	username := "test_user"
 
 	// Mock the use case to expect the deactivation and return no error
-	suite.mockUsecase.On("Deactivate", username).Return(nil)
+	suite.mockUsecase.On("Deactivate", username, "").Return(nil)
 
 	// Generate a valid JWT token for an admin user
 	adminUser := domain.User{
@@ -293,7 +479,7 @@ func (suite *UserHandlerTestSuite) TestDeactivate_Success() {
 		Username: "admin_user",
 		Role:     "admin",
 	}
-	token, err := infrastructures.GenerateToken(adminUser)
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
 	suite.NoError(err)
 
 	// Create a new POST request with the deactivation data
@@ -318,6 +504,265 @@ func (suite *UserHandlerTestSuite) TestDeactivate_Success() {
 	assert.JSONEq(suite.T(), expectedBody, w.Body.String())
 }
 
+func (suite *UserHandlerTestSuite) asAdmin(method, path, body string) *httptest.ResponseRecorder {
+	adminUser := domain.User{
+		ID:       primitive.NewObjectID(),
+		Username: "admin_user",
+		Role:     "admin",
+	}
+	token, err := suite.tokens.GenerateToken(adminUser, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UserHandlerTestSuite) assignRole(username, body string) *httptest.ResponseRecorder {
+	return suite.asAdmin(http.MethodPut, "/admin/users/"+username+"/role", body)
+}
+
+func (suite *UserHandlerTestSuite) TestUnlock() {
+	suite.mockUsecase.On("Unlock", "test_user").Return(nil)
+	suite.mockUsecase.On("Unlock", "nobody").Return(domain.ErrUserNotFound)
+
+	w := suite.asAdmin(http.MethodPost, "/admin/unlock/test_user", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"message":"successfully unlocked!"}`, w.Body.String())
+
+	w = suite.asAdmin(http.MethodPost, "/admin/unlock/nobody", "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestAssignRole_Success() {
+	suite.mockUsecase.On("AssignRole", "test_user", "auditor", mock.MatchedBy(func(a domain.Actor) bool {
+		return a.Username == "admin_user"
+	})).Return(nil)
+
+	w := suite.assignRole("test_user", `{"role":"auditor"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"message":"Role assigned","role":"auditor"}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestAssignRole_UnknownRole() {
+	suite.mockUsecase.On("AssignRole", "test_user", "superuser", mock.Anything).Return(domain.ErrUnknownRole)
+
+	w := suite.assignRole("test_user", `{"role":"superuser"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestAssignRole_UserNotFound() {
+	suite.mockUsecase.On("AssignRole", "ghost", "admin", mock.Anything).Return(domain.ErrUserNotFound)
+
+	w := suite.assignRole("ghost", `{"role":"admin"}`)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestAssignRole_MissingRole() {
+	w := suite.assignRole("test_user", `{}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockUsecase.AssertNotCalled(suite.T(), "AssignRole", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *UserHandlerTestSuite) refresh(body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(body))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UserHandlerTestSuite) TestRefresh_Success() {
+	suite.mockUsecase.On("Refresh", "old").Return(domain.TokenPair{AccessToken: "access", RefreshToken: "new"}, nil)
+
+	w := suite.refresh(`{"refresh_token":"old"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"token":"access","refresh_token":"new"}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestRefresh_Reused() {
+	suite.mockUsecase.On("Refresh", "old").Return(domain.TokenPair{}, domain.ErrRefreshTokenReused)
+
+	w := suite.refresh(`{"refresh_token":"old"}`)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestRefresh_MissingToken() {
+	w := suite.refresh(`{}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockUsecase.AssertNotCalled(suite.T(), "Refresh", mock.Anything)
+}
+
+func (suite *UserHandlerTestSuite) TestLogout_RevokesOwnSession() {
+	suite.mockUsecase.On("Logout", "test-session").Return(nil)
+	token, err := suite.tokens.GenerateToken(domain.User{Username: "test_user", Role: "user"}, domain.Session{ID: "test-session"})
+	suite.NoError(err)
+
+	req, err := http.NewRequest(http.MethodPost, "/logout", nil)
+	suite.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockUsecase.AssertExpectations(suite.T())
+}
+
+func (suite *UserHandlerTestSuite) TestChangePassword() {
+	suite.mockUsecase.On("ChangePassword", "admin_user", "old", "new").Return(nil)
+	suite.mockUsecase.On("ChangePassword", "admin_user", "wrong", "new").Return(domain.ErrWrongPassword)
+
+	w := suite.asAdmin(http.MethodPut, "/me/password", `{"current_password":"old","new_password":"new"}`)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.asAdmin(http.MethodPut, "/me/password", `{"current_password":"wrong","new_password":"new"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.asAdmin(http.MethodPut, "/me/password", `{"new_password":"new"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestCreateAPIKey() {
+	request := domain.APIKeyRequest{Name: "ci", Scopes: []domain.Permission{domain.PermTasksRead}}
+	created := domain.CreatedAPIKey{APIKeyInfo: domain.APIKeyInfo{ID: "a1", Name: "ci", Prefix: "tmk_a1", Scopes: request.Scopes}, Key: "tmk_a1_secret"}
+	suite.mockUsecase.On("CreateAPIKey", mock.MatchedBy(func(a domain.Actor) bool {
+		return a.Username == "admin_user"
+	}), false, request).Return(created, nil)
+	suite.mockUsecase.On("CreateAPIKey", mock.Anything, false, mock.MatchedBy(func(r domain.APIKeyRequest) bool {
+		return r.Name == "root"
+	})).Return(domain.CreatedAPIKey{}, fmt.Errorf("%w: users:manage", domain.ErrInvalidAPIKeyScope))
+
+	w := suite.asAdmin(http.MethodPost, "/me/api-keys", `{"name":"ci","scopes":["tasks:read"]}`)
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"key":"tmk_a1_secret"`)
+
+	w = suite.asAdmin(http.MethodPost, "/me/api-keys", `{"name":"root","scopes":["users:manage"]}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.asAdmin(http.MethodPost, "/me/api-keys", `{"name":"ci","expires_at":"tomorrow"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestListAndRevokeAPIKeys() {
+	suite.mockUsecase.On("ListAPIKeys", "admin_user").Return([]domain.APIKeyInfo{{ID: "a1", Name: "ci", Prefix: "tmk_a1"}}, nil)
+	suite.mockUsecase.On("RevokeAPIKey", "admin_user", "a1").Return(nil)
+	suite.mockUsecase.On("RevokeAPIKey", "admin_user", "zz").Return(domain.ErrAPIKeyNotFound)
+
+	w := suite.asAdmin(http.MethodGet, "/me/api-keys", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"prefix":"tmk_a1"`)
+	assert.NotContains(suite.T(), w.Body.String(), "hash")
+
+	w = suite.asAdmin(http.MethodDelete, "/me/api-keys/a1", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.asAdmin(http.MethodDelete, "/me/api-keys/zz", "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) post(path, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	suite.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UserHandlerTestSuite) TestRegisterUser_WeakPassword() {
+	suite.mockUsecase.On("Register", mock.Anything).Return(&domain.PasswordPolicyError{Problems: []string{"must be at least 8 characters long"}})
+
+	w := suite.post("/register", `{"Username":"new_user","Password":"short"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.JSONEq(suite.T(), `{"type":"about:blank","title":"Bad Request","status":400,"detail":"password does not meet the password policy","instance":"/register","code":"weak_password","problems":["must be at least 8 characters long"]}`, w.Body.String())
+}
+
+func (suite *UserHandlerTestSuite) TestForgotPassword() {
+	suite.mockUsecase.On("RequestPasswordReset", "test_user").Return(nil)
+
+	w := suite.post("/password/forgot", `{"username":"test_user"}`)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	suite.mockUsecase.AssertExpectations(suite.T())
+}
+
+func (suite *UserHandlerTestSuite) TestResetPassword() {
+	suite.mockUsecase.On("ResetPassword", "good", "new").Return(nil)
+	suite.mockUsecase.On("ResetPassword", "used", "new").Return(domain.ErrInvalidResetToken)
+	suite.mockUsecase.On("ResetPassword", "disabled", "new").Return(domain.ErrAccountDeactivated)
+
+	for token, want := range map[string]int{"good": http.StatusOK, "used": http.StatusBadRequest, "disabled": http.StatusForbidden} {
+		w := suite.post("/password/reset", `{"token":"`+token+`","new_password":"new"}`)
+		assert.Equal(suite.T(), want, w.Code, token)
+	}
+}
+
+func (suite *UserHandlerTestSuite) TestListUsers() {
+	query := domain.UserQuery{Role: "admin", Status: domain.AccountActive, Limit: 10}
+	page := domain.UserPage{Users: []domain.UserProfile{{ID: "1", Username: "root", Role: "admin", Status: domain.AccountActive}}, Total: 1}
+	suite.mockUsecase.On("ListUsers", query).Return(page, nil)
+	suite.mockUsecase.On("ListUsers", domain.UserQuery{Status: "banned"}).Return(domain.UserPage{}, domain.ErrInvalidAccountState)
+
+	w := suite.asAdmin(http.MethodGet, "/admin/users?role=admin&status=active&limit=10", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"users":[{"id":"1","username":"root","role":"admin","status":"active","two_factor_enabled":false}],"total":1}`, w.Body.String())
+
+	w = suite.asAdmin(http.MethodGet, "/admin/users?status=banned", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.asAdmin(http.MethodGet, "/admin/users?limit=many", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestGetUser() {
+	suite.mockUsecase.On("GetUser", "test_user").Return(domain.UserProfile{Username: "test_user", Role: "user"}, nil)
+	suite.mockUsecase.On("GetUser", "nobody").Return(domain.UserProfile{}, domain.ErrUserNotFound)
+
+	w := suite.asAdmin(http.MethodGet, "/admin/users/test_user", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "assword")
+
+	w = suite.asAdmin(http.MethodGet, "/admin/users/nobody", "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestDemote() {
+	suite.mockUsecase.On("Demote", "test_user", mock.Anything).Return(nil)
+	suite.mockUsecase.On("Demote", "admin_user", mock.Anything).Return(domain.ErrSelfAdministration)
+
+	w := suite.asAdmin(http.MethodPost, "/admin/users/test_user/demote", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.asAdmin(http.MethodPost, "/admin/users/admin_user/demote", "")
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *UserHandlerTestSuite) TestDeleteUser() {
+	suite.mockUsecase.On("DeleteUser", "test_user", "other_user", mock.MatchedBy(func(a domain.Actor) bool {
+		return a.Username == "admin_user"
+	})).Return(int64(3), nil)
+	suite.mockUsecase.On("DeleteUser", "test_user", "ghost", mock.Anything).Return(int64(0), domain.ErrUnknownAssignee)
+	suite.mockUsecase.On("DeleteUser", "nobody", "", mock.Anything).Return(int64(0), domain.ErrUserNotFound)
+
+	w := suite.asAdmin(http.MethodDelete, "/admin/users/test_user?reassign_to=other_user", "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"message":"User deleted","reassigned_tasks":3}`, w.Body.String())
+
+	w = suite.asAdmin(http.MethodDelete, "/admin/users/test_user?reassign_to=ghost", "")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.asAdmin(http.MethodDelete, "/admin/users/nobody", "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
 func TestUserHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(UserHandlerTestSuite))
 }
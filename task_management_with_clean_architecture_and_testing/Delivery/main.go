@@ -2,26 +2,108 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"task_with_clean_arc_and_test/Delivery/router"
+	"task_with_clean_arc_and_test/config"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func main() {
-	err := godotenv.Load()
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens, err := signingKeys(cfg.Tokens)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatal(err)
 	}
-	mongoURI := os.Getenv("MONGO_URI")
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+	hasher, err := infrastructures.NewPasswordHasher(cfg.PasswordHashCost)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer client.Disconnect(context.TODO())
-	router.CreateRouting(client)
+	var notifier infrastructures.Notifier = infrastructures.NewLogNotifier(os.Stderr)
+	if cfg.PasswordResetFile != "" {
+		notifier = infrastructures.NewFileNotifier(cfg.PasswordResetFile)
+	}
+
+	// stop on Ctrl-C, or on SIGTERM from the container orchestrator
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, cfg, tokens, hasher, notifier); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve opens the storage backend of cfg and serves the API on top of it
+// until ctx is done, closing the storage once the server has drained.
+func serve(ctx context.Context, cfg config.Config, tokens *infrastructures.TokenService, hasher *infrastructures.PasswordHasher, notifier infrastructures.Notifier) error {
+	attemptRepo := repository.NewInMemoryLoginAttemptRepository()
+
+	switch cfg.Storage.Backend {
+	case "memory":
+		ids, err := repository.NewIDGenerator(cfg.Storage.TaskIDs, repository.NewInMemorySequence(0))
+		if err != nil {
+			return err
+		}
+		return router.CreateRouting(ctx, cfg, tokens, hasher, repository.NewInMemoryTaskRepository(ids), repository.NewInMemoryUserRepository(), repository.NewInMemorySessionRepository(), attemptRepo, repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), repository.NewInMemoryPinger(), notifier)
+	case "bolt":
+		db, err := repository.OpenBoltDB(cfg.Storage.BoltPath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		ids, err := repository.NewIDGenerator(cfg.Storage.TaskIDs, repository.NewBoltSequence(db))
+		if err != nil {
+			return err
+		}
+		return router.CreateRouting(ctx, cfg, tokens, hasher, repository.NewBoltTaskRepository(db, ids), repository.NewBoltUserRepository(db), repository.NewBoltSessionRepository(db), attemptRepo, repository.NewBoltPasswordResetRepository(db), repository.NewBoltAPIKeyRepository(db), repository.NewBoltPinger(db), notifier)
+	case "mongo":
+		client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(cfg.Storage.MongoURI))
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(context.Background())
+		db := client.Database(cfg.Storage.MongoDatabase)
+		if err := repository.MigrateMongo(ctx, db); err != nil {
+			return err
+		}
+		ids, err := repository.NewIDGenerator(cfg.Storage.TaskIDs, repository.NewMongoSequence(db, repository.TaskSequence))
+		if err != nil {
+			return err
+		}
+		return router.CreateRouting(ctx, cfg, tokens, hasher, repository.NewTaskRepository(db, ids), repository.NewUserRepository(db), repository.NewSessionRepository(db), attemptRepo, repository.NewPasswordResetRepository(db), repository.NewAPIKeyRepository(db), repository.NewMongoPinger(client), notifier)
+	}
+	return fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.Storage.Backend)
+}
+
+// signingKeys loads the keys of cfg.KeysDir, or generates one, which does
+// not survive a restart.
+func signingKeys(cfg config.Tokens) (*infrastructures.TokenService, error) {
+	if cfg.KeysDir != "" {
+		keys, err := infrastructures.LoadKeyDir(cfg.KeysDir, cfg.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		return infrastructures.NewTokenService(keys), nil
+	}
+	keys, err := infrastructures.GenerateKeySet(cfg.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("JWT_KEYS_DIR is not set, signing with generated key %s; tokens will not survive a restart", keys.Current().ID)
+	return infrastructures.NewTokenService(keys), nil
 }
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"task_with_clean_arc_and_test/usecases"
+)
+
+// purgeInterval is how often the trash is purged of expired tasks.
+const purgeInterval = time.Hour
+
+// purgeTrash purges the trash at once and then every interval until ctx is
+// done.
+func purgeTrash(ctx context.Context, tasks usecases.TaskUsecase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := tasks.PurgeTrash(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Printf("purging the trash: %v", err)
+		case purged > 0:
+			log.Printf("purged %d tasks from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeTrashRemovesExpiredTasks(t *testing.T) {
+	ctx := context.Background()
+	tasks := repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0))
+	for _, title := range []string{"Expired", "Recent"} {
+		require.NoError(t, tasks.Add(ctx, domain.Task{Title: title, Description: "Description"}))
+	}
+	require.NoError(t, tasks.Trash(ctx, "1", 0, domain.Deletion{By: "admin", At: time.Now().Add(-2 * time.Hour)}))
+	require.NoError(t, tasks.Trash(ctx, "2", 0, domain.Deletion{By: "admin", At: time.Now()}))
+
+	purgeCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		purgeTrash(purgeCtx, usecases.NewTaskUsecase(tasks, repository.NewInMemoryUserRepository(), domain.DefaultTimeouts(), time.Hour), time.Millisecond)
+	}()
+
+	trash := func() []domain.Task {
+		query := domain.TaskQuery{Trashed: true}
+		require.NoError(t, query.Normalize())
+		page, err := tasks.Find(ctx, query)
+		require.NoError(t, err)
+		return page.Tasks
+	}
+	assert.Eventually(t, func() bool { return len(trash()) == 1 }, time.Second, 5*time.Millisecond, "the expired task is purged")
+	stop()
+	<-done
+
+	if remaining := trash(); assert.Len(t, remaining, 1) {
+		assert.Equal(t, "Recent", remaining[0].Title)
+	}
+}
@@ -1,51 +1,157 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
 	"task_with_clean_arc_and_test/Delivery/controllers"
+	"task_with_clean_arc_and_test/config"
+	"task_with_clean_arc_and_test/domain"
 	"task_with_clean_arc_and_test/infrastructures"
 	"task_with_clean_arc_and_test/repository"
 	"task_with_clean_arc_and_test/usecases"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CreateRouting(client *mongo.Client) {
-	router := gin.Default()
+// CreateRouting builds the API on top of the given repositories and serves
+// it at cfg.Addr until ctx is done. It then stops accepting connections and
+// waits up to cfg.ShutdownTimeout for the requests in flight to finish.
+// Meanwhile the trash is purged in the background.
+func CreateRouting(ctx context.Context, cfg config.Config, tokens *infrastructures.TokenService, hasher *infrastructures.PasswordHasher, taskRepo repository.TaskRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, attemptRepo repository.LoginAttemptRepository, resetRepo repository.PasswordResetRepository, apiKeyRepo repository.APIKeyRepository, storage repository.Pinger, notifier infrastructures.Notifier) error {
+	router := NewRouter(cfg, tokens, hasher, taskRepo, userRepo, sessionRepo, attemptRepo, resetRepo, apiKeyRepo, storage, notifier)
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	// the purge stops before the storage is closed
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	purged := make(chan struct{})
+	go func() {
+		defer close(purged)
+		purgeTrash(purgeCtx, usecases.NewTaskUsecase(taskRepo, userRepo, cfg.Timeouts, cfg.TrashRetention), purgeInterval)
+	}()
+	defer func() {
+		stopPurge()
+		<-purged
+	}()
+
+	server := &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	return serve(ctx, server, listener, cfg.ShutdownTimeout)
+}
+
+// serve runs server on listener until ctx is done, then shuts it down
+// gracefully, giving the requests in flight up to timeout to finish.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, timeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
 
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(client)
-	taskRepo := repository.NewTaskRepository(client)
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests in flight", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NewRouter wires the use cases and handlers for the given repositories and
+// registers every route, without starting the server. Tokens are issued by
+// tokens and passwords hashed by hasher; roles and policies come from cfg.
+// The readiness probe pings storage.
+func NewRouter(cfg config.Config, tokens *infrastructures.TokenService, hasher *infrastructures.PasswordHasher, taskRepo repository.TaskRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, attemptRepo repository.LoginAttemptRepository, resetRepo repository.PasswordResetRepository, apiKeyRepo repository.APIKeyRepository, storage repository.Pinger, notifier infrastructures.Notifier) *gin.Engine {
+	router := gin.Default()
+	// Login throttling counts per client address, so only trust the
+	// connecting address, not headers the client can set.
+	router.SetTrustedProxies(nil)
 
 	// Initialize use cases
-	userUsecase := usecases.NewUserUsecase(userRepo)
-	taskUsecase := usecases.NewTaskUsecase(taskRepo)
+	userUsecase := usecases.NewUserUsecase(userRepo, taskRepo, sessionRepo, attemptRepo, resetRepo, apiKeyRepo, notifier, tokens, hasher, cfg.Roles, cfg.Login, cfg.Password, cfg.Timeouts)
+	taskUsecase := usecases.NewTaskUsecase(taskRepo, userRepo, cfg.Timeouts, cfg.TrashRetention)
 
 	// Initialize handlers
 	userHandler := controllers.NewUserHandler(userUsecase)
 	taskHandler := controllers.NewTaskHandler(taskUsecase)
+	healthHandler := controllers.NewHealthHandler(storage)
+	auth := infrastructures.NewAuthenticator(tokens, userUsecase, cfg.Roles, cfg.TwoFactorRoles)
+
+	readTasks := infrastructures.RequirePermission(domain.PermTasksRead)
+	writeTasks := infrastructures.RequirePermission(domain.PermTasksWrite)
+	manageTasks := infrastructures.RequirePermission(domain.PermTasksManage)
+	manageUsers := infrastructures.RequirePermission(domain.PermUsersManage)
+	promoteUsers := infrastructures.RequirePermission(domain.PermUsersPromote)
+
+	// Probes
+	router.GET("/healthz", healthHandler.Live)
+	router.GET("/readyz", healthHandler.Ready)
 
 	// Public routes
 	router.POST("/register", userHandler.RegisterUser)
 	router.POST("/login", userHandler.LoginUser)
+	router.POST("/login/2fa", userHandler.CompleteLogin)
+	router.POST("/refresh", userHandler.Refresh)
+	router.POST("/password/forgot", userHandler.ForgotPassword)
+	router.POST("/password/reset", userHandler.ResetPassword)
+	router.GET("/.well-known/jwks.json", infrastructures.JWKSHandler(tokens.Keys()))
 
 	// Routes for authenticated users
 	allowed := router.Group("")
-	allowed.Use(infrastructures.AuthUser())
-	allowed.GET("/tasks", taskHandler.GetTasks)
-	allowed.GET("/tasks/:id", taskHandler.GetTaskByID)
+	allowed.Use(auth.AuthUser())
+	// account management is open to every role, so users whose role
+	// requires two-factor authentication can enroll, but not to API keys
+	account := allowed.Group("")
+	account.Use(infrastructures.RequireSession())
+	account.POST("/logout", userHandler.Logout)
+	account.PUT("/me/password", userHandler.ChangePassword)
+	account.POST("/2fa/enroll", userHandler.EnrollTwoFactor)
+	account.POST("/2fa/confirm", userHandler.ConfirmTwoFactor)
+	account.POST("/2fa/disable", userHandler.DisableTwoFactor)
+	account.GET("/me/api-keys", userHandler.ListAPIKeys)
+	account.POST("/me/api-keys", userHandler.CreateAPIKey)
+	account.DELETE("/me/api-keys/:id", userHandler.RevokeAPIKey)
+	allowed.GET("/tasks", readTasks, taskHandler.GetTasks)
+	allowed.GET("/tasks/:id", readTasks, taskHandler.GetTaskByID)
+	allowed.POST("/tasks", writeTasks, taskHandler.AddTask)
+	allowed.PUT("/tasks/:id", writeTasks, taskHandler.UpdateTask)
+	allowed.PATCH("/tasks/:id", writeTasks, taskHandler.PatchTask)
+	allowed.DELETE("/tasks/:id", writeTasks, taskHandler.DeleteTask)
+	allowed.POST("/tasks/:id/transitions", writeTasks, taskHandler.TransitionTask)
 
-	// Routes for admin users
+	// Administrative routes
 	protected := router.Group("/admin")
-	protected.Use(infrastructures.AuthMiddleware("admin"))
-	protected.PUT("/tasks/:id", taskHandler.UpdateTask)
-	protected.DELETE("/tasks/:id", taskHandler.DeleteTask)
-	protected.POST("/tasks", taskHandler.AddTask)
-	protected.POST("/register", userHandler.RegisterAdmin)
-	protected.POST("/activate/:username", userHandler.Activate)
-	protected.POST("/deactivate/:username", userHandler.DeActivate)
-	protected.GET("/promote/:username", userHandler.Promote)
-
-	// Run the server
-	router.Run("localhost:8080")
+	protected.Use(auth.AuthUser())
+	protected.PUT("/tasks/:id", manageTasks, taskHandler.UpdateTask)
+	protected.PATCH("/tasks/:id", manageTasks, taskHandler.PatchTask)
+	protected.DELETE("/tasks/:id", manageTasks, taskHandler.DeleteTask)
+	protected.POST("/tasks", manageTasks, taskHandler.AddTask)
+	protected.GET("/tasks/trash", manageTasks, taskHandler.GetTrash)
+	protected.POST("/tasks/:id/restore", manageTasks, taskHandler.RestoreTask)
+	protected.POST("/register", manageUsers, userHandler.RegisterAdmin)
+	protected.POST("/activate/:username", manageUsers, userHandler.Activate)
+	protected.POST("/deactivate/:username", manageUsers, userHandler.DeActivate)
+	protected.POST("/unlock/:username", manageUsers, userHandler.Unlock)
+	protected.GET("/users", manageUsers, userHandler.ListUsers)
+	protected.GET("/users/:username", manageUsers, userHandler.GetUser)
+	protected.DELETE("/users/:username", manageUsers, userHandler.DeleteUser)
+	protected.POST("/users/:username/demote", promoteUsers, userHandler.Demote)
+	protected.PUT("/users/:username/role", promoteUsers, userHandler.AssignRole)
+	protected.GET("/promote/:username", promoteUsers, userHandler.Promote)
+
+	return router
 }
@@ -0,0 +1,847 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/config"
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RouterTestSuite drives the whole API over the in-memory repositories.
+type RouterTestSuite struct {
+	suite.Suite
+	router   *gin.Engine
+	cfg      config.Config
+	tokens   *infrastructures.TokenService
+	hasher   *infrastructures.PasswordHasher
+	userRepo repository.UserRepository
+	// notifications receives what the server sends to users
+	notifications *bytes.Buffer
+}
+
+func (suite *RouterTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	suite.cfg = config.Default()
+	keys, err := infrastructures.GenerateKeySet(suite.cfg.Tokens.Algorithm)
+	suite.Require().NoError(err)
+	suite.tokens = infrastructures.NewTokenService(keys)
+	// cheap hashes, since every test registers and logs in
+	suite.hasher, err = infrastructures.NewPasswordHasher(bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.userRepo = repository.NewInMemoryUserRepository()
+	suite.notifications = new(bytes.Buffer)
+	suite.newRouter()
+}
+
+// newRouter rebuilds the router from the suite's configuration, keeping only
+// the users.
+func (suite *RouterTestSuite) newRouter() {
+	suite.router = NewRouter(suite.cfg, suite.tokens, suite.hasher, repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0)), suite.userRepo, repository.NewInMemorySessionRepository(), repository.NewInMemoryLoginAttemptRepository(), repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), repository.NewInMemoryPinger(), infrastructures.NewLogNotifier(suite.notifications))
+}
+
+func (suite *RouterTestSuite) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	return suite.doIfMatch(method, path, token, "", body)
+}
+
+// doIfMatch sends a request changing a task, based on the version etag names.
+func (suite *RouterTestSuite) doIfMatch(method, path, token, etag string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	suite.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// problemCode returns the code of the problem detail w answers with, or ""
+// if w is not an error response.
+func problemCode(w *httptest.ResponseRecorder) string {
+	if w.Header().Get("Content-Type") != infrastructures.ProblemContentType {
+		return ""
+	}
+	var problem infrastructures.Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &problem)
+	return problem.Code
+}
+
+func (suite *RouterTestSuite) login(username, password string) string {
+	return suite.loginTokens(username, password).AccessToken
+}
+
+func (suite *RouterTestSuite) loginTokens(username, password string) domain.TokenPair {
+	w := suite.do(http.MethodPost, "/login", "", gin.H{"Username": username, "Password": password})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var tokens domain.TokenPair
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &tokens))
+	return tokens
+}
+
+func (suite *RouterTestSuite) TestTaskLifecycle() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+
+	w := suite.do(http.MethodPost, "/admin/tasks", adminToken, gin.H{"title": "Write docs", "description": "API docs"})
+	suite.Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodGet, "/tasks/1", adminToken, nil)
+	suite.Equal(`"1"`, w.Header().Get("ETag"))
+
+	w = suite.doIfMatch(http.MethodPut, "/admin/tasks/1", adminToken, `"1"`, gin.H{
+		"title":       "Write more docs",
+		"description": "API docs",
+		"due_date":    "2030-01-02T15:04:05Z",
+		"priority":    "urgent",
+		"assignee":    "admin",
+	})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodGet, "/tasks/1", adminToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	var task domain.Task
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal("Write more docs", task.Title)
+	suite.Equal(domain.PriorityUrgent, task.Priority)
+	suite.Equal("admin", task.Assignee)
+	suite.Equal("2030-01-02T15:04:05Z", task.DueDate.Format(time.RFC3339))
+	suite.True(task.UpdatedAt.After(task.CreatedAt))
+	suite.Equal(int64(2), task.Version)
+	suite.Equal(`"2"`, w.Header().Get("ETag"))
+
+	// changes must name the version they are based on, and it must be current
+	w = suite.do(http.MethodPut, "/admin/tasks/1", adminToken, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusPreconditionRequired, w.Code)
+	w = suite.doIfMatch(http.MethodPut, "/admin/tasks/1", adminToken, `"1"`, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+	suite.Equal("version_mismatch", problemCode(w))
+	w = suite.doIfMatch(http.MethodDelete, "/admin/tasks/1", adminToken, `"1"`, nil)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+
+	req, err := http.NewRequest(http.MethodGet, "/tasks/1", nil)
+	suite.Require().NoError(err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("If-None-Match", `"2"`)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+
+	w = suite.doIfMatch(http.MethodPut, "/admin/tasks/1", adminToken, `"2"`, gin.H{"title": "t", "description": "d", "assignee": "nobody"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = suite.doIfMatch(http.MethodPut, "/admin/tasks/1", adminToken, `"2"`, gin.H{"title": "", "description": "d", "due_date": "2020-01-02T15:04:05Z"})
+	suite.Equal(http.StatusBadRequest, w.Code)
+	var problem infrastructures.Problem
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	suite.Equal("invalid_fields", problem.Code)
+	suite.Equal([]domain.FieldError{
+		{Field: "title", Message: "is required"},
+		{Field: "due_date", Message: "must not be in the past"},
+	}, problem.Errors)
+
+	w = suite.doIfMatch(http.MethodPut, "/admin/tasks/1", adminToken, `"2"`, gin.H{"title": 42, "description": "d"})
+	suite.Equal(http.StatusBadRequest, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	suite.Equal([]domain.FieldError{{Field: "title", Message: "cannot be a number"}}, problem.Errors)
+
+	// a merge patch changes the fields it names, and null clears them
+	w = suite.doIfMatch(http.MethodPatch, "/tasks/1", adminToken, `"2"`, gin.H{"priority": "low", "assignee": nil, "due_date": nil})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.Equal(`"3"`, w.Header().Get("ETag"))
+	task = domain.Task{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal("Write more docs", task.Title)
+	suite.Equal(domain.PriorityLow, task.Priority)
+	suite.Empty(task.Assignee)
+	suite.True(task.DueDate.IsZero())
+
+	w = suite.doIfMatch(http.MethodPatch, "/tasks/1", adminToken, `"3"`, gin.H{"status": "done"})
+	suite.Equal(http.StatusBadRequest, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	suite.Equal([]domain.FieldError{{Field: "status", Message: "cannot be changed"}}, problem.Errors)
+
+	// a replacement clears what it leaves out
+	w = suite.doIfMatch(http.MethodPut, "/tasks/1", adminToken, `"3"`, gin.H{"title": "Write docs", "description": "API docs"})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.Equal(`"4"`, w.Header().Get("ETag"))
+	w = suite.do(http.MethodGet, "/tasks/1", adminToken, nil)
+	task = domain.Task{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal(domain.PriorityNormal, task.Priority)
+	suite.Equal(domain.StatusPending, task.Status)
+
+	w = suite.do(http.MethodPost, "/tasks/1/transitions", adminToken, gin.H{"status": "someday"})
+	suite.Equal(http.StatusBadRequest, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	suite.Equal("invalid_fields", problem.Code)
+	suite.Equal("status", problem.Errors[0].Field)
+
+	w = suite.doIfMatch(http.MethodDelete, "/admin/tasks/1", adminToken, `"4"`, nil)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = suite.do(http.MethodGet, "/tasks/1", adminToken, nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// the deleted task waits in the trash until it is restored
+	var page domain.TaskPage
+	w = suite.do(http.MethodGet, "/admin/tasks/trash", adminToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.Require().Len(page.Tasks, 1)
+	suite.Require().NotNil(page.Tasks[0].Deleted)
+	suite.Equal("admin", page.Tasks[0].Deleted.By)
+
+	w = suite.do(http.MethodPost, "/admin/tasks/1/restore", adminToken, nil)
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.Equal(`"6"`, w.Header().Get("ETag"))
+	w = suite.do(http.MethodGet, "/tasks/1", adminToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	w = suite.do(http.MethodPost, "/admin/tasks/1/restore", adminToken, nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *RouterTestSuite) TestRegularUserCannotUseAdminRoutes() {
+	w := suite.do(http.MethodPost, "/register", "", gin.H{"Username": "bob", "Password": "bob-password"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	token := suite.login("bob", "bob-password")
+
+	w = suite.do(http.MethodGet, "/tasks", token, nil)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = suite.do(http.MethodPost, "/admin/tasks", token, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodGet, "/admin/tasks/trash", token, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPost, "/admin/tasks/1/restore", token, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *RouterTestSuite) TestErrorsAreProblemDetails() {
+	w := suite.do(http.MethodGet, "/tasks", "", nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.Equal("missing_credentials", problemCode(w))
+
+	suite.register("bob", "bob-password")
+	token := suite.login("bob", "bob-password")
+	w = suite.do(http.MethodPost, "/admin/tasks", token, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Equal("permission_denied", problemCode(w))
+
+	w = suite.doIfMatch(http.MethodDelete, "/tasks/missing", token, "*", nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+	var problem infrastructures.Problem
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	suite.Equal(infrastructures.Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "Task not found",
+		Instance: "/tasks/missing",
+		Code:     "task_not_found",
+	}, problem)
+
+	w = suite.do(http.MethodPost, "/register", "", gin.H{"Username": "bob", "Password": "bob-password"})
+	suite.Equal(http.StatusConflict, w.Code)
+	suite.Equal("username_taken", problemCode(w))
+}
+
+func (suite *RouterTestSuite) TestTaskTransitions() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	w := suite.do(http.MethodPost, "/register", "", gin.H{"Username": "bob", "Password": "bob-password"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	userToken := suite.login("bob", "bob-password")
+
+	w = suite.do(http.MethodPost, "/admin/tasks", adminToken, gin.H{"title": "Ship it", "description": "Release", "status": "done", "assignee": "bob"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	// a new task starts pending whatever the client asked for
+	w = suite.do(http.MethodPost, "/tasks/1/transitions", userToken, gin.H{"status": "done"})
+	suite.Equal(http.StatusConflict, w.Code, w.Body.String())
+
+	for _, status := range []string{"in_progress", "blocked", "in_progress", "done"} {
+		w = suite.do(http.MethodPost, "/tasks/1/transitions", userToken, gin.H{"status": status})
+		suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = suite.do(http.MethodPost, "/tasks/1/transitions", userToken, gin.H{"status": "archived"})
+	suite.Equal(http.StatusForbidden, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/tasks/1/transitions", adminToken, gin.H{"status": "archived"})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var task domain.Task
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal(domain.StatusArchived, task.Status)
+
+	w = suite.do(http.MethodPost, "/tasks/42/transitions", adminToken, gin.H{"status": "in_progress"})
+	suite.Equal(http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func (suite *RouterTestSuite) register(username, password string) string {
+	w := suite.do(http.MethodPost, "/register", "", gin.H{"Username": username, "Password": password})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	return suite.login(username, password)
+}
+
+func (suite *RouterTestSuite) TestTaskOwnership() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	aliceToken := suite.register("alice", "alicepass")
+	bobToken := suite.register("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/tasks", aliceToken, gin.H{"title": "Alice's", "description": "private"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/tasks", aliceToken, gin.H{"title": "Shared", "description": "for bob", "assignee": "bob"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var task domain.Task
+	w = suite.do(http.MethodGet, "/tasks/1", aliceToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal("alice", task.Owner)
+
+	// other users cannot tell the task exists
+	w = suite.do(http.MethodGet, "/tasks/1", bobToken, nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = suite.doIfMatch(http.MethodDelete, "/tasks/1", bobToken, "*", nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = suite.doIfMatch(http.MethodPut, "/tasks/1", bobToken, "*", gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// the assignee sees and progresses the task but cannot change or delete it
+	w = suite.do(http.MethodGet, "/tasks/2", bobToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	w = suite.do(http.MethodPost, "/tasks/2/transitions", bobToken, gin.H{"status": "in_progress"})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	w = suite.doIfMatch(http.MethodPut, "/tasks/2", bobToken, "*", gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.doIfMatch(http.MethodDelete, "/tasks/2", bobToken, "*", nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	var page domain.TaskPage
+	w = suite.do(http.MethodGet, "/tasks", bobToken, nil)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.EqualValues(1, page.Total)
+	w = suite.do(http.MethodGet, "/tasks", aliceToken, nil)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.EqualValues(2, page.Total)
+	w = suite.do(http.MethodGet, "/tasks", adminToken, nil)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.EqualValues(2, page.Total)
+
+	w = suite.doIfMatch(http.MethodDelete, "/tasks/1", adminToken, "*", nil)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *RouterTestSuite) TestRoleChangesApplyToNextToken() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	bobToken := suite.register("bob", "bob-password")
+
+	w := suite.do(http.MethodPut, "/admin/users/bob/role", bobToken, gin.H{"role": "admin"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPut, "/admin/users/bob/role", adminToken, gin.H{"role": "superuser"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+	w = suite.do(http.MethodPut, "/admin/users/nobody/role", adminToken, gin.H{"role": "admin"})
+	suite.Equal(http.StatusNotFound, w.Code, w.Body.String())
+	w = suite.do(http.MethodPut, "/admin/users/admin/role", adminToken, gin.H{"role": "user"})
+	suite.Equal(http.StatusForbidden, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodPut, "/admin/users/bob/role", adminToken, gin.H{"role": "admin"})
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	// the old token carries the old role, so its session ended
+	w = suite.do(http.MethodPost, "/admin/tasks", bobToken, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	bobToken = suite.login("bob", "bob-password")
+	w = suite.do(http.MethodPost, "/admin/tasks", bobToken, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusCreated, w.Code, w.Body.String())
+}
+
+func (suite *RouterTestSuite) TestConfiguredRoles() {
+	ctx := context.Background()
+	roles := domain.DefaultRoles()
+	roles["auditor"] = []domain.Permission{domain.PermTasksRead, domain.PermTasksManage}
+	suite.Require().NoError(roles.Validate())
+	suite.cfg.Roles = roles
+	suite.newRouter()
+
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	aliceToken := suite.register("alice", "alicepass")
+	suite.register("eve", "eve-password")
+
+	w := suite.do(http.MethodPost, "/tasks", aliceToken, gin.H{"title": "Alice's", "description": "private"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	w = suite.do(http.MethodPut, "/admin/users/eve/role", adminToken, gin.H{"role": "auditor"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	eveToken := suite.login("eve", "eve-password")
+
+	// auditors read every task but cannot write any
+	w = suite.do(http.MethodGet, "/tasks/1", eveToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+	w = suite.do(http.MethodPost, "/tasks", eveToken, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPost, "/tasks/1/transitions", eveToken, gin.H{"status": "in_progress"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPost, "/admin/activate/alice", eveToken, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *RouterTestSuite) TestRefreshAndLogout() {
+	suite.register("bob", "bob-password")
+	first := suite.loginTokens("bob", "bob-password")
+	other := suite.login("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": first.RefreshToken})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var second domain.TokenPair
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &second))
+	w = suite.do(http.MethodGet, "/tasks", second.AccessToken, nil)
+	suite.Equal(http.StatusOK, w.Code)
+
+	// refresh tokens cannot stand in for access tokens
+	w = suite.do(http.MethodGet, "/tasks", second.RefreshToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	w = suite.do(http.MethodPost, "/logout", second.AccessToken, nil)
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		w = suite.do(http.MethodGet, "/tasks", token, nil)
+		suite.Equal(http.StatusUnauthorized, w.Code)
+	}
+	w = suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": second.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	// other logins of the same user are unaffected
+	w = suite.do(http.MethodGet, "/tasks", other, nil)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *RouterTestSuite) TestRefreshTokenReuseRevokesSession() {
+	suite.register("bob", "bob-password")
+	first := suite.loginTokens("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": first.RefreshToken})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var second domain.TokenPair
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &second))
+
+	w = suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": first.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	w = suite.do(http.MethodGet, "/tasks", second.AccessToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *RouterTestSuite) TestDeactivationEndsSessions() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	suite.register("bob", "bob-password")
+	bob := suite.loginTokens("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/admin/deactivate/bob", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodGet, "/tasks", bob.AccessToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	w = suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": bob.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *RouterTestSuite) TestDeactivatedUserCannotLogIn() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	suite.register("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/admin/deactivate/bob", adminToken, gin.H{"reason": "left the team"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	user, err := suite.userRepo.LoginUser(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.Equal("left the team", user.Status.Reason)
+
+	w = suite.do(http.MethodPost, "/login", "", gin.H{"username": "bob", "password": "bob-password"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Equal("account_deactivated", problemCode(w))
+
+	w = suite.do(http.MethodPost, "/admin/activate/bob", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	bob := suite.login("bob", "bob-password")
+	w = suite.do(http.MethodGet, "/tasks", bob, nil)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = suite.do(http.MethodPost, "/admin/deactivate/nobody", adminToken, nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+// A status change written by another server instance is noticed although the
+// sessions of the user are still open.
+func (suite *RouterTestSuite) TestDeactivatedElsewhereIsForbidden() {
+	ctx := context.Background()
+	suite.register("bob", "bob-password")
+	bob := suite.login("bob", "bob-password")
+
+	status := domain.AccountStatus{State: domain.AccountDeactivated, ChangedAt: time.Now()}
+	suite.Require().NoError(suite.userRepo.SetAccountStatus(ctx, "bob", status))
+
+	w := suite.do(http.MethodGet, "/tasks", bob, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Equal("account_deactivated", problemCode(w))
+}
+
+// Tokens signed before a key rotation keep working, and the JWKS lists both
+// keys so other services can verify either.
+func (suite *RouterTestSuite) TestSigningKeyRotation() {
+	old, err := infrastructures.GenerateSigningKey("EdDSA")
+	suite.Require().NoError(err)
+	keys, err := infrastructures.NewKeySet(old)
+	suite.Require().NoError(err)
+	suite.tokens = infrastructures.NewTokenService(keys)
+	suite.newRouter()
+
+	suite.register("bob", "bob-password")
+	before := suite.login("bob", "bob-password")
+	next, err := infrastructures.GenerateSigningKey("RS256")
+	suite.Require().NoError(err)
+	suite.Require().NoError(keys.Rotate(next))
+	after := suite.login("bob", "bob-password")
+
+	for _, token := range []string{before, after} {
+		w := suite.do(http.MethodGet, "/tasks", token, nil)
+		suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w := suite.do(http.MethodGet, "/.well-known/jwks.json", "", nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var set infrastructures.JWKS
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &set))
+	suite.Require().Len(set.Keys, 2)
+	kids := []string{set.Keys[0].KeyID, set.Keys[1].KeyID}
+	suite.ElementsMatch([]string{old.ID, next.ID}, kids)
+	for _, jwk := range set.Keys {
+		suite.False(jwk.X == "" && jwk.N == "", "key %s is published without its public part", jwk.KeyID)
+	}
+}
+
+func (suite *RouterTestSuite) TestLoginLockout() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	suite.register("bob", "bob-password")
+
+	// unknown users and wrong passwords get the same answer
+	for _, username := range []string{"bob", "nobody"} {
+		w := suite.do(http.MethodPost, "/login", "", gin.H{"username": username, "password": "guess"})
+		suite.Equal(http.StatusUnauthorized, w.Code)
+		suite.Equal("invalid_credentials", problemCode(w))
+	}
+	for i := 1; i < domain.DefaultLoginPolicy().MaxFailures; i++ {
+		w := suite.do(http.MethodPost, "/login", "", gin.H{"username": "bob", "password": "guess"})
+		suite.Require().Equal(http.StatusUnauthorized, w.Code)
+	}
+
+	w := suite.do(http.MethodPost, "/login", "", gin.H{"username": "bob", "password": "bob-password"})
+	suite.Equal(http.StatusTooManyRequests, w.Code)
+	suite.NotEmpty(w.Header().Get("Retry-After"))
+
+	w = suite.do(http.MethodPost, "/admin/unlock/bob", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.login("bob", "bob-password")
+}
+
+// Admins must confirm logins with a code before their role's permissions
+// apply, but can log in with their password to enroll.
+func (suite *RouterTestSuite) TestTwoFactorRequiredForAdmins() {
+	ctx := context.Background()
+	suite.cfg.TwoFactorRoles = []string{domain.RoleAdmin}
+	suite.newRouter()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	suite.register("bob", "bob-password")
+
+	passwordOnly := suite.login("admin", "adminpass")
+	w := suite.do(http.MethodPost, "/admin/deactivate/bob", passwordOnly, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Contains(w.Body.String(), "two-factor")
+
+	w = suite.do(http.MethodPost, "/2fa/enroll", passwordOnly, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var enrollment domain.TwoFactorEnrollment
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &enrollment))
+	code, err := infrastructures.TOTPCode(enrollment.Secret, time.Now())
+	suite.Require().NoError(err)
+	w = suite.do(http.MethodPost, "/2fa/confirm", passwordOnly, gin.H{"code": code})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &confirmed))
+	suite.Len(confirmed.RecoveryCodes, 10)
+
+	w = suite.do(http.MethodPost, "/login", "", gin.H{"username": "admin", "password": "adminpass"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var result domain.LoginResult
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	suite.True(result.TwoFactorRequired)
+	suite.Empty(result.AccessToken)
+
+	w = suite.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": result.ChallengeToken, "code": "000000"})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	w = suite.do(http.MethodPost, "/login/2fa", "", gin.H{"challenge_token": result.ChallengeToken, "code": confirmed.RecoveryCodes[0]})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var tokens domain.TokenPair
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	w = suite.do(http.MethodPost, "/admin/deactivate/bob", tokens.AccessToken, nil)
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	// refreshed tokens keep the second factor
+	w = suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	suite.Require().Equal(http.StatusOK, w.Code)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &tokens))
+	w = suite.do(http.MethodPost, "/admin/activate/bob", tokens.AccessToken, nil)
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+}
+
+func (suite *RouterTestSuite) TestWeakPasswordsAreRefused() {
+	w := suite.do(http.MethodPost, "/register", "", gin.H{"Username": "bob", "Password": "bob"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/login", "", gin.H{"Username": "bob", "Password": "bob"})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	token := suite.register("bob", "bob-password")
+	w = suite.do(http.MethodPut, "/me/password", token, gin.H{"current_password": "bob-password", "new_password": "short"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+	suite.login("bob", "bob-password")
+}
+
+func (suite *RouterTestSuite) TestChangePassword() {
+	suite.register("bob", "bob-password")
+	tokens := suite.loginTokens("bob", "bob-password")
+
+	w := suite.do(http.MethodPut, "/me/password", tokens.AccessToken, gin.H{"current_password": "wrong", "new_password": "new-password"})
+	suite.Equal(http.StatusForbidden, w.Code, w.Body.String())
+	w = suite.do(http.MethodPut, "/me/password", tokens.AccessToken, gin.H{"current_password": "bob-password", "new_password": "new-password"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	// every session ended, the one that changed the password too
+	w = suite.do(http.MethodGet, "/tasks", tokens.AccessToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	w = suite.do(http.MethodPost, "/refresh", "", gin.H{"refresh_token": tokens.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	w = suite.do(http.MethodPost, "/login", "", gin.H{"Username": "bob", "Password": "bob-password"})
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.login("bob", "new-password")
+}
+
+func (suite *RouterTestSuite) TestPasswordReset() {
+	suite.register("bob", "bob-password")
+	oldToken := suite.login("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/password/forgot", "", gin.H{"username": "ghost"})
+	suite.Equal(http.StatusAccepted, w.Code, w.Body.String())
+	suite.Empty(suite.notifications.String())
+
+	w = suite.do(http.MethodPost, "/password/forgot", "", gin.H{"username": "bob"})
+	suite.Equal(http.StatusAccepted, w.Code, w.Body.String())
+	match := regexp.MustCompile(`password reset for bob: token (\S+),`).FindStringSubmatch(suite.notifications.String())
+	suite.Require().Len(match, 2, suite.notifications.String())
+
+	w = suite.do(http.MethodPost, "/password/reset", "", gin.H{"token": "forged", "new_password": "new-password"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/password/reset", "", gin.H{"token": match[1], "new_password": "new-password"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/password/reset", "", gin.H{"token": match[1], "new_password": "other-password"})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodGet, "/tasks", oldToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.login("bob", "new-password")
+}
+
+func TestRouterTestSuite(t *testing.T) {
+	suite.Run(t, new(RouterTestSuite))
+}
+
+func (suite *RouterTestSuite) TestUserAdministration() {
+	ctx := context.Background()
+	hashed, err := suite.hasher.Hash("adminpass")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.userRepo.RegisterAdmin(ctx, domain.User{Username: "admin", Password: hashed, Role: "admin"}))
+	adminToken := suite.login("admin", "adminpass")
+	aliceToken := suite.register("alice", "alicepass")
+	bobToken := suite.register("bob", "bob-password")
+
+	w := suite.do(http.MethodGet, "/admin/users", bobToken, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	var page domain.UserPage
+	w = suite.do(http.MethodGet, "/admin/users?role=user&limit=1", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	suite.NotContains(w.Body.String(), "assword")
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.EqualValues(2, page.Total)
+	suite.Require().Len(page.Users, 1)
+	suite.Equal("alice", page.Users[0].Username)
+	w = suite.do(http.MethodGet, "/admin/users?role=user&limit=1&cursor="+page.NextCursor, adminToken, nil)
+	page = domain.UserPage{}
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	suite.Require().Len(page.Users, 1)
+	suite.Equal("bob", page.Users[0].Username)
+	suite.Empty(page.NextCursor)
+
+	w = suite.do(http.MethodPost, "/tasks", bobToken, gin.H{"title": "Bob's", "description": "d"})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodDelete, "/admin/users/admin", adminToken, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodDelete, "/admin/users/bob?reassign_to=nobody", adminToken, nil)
+	suite.Equal(http.StatusBadRequest, w.Code)
+	w = suite.do(http.MethodDelete, "/admin/users/bob?reassign_to=alice", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	w = suite.do(http.MethodGet, "/tasks", bobToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	w = suite.do(http.MethodGet, "/admin/users/bob", adminToken, nil)
+	suite.Equal(http.StatusNotFound, w.Code)
+	var task domain.Task
+	w = suite.do(http.MethodGet, "/tasks/1", aliceToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	suite.NoError(json.Unmarshal(w.Body.Bytes(), &task))
+	suite.Equal("alice", task.Owner)
+
+	w = suite.do(http.MethodPut, "/admin/users/alice/role", adminToken, gin.H{"role": "admin"})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	aliceToken = suite.login("alice", "alicepass")
+	w = suite.do(http.MethodPost, "/admin/users/alice/demote", adminToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	w = suite.do(http.MethodGet, "/tasks", aliceToken, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *RouterTestSuite) TestAPIKeys() {
+	bobToken := suite.register("bob", "bob-password")
+
+	w := suite.do(http.MethodPost, "/me/api-keys", bobToken, gin.H{"name": "ci", "scopes": []string{"tasks:manage"}})
+	suite.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/me/api-keys", bobToken, gin.H{"name": "ci", "scopes": []string{"tasks:read"}})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+	var created domain.CreatedAPIKey
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+
+	// a read-only key reads but does not write, and cannot manage the account
+	w = suite.do(http.MethodGet, "/tasks", created.Key, nil)
+	suite.Equal(http.StatusOK, w.Code, w.Body.String())
+	w = suite.do(http.MethodPost, "/tasks", created.Key, gin.H{"title": "t", "description": "d"})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPost, "/me/api-keys", created.Key, gin.H{"name": "more", "scopes": []string{"tasks:read"}})
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = suite.do(http.MethodPost, "/logout", created.Key, nil)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	var listed struct {
+		APIKeys []domain.APIKeyInfo `json:"api_keys"`
+	}
+	w = suite.do(http.MethodGet, "/me/api-keys", bobToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	suite.NotContains(w.Body.String(), created.Key)
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &listed))
+	suite.Require().Len(listed.APIKeys, 1)
+	suite.Equal(created.Prefix, listed.APIKeys[0].Prefix)
+	suite.NotNil(listed.APIKeys[0].LastUsedAt)
+
+	w = suite.do(http.MethodDelete, "/me/api-keys/"+created.ID, bobToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	w = suite.do(http.MethodGet, "/tasks", created.Key, nil)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *RouterTestSuite) TestProbes() {
+	w := suite.do(http.MethodGet, "/healthz", "", nil)
+	suite.Equal(http.StatusOK, w.Code)
+	w = suite.do(http.MethodGet, "/readyz", "", nil)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+// A stopping server finishes the requests it has accepted before serve
+// returns.
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, &http.Server{Handler: handler}, listener, 5*time.Second) }()
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		assert.NoError(t, err)
+		responses <- resp
+	}()
+	<-started
+	stop()
+
+	require.NoError(t, <-served)
+	resp := <-responses
+	require.NotNil(t, resp)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// the listener is closed once serve returns
+	_, err = http.Get("http://" + listener.Addr().String())
+	assert.Error(t, err)
+}
@@ -0,0 +1,311 @@
+// Package config gathers every setting of the server into one typed
+// Config. Settings are named like environment variables, and each can also
+// be set in a file of KEY=value lines or with a command-line flag named
+// after it, ADDR as -addr and STORAGE_BACKEND as -storage-backend.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+
+	"github.com/joho/godotenv"
+)
+
+// DefaultFile is read when it exists and no other file is named.
+const DefaultFile = ".env"
+
+// Config is the whole configuration of the server.
+type Config struct {
+	// Addr is the address the server listens on.
+	Addr string
+	// ShutdownTimeout bounds how long a stopping server waits for requests
+	// in flight.
+	ShutdownTimeout time.Duration
+	Storage         Storage
+	Tokens          Tokens
+	// Roles maps every role to the permissions it grants.
+	Roles domain.RoleSet
+	// TwoFactorRoles lists roles, such as "admin", whose permissions need a
+	// login confirmed with a two-factor code.
+	TwoFactorRoles []string
+	// Timeouts bounds each operation, so a slow storage fails requests
+	// instead of piling them up.
+	Timeouts domain.Timeouts
+	Login    domain.LoginPolicy
+	Password domain.PasswordPolicy
+	// PasswordHashCost is the bcrypt cost of new hashes; older hashes are
+	// upgraded as their users log in.
+	PasswordHashCost int
+	// PasswordResetFile collects password reset tokens for local use;
+	// without it they are logged.
+	PasswordResetFile string
+	// TrashRetention is how long deleted tasks stay in the trash before
+	// they are purged for good.
+	TrashRetention time.Duration
+}
+
+// Storage selects where tasks and users live.
+type Storage struct {
+	Backend       string // "mongo", "bolt" or "memory"
+	MongoURI      string
+	MongoDatabase string
+	BoltPath      string
+	TaskIDs       string // "sequence", "uuid" or "ulid"
+}
+
+// Tokens locates the keys tokens are signed with. KeysDir holds PEM keys,
+// and SigningKey names the one that signs; the others only verify. Without
+// KeysDir a key of type Algorithm is generated at startup.
+type Tokens struct {
+	KeysDir    string
+	SigningKey string
+	Algorithm  string
+}
+
+// Default returns the configuration used for every setting left unset.
+func Default() Config {
+	return Config{
+		Addr:            "localhost:8080",
+		ShutdownTimeout: 15 * time.Second,
+		Storage: Storage{
+			Backend:       "mongo",
+			MongoDatabase: "task_manager",
+			BoltPath:      "task_manager.db",
+			TaskIDs:       "sequence",
+		},
+		Tokens:           Tokens{Algorithm: infrastructures.SigningMethodEdDSA.Alg()},
+		Roles:            domain.DefaultRoles(),
+		Timeouts:         domain.DefaultTimeouts(),
+		Login:            domain.DefaultLoginPolicy(),
+		Password:         domain.DefaultPasswordPolicy(),
+		PasswordHashCost: infrastructures.DefaultPasswordHashCost,
+		TrashRetention:   30 * 24 * time.Hour,
+	}
+}
+
+// settings documents every setting, for the flags.
+var settings = map[string]string{
+	"ADDR":                  "address to listen on",
+	"SHUTDOWN_TIMEOUT":      "how long to wait for requests in flight when stopping, such as 15s",
+	"READ_TIMEOUT":          "longest a lookup or listing may take, such as 5s",
+	"WRITE_TIMEOUT":         "longest an operation changing data may take, such as 10s",
+	"STORAGE_BACKEND":       `storage backend: "mongo", "bolt" or "memory"`,
+	"MONGO_URI":             "MongoDB connection string",
+	"MONGO_DATABASE":        "MongoDB database name",
+	"BOLT_PATH":             "bolt database file",
+	"TASK_IDS":              `IDs of new tasks: "sequence", "uuid" or "ulid"`,
+	"JWT_KEYS_DIR":          "directory of PEM keys tokens are signed with",
+	"JWT_SIGNING_KEY":       "id of the key in JWT_KEYS_DIR that signs",
+	"JWT_ALG":               `algorithm of the generated key without JWT_KEYS_DIR: "EdDSA" or "RS256"`,
+	"ROLES_FILE":            "JSON file of roles and their permissions",
+	"TWO_FACTOR_ROLES":      "comma-separated roles that need two-factor authentication",
+	"LOGIN_MAX_FAILURES":    "failed logins before an account is locked",
+	"LOGIN_LOCKOUT":         "first lockout after failed logins, such as 1m",
+	"LOGIN_MAX_LOCKOUT":     "longest an account lockout grows to, such as 1h",
+	"LOGIN_FAILURE_WINDOW":  "how long an account's failed logins are remembered, such as 24h",
+	"LOGIN_IP_MAX_FAILURES": "failed logins before a client address is blocked",
+	"LOGIN_IP_WINDOW":       "how long a client address stays blocked, such as 15m",
+	"PASSWORD_MIN_LENGTH":   "minimum password length",
+	"PASSWORD_MIN_CLASSES":  "character classes a password must mix",
+	"PASSWORD_DENYLIST":     "file of refused passwords, one per line",
+	"PASSWORD_HASH_COST":    "bcrypt cost of new password hashes",
+	"PASSWORD_RESET_FILE":   "file collecting password reset tokens",
+	"TRASH_RETENTION":       "how long deleted tasks stay in the trash, such as 720h",
+}
+
+// flagName is the command-line flag of the setting key.
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, a file, the environment read through lookupEnv, and the flags in
+// args. The file is the one named by -config or CONFIG_FILE, or DefaultFile
+// if it exists.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	fs := flag.NewFlagSet("task_manager", flag.ContinueOnError)
+	file := fs.String("config", "", "file of KEY=value settings")
+	keyOfFlag := make(map[string]string, len(settings))
+	for key, usage := range settings {
+		fs.String(flagName(key), "", usage)
+		keyOfFlag[flagName(key)] = key
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	values := map[string]string{}
+	path, required := *file, *file != ""
+	if !required {
+		path, required = lookupEnv("CONFIG_FILE")
+	}
+	if !required {
+		path = DefaultFile
+	}
+	fileValues, err := godotenv.Read(path)
+	switch {
+	case err == nil:
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	case required || !errors.Is(err, os.ErrNotExist):
+		return Config{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for key := range settings {
+		if value, ok := lookupEnv(key); ok {
+			values[key] = value
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := keyOfFlag[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+
+	cfg := Default()
+	if err := cfg.apply(values); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// apply sets the settings in values, reading the files they name. Empty
+// values leave the setting as it is.
+func (c *Config) apply(values map[string]string) error {
+	str := func(key string, dst *string) {
+		if v := values[key]; v != "" {
+			*dst = v
+		}
+	}
+	var err error
+	num := func(key string, dst *int) {
+		if v := values[key]; v != "" && err == nil {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	str("ADDR", &c.Addr)
+	str("STORAGE_BACKEND", &c.Storage.Backend)
+	str("MONGO_URI", &c.Storage.MongoURI)
+	str("MONGO_DATABASE", &c.Storage.MongoDatabase)
+	str("BOLT_PATH", &c.Storage.BoltPath)
+	str("TASK_IDS", &c.Storage.TaskIDs)
+	str("JWT_KEYS_DIR", &c.Tokens.KeysDir)
+	str("JWT_SIGNING_KEY", &c.Tokens.SigningKey)
+	str("JWT_ALG", &c.Tokens.Algorithm)
+	str("PASSWORD_RESET_FILE", &c.PasswordResetFile)
+	if v := values["TWO_FACTOR_ROLES"]; v != "" {
+		c.TwoFactorRoles = strings.Split(strings.ReplaceAll(v, " ", ""), ",")
+	}
+	num("LOGIN_MAX_FAILURES", &c.Login.MaxFailures)
+	num("LOGIN_IP_MAX_FAILURES", &c.Login.IPMaxFailures)
+	num("PASSWORD_MIN_LENGTH", &c.Password.MinLength)
+	num("PASSWORD_MIN_CLASSES", &c.Password.MinClasses)
+	num("PASSWORD_HASH_COST", &c.PasswordHashCost)
+	if err != nil {
+		return err
+	}
+	for key, dst := range map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":     &c.ShutdownTimeout,
+		"READ_TIMEOUT":         &c.Timeouts.Read,
+		"WRITE_TIMEOUT":        &c.Timeouts.Write,
+		"LOGIN_LOCKOUT":        &c.Login.Lockout,
+		"LOGIN_MAX_LOCKOUT":    &c.Login.MaxLockout,
+		"LOGIN_FAILURE_WINDOW": &c.Login.FailureWindow,
+		"LOGIN_IP_WINDOW":      &c.Login.IPWindow,
+		"TRASH_RETENTION":      &c.TrashRetention,
+	} {
+		if v := values[key]; v != "" {
+			if *dst, err = time.ParseDuration(v); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	if path := values["ROLES_FILE"]; path != "" {
+		if c.Roles, err = infrastructures.LoadRoles(path); err != nil {
+			return err
+		}
+	}
+	if path := values["PASSWORD_DENYLIST"]; path != "" {
+		if c.Password.Denylist, err = infrastructures.LoadPasswordDenylist(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration, so mistakes fail at startup.
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return errors.New("ADDR must not be empty")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.TrashRetention <= 0 {
+		return errors.New("TRASH_RETENTION must be positive")
+	}
+	switch c.Storage.Backend {
+	case "mongo":
+		if c.Storage.MongoURI == "" {
+			return errors.New("MONGO_URI is required for the mongo storage backend")
+		}
+		if c.Storage.MongoDatabase == "" {
+			return errors.New("MONGO_DATABASE must not be empty")
+		}
+	case "bolt":
+		if c.Storage.BoltPath == "" {
+			return errors.New("BOLT_PATH must not be empty")
+		}
+	case "memory":
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", c.Storage.Backend)
+	}
+	switch c.Storage.TaskIDs {
+	case "sequence", "uuid", "ulid":
+	default:
+		return fmt.Errorf("unknown TASK_IDS %q, use sequence, uuid or ulid", c.Storage.TaskIDs)
+	}
+	if c.Tokens.KeysDir == "" {
+		switch c.Tokens.Algorithm {
+		case infrastructures.SigningMethodEdDSA.Alg(), "RS256":
+		default:
+			return fmt.Errorf("unsupported JWT_ALG %q, use EdDSA or RS256", c.Tokens.Algorithm)
+		}
+	}
+	if err := c.Roles.Validate(); err != nil {
+		return err
+	}
+	for _, role := range c.TwoFactorRoles {
+		if !c.Roles.Defines(role) {
+			return fmt.Errorf("TWO_FACTOR_ROLES: %w: %q", domain.ErrUnknownRole, role)
+		}
+	}
+	if err := c.Timeouts.Validate(); err != nil {
+		return fmt.Errorf("READ_TIMEOUT, WRITE_TIMEOUT: %w", err)
+	}
+	if err := c.Login.Validate(); err != nil {
+		return fmt.Errorf("LOGIN_MAX_FAILURES, LOGIN_LOCKOUT, LOGIN_MAX_LOCKOUT, LOGIN_FAILURE_WINDOW, LOGIN_IP_MAX_FAILURES, LOGIN_IP_WINDOW: %w", err)
+	}
+	if err := c.Password.Validate(); err != nil {
+		return err
+	}
+	if err := infrastructures.ValidatePasswordHashCost(c.PasswordHashCost); err != nil {
+		return fmt.Errorf("PASSWORD_HASH_COST: %w", err)
+	}
+	return nil
+}
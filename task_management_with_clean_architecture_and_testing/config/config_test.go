@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// env is a lookupEnv reading from a map instead of the process.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"STORAGE_BACKEND": "memory", "CONFIG_FILE": writeFile(t, "empty.env", "")}))
+	require.NoError(t, err)
+
+	want := Default()
+	want.Storage.Backend = "memory"
+	assert.Equal(t, want, cfg)
+	assert.Equal(t, "localhost:8080", cfg.Addr)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "app.env", "ADDR=file:1\nSTORAGE_BACKEND=bolt\nBOLT_PATH=file.db\nLOGIN_LOCKOUT=2m\nSHUTDOWN_TIMEOUT=30s\n")
+
+	cfg, err := Load([]string{"-addr", "flag:3"}, env(map[string]string{
+		"CONFIG_FILE":      file,
+		"ADDR":             "env:2",
+		"BOLT_PATH":        "env.db",
+		"TWO_FACTOR_ROLES": "admin, user",
+		"READ_TIMEOUT":     "1s",
+		"TASK_IDS":         "ulid",
+		"TRASH_RETENTION":  "168h",
+		// a first lockout above the default maximum needs a higher maximum
+		"LOGIN_LOCKOUT":         "2h",
+		"LOGIN_MAX_LOCKOUT":     "12h",
+		"LOGIN_FAILURE_WINDOW":  "48h",
+		"LOGIN_IP_MAX_FAILURES": "50",
+		"LOGIN_IP_WINDOW":       "5m",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "flag:3", cfg.Addr)
+	assert.Equal(t, "bolt", cfg.Storage.Backend)
+	assert.Equal(t, "env.db", cfg.Storage.BoltPath)
+	assert.Equal(t, "ulid", cfg.Storage.TaskIDs)
+	assert.Equal(t, 7*24*time.Hour, cfg.TrashRetention)
+	assert.Equal(t, domain.LoginPolicy{
+		MaxFailures:   domain.DefaultLoginPolicy().MaxFailures,
+		Lockout:       2 * time.Hour,
+		MaxLockout:    12 * time.Hour,
+		FailureWindow: 48 * time.Hour,
+		IPMaxFailures: 50,
+		IPWindow:      5 * time.Minute,
+	}, cfg.Login)
+	assert.Equal(t, 30*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, domain.Timeouts{Read: time.Second, Write: domain.DefaultTimeouts().Write}, cfg.Timeouts)
+	assert.Equal(t, []string{"admin", "user"}, cfg.TwoFactorRoles)
+
+	// -config wins over CONFIG_FILE
+	other := writeFile(t, "other.env", "STORAGE_BACKEND=memory\n")
+	cfg, err = Load([]string{"-config", other}, env(map[string]string{"CONFIG_FILE": file}))
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.Storage.Backend)
+}
+
+func TestLoadFiles(t *testing.T) {
+	roles := writeFile(t, "roles.json", `{"user": ["tasks:read"], "admin": ["tasks:read", "tasks:manage"], "auditor": ["tasks:read"]}`)
+	denylist := writeFile(t, "denylist.txt", "Password1\n")
+
+	cfg, err := Load([]string{"-storage-backend", "memory", "-roles-file", roles, "-password-denylist", denylist}, env(nil))
+	require.NoError(t, err)
+	assert.True(t, cfg.Roles.Defines("auditor"))
+	assert.ErrorIs(t, cfg.Password.Check("bob", "password1"), domain.ErrWeakPassword)
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, args := range map[string][]string{
+		"missing config file":    {"-config", filepath.Join(t.TempDir(), "missing.env")},
+		"unknown flag":           {"-port", "80"},
+		"mongo without URI":      {"-storage-backend", "mongo"},
+		"unknown backend":        {"-storage-backend", "postgres"},
+		"unknown task IDs":       {"-storage-backend", "memory", "-task-ids", "random"},
+		"bad number":             {"-storage-backend", "memory", "-password-min-length", "eight"},
+		"bad duration":           {"-storage-backend", "memory", "-login-lockout", "forever"},
+		"invalid policy":         {"-storage-backend", "memory", "-login-max-failures", "0"},
+		"lockout above maximum":  {"-storage-backend", "memory", "-login-lockout", "2h"},
+		"no IP window":           {"-storage-backend", "memory", "-login-ip-window", "0s"},
+		"no IP failures":         {"-storage-backend", "memory", "-login-ip-max-failures", "0"},
+		"short failure window":   {"-storage-backend", "memory", "-login-max-lockout", "48h"},
+		"hash cost out of range": {"-storage-backend", "memory", "-password-hash-cost", "99"},
+		"unknown algorithm":      {"-storage-backend", "memory", "-jwt-alg", "HS256"},
+		"unknown 2FA role":       {"-storage-backend", "memory", "-two-factor-roles", "root"},
+		"no shutdown timeout":    {"-storage-backend", "memory", "-shutdown-timeout", "0s"},
+		"no trash retention":     {"-storage-backend", "memory", "-trash-retention", "0s"},
+		"negative read timeout":  {"-storage-backend", "memory", "-read-timeout", "-1s"},
+	} {
+		_, err := Load(args, env(map[string]string{"CONFIG_FILE": writeFile(t, "empty.env", "")}))
+		assert.Error(t, err, name)
+	}
+}
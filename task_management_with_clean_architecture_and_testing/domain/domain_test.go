@@ -1,10 +1,12 @@
 package domain
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -39,7 +41,7 @@ func TestUserCreation(t *testing.T) {
 	username := "testuser"
 	password := "password123"
 	role := "admin"
-	activate := "yes"
+	status := AccountStatus{State: AccountActive, ChangedAt: time.Now()}
 
 	// Act
 	user := User{
@@ -47,7 +49,7 @@ func TestUserCreation(t *testing.T) {
 		Username: username,
 		Password: password,
 		Role:     role,
-		Activate: activate,
+		Status:   status,
 	}
 
 	// Assert
@@ -55,5 +57,260 @@ func TestUserCreation(t *testing.T) {
 	assert.Equal(t, username, user.Username)
 	assert.Equal(t, password, user.Password)
 	assert.Equal(t, role, user.Role)
-	assert.Equal(t, activate, user.Activate)
+	assert.Equal(t, status, user.Status)
+	assert.True(t, user.Active())
+}
+
+func TestUserActive(t *testing.T) {
+	assert.True(t, User{}.Active())
+	assert.True(t, User{LegacyActivate: "true"}.Active())
+	assert.False(t, User{LegacyActivate: "false"}.Active())
+	assert.False(t, User{Status: AccountStatus{State: AccountDeactivated}}.Active())
+	// the status wins over the legacy flag once it is set
+	assert.True(t, User{Status: AccountStatus{State: AccountActive}, LegacyActivate: "false"}.Active())
+}
+
+func TestParsePriority(t *testing.T) {
+	p, err := ParsePriority("")
+	assert.NoError(t, err)
+	assert.Equal(t, PriorityNormal, p)
+
+	for _, valid := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent} {
+		p, err = ParsePriority(valid)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, p)
+	}
+
+	_, err = ParsePriority("critical")
+	assert.ErrorIs(t, err, ErrInvalidPriority)
+
+	assert.Less(t, PriorityLow.Rank(), PriorityUrgent.Rank())
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	cases := map[string]string{
+		"pending":     StatusPending,
+		"Pending":     StatusPending,
+		"In Progress": StatusInProgress,
+		"in_progress": StatusInProgress,
+		"Completed":   StatusDone,
+		"archived":    StatusArchived,
+	}
+	for input, want := range cases {
+		got, err := NormalizeStatus(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	_, err := NormalizeStatus("someday")
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+func TestCheckTransition(t *testing.T) {
+	roles := DefaultRoles()
+	user := roles.Actor("bob", RoleUser)
+	admin := roles.Actor("root", RoleAdmin)
+
+	assert.NoError(t, CheckTransition(StatusPending, StatusInProgress, user))
+	assert.NoError(t, CheckTransition(StatusInProgress, StatusBlocked, user))
+	assert.NoError(t, CheckTransition(StatusBlocked, StatusInProgress, user))
+	assert.NoError(t, CheckTransition(StatusInProgress, StatusDone, user))
+	assert.NoError(t, CheckTransition(StatusDone, StatusArchived, admin))
+
+	var transitionErr *TransitionError
+	err := CheckTransition(StatusPending, StatusDone, admin)
+	if assert.ErrorAs(t, err, &transitionErr) {
+		assert.Equal(t, StatusPending, transitionErr.From)
+		assert.Equal(t, StatusDone, transitionErr.To)
+	}
+	assert.ErrorAs(t, CheckTransition(StatusArchived, StatusDone, admin), &transitionErr)
+
+	assert.ErrorIs(t, CheckTransition(StatusDone, StatusArchived, user), ErrTransitionNotPermitted)
+}
+
+func TestRoleSet(t *testing.T) {
+	roles := DefaultRoles()
+	assert.NoError(t, roles.Validate())
+	assert.True(t, roles.Defines(RoleAdmin))
+	assert.False(t, roles.Defines("auditor"))
+
+	// users registered before roles were assigned count as regular users
+	assert.Equal(t, roles.Permissions(RoleUser), roles.Permissions(""))
+	assert.Empty(t, roles.Permissions("auditor"))
+
+	admin := roles.Actor("root", RoleAdmin)
+	assert.True(t, admin.Can(PermUsersPromote))
+	assert.False(t, roles.Actor("bob", RoleUser).Can(PermTasksManage))
+
+	roles["auditor"] = []Permission{PermTasksRead, "tasks:delete"}
+	assert.Error(t, roles.Validate())
+	assert.Error(t, RoleSet{RoleAdmin: nil}.Validate())
+}
+
+func TestLoginPolicy(t *testing.T) {
+	p := DefaultLoginPolicy()
+	assert.NoError(t, p.Validate())
+	last := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, p.AccountLockedUntil(Attempts{Failures: p.MaxFailures - 1, Last: last}).IsZero())
+	assert.Equal(t, last.Add(time.Minute), p.AccountLockedUntil(Attempts{Failures: p.MaxFailures, Last: last}))
+	assert.Equal(t, last.Add(4*time.Minute), p.AccountLockedUntil(Attempts{Failures: p.MaxFailures + 2, Last: last}))
+	// the backoff stops doubling at MaxLockout
+	assert.Equal(t, last.Add(time.Hour), p.AccountLockedUntil(Attempts{Failures: p.MaxFailures + 40, Last: last}))
+
+	assert.True(t, p.IPBlockedUntil(Attempts{Failures: p.IPMaxFailures - 1, Last: last}).IsZero())
+	assert.Equal(t, last.Add(p.IPWindow), p.IPBlockedUntil(Attempts{Failures: p.IPMaxFailures, Last: last}))
+
+	short := p
+	short.FailureWindow = p.MaxLockout / 2
+	assert.Error(t, short.Validate())
+	none := p
+	none.MaxFailures = 0
+	assert.Error(t, none.Validate())
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	p := DefaultPasswordPolicy()
+	assert.NoError(t, p.Validate())
+	assert.NoError(t, p.Check("bob", "correct horse"))
+	assert.ErrorIs(t, p.Check("bob", "short"), ErrWeakPassword)
+	assert.ErrorIs(t, p.Check("bob-smith", "BOB-SMITH"), ErrWeakPassword)
+	assert.ErrorIs(t, p.Check("bob", strings.Repeat("a", 73)), ErrWeakPassword)
+
+	p.MinClasses = 3
+	p.Denylist = map[string]struct{}{NormalizeDenied("Password1"): {}}
+	assert.NoError(t, p.Check("bob", "Horse-battery"))
+	assert.ErrorIs(t, p.Check("bob", "horsebattery"), ErrWeakPassword)
+	assert.ErrorIs(t, p.Check("bob", "pASSWORD1"), ErrWeakPassword)
+
+	// every problem is reported at once
+	var policyErr *PasswordPolicyError
+	assert.ErrorAs(t, p.Check("bob", "bob"), &policyErr)
+	assert.Len(t, policyErr.Problems, 3)
+
+	p.MinLength = 0
+	assert.Error(t, p.Validate())
+}
+
+func TestAPIKeyRequest(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	bob := DefaultRoles().Actor("bob", RoleUser)
+
+	r := APIKeyRequest{Name: " ci ", Scopes: []Permission{PermTasksRead}}
+	assert.NoError(t, r.Validate(bob, now))
+	assert.Equal(t, "ci", r.Name)
+	assert.Equal(t, now.Add(DefaultAPIKeyTTL), r.ExpiresAt)
+
+	// keys cannot grant more than their creator holds
+	r = APIKeyRequest{Name: "ci", Scopes: []Permission{PermTasksRead, PermUsersManage}}
+	assert.ErrorIs(t, r.Validate(bob, now), ErrInvalidAPIKeyScope)
+	r = APIKeyRequest{Name: "ci"}
+	assert.ErrorIs(t, r.Validate(bob, now), ErrNoAPIKeyScopes)
+	r = APIKeyRequest{Name: "  ", Scopes: []Permission{PermTasksRead}}
+	assert.ErrorIs(t, r.Validate(bob, now), ErrInvalidAPIKeyName)
+	r = APIKeyRequest{Name: "ci", Scopes: []Permission{PermTasksRead}, ExpiresAt: now.Add(-time.Hour)}
+	assert.ErrorIs(t, r.Validate(bob, now), ErrInvalidAPIKeyTTL)
+	r = APIKeyRequest{Name: "ci", Scopes: []Permission{PermTasksRead}, ExpiresAt: now.Add(MaxAPIKeyTTL + time.Hour)}
+	assert.ErrorIs(t, r.Validate(bob, now), ErrInvalidAPIKeyTTL)
+
+	admin := DefaultRoles().Actor("root", RoleAdmin).Restrict([]Permission{PermTasksRead, PermTasksManage})
+	assert.Equal(t, []Permission{PermTasksRead, PermTasksManage}, admin.Permissions)
+	assert.Empty(t, bob.Restrict([]Permission{PermUsersManage}).Permissions)
+}
+
+func TestErrorMatchesByCode(t *testing.T) {
+	reworded := ErrTaskNotFound.Reword("task with id 7 not found")
+	assert.ErrorIs(t, reworded, ErrTaskNotFound)
+	assert.Equal(t, KindNotFound, reworded.Kind)
+	assert.NotErrorIs(t, reworded, ErrUserNotFound)
+
+	// typed errors carry the kind of their sentinel
+	var domainErr *Error
+	assert.ErrorAs(t, &TransitionError{From: StatusDone, To: StatusPending}, &domainErr)
+	assert.Equal(t, KindConflict, domainErr.Kind)
+	assert.ErrorIs(t, &ThrottledError{RetryAfter: time.Minute}, ErrTooManyAttempts)
+	assert.ErrorIs(t, &PasswordPolicyError{Problems: []string{"too short"}}, ErrWeakPassword)
+}
+
+func TestValidateTask(t *testing.T) {
+	valid := Task{Title: "Write docs", Description: "API docs", DueDate: time.Now(), Status: "Completed", Priority: PriorityHigh}
+	assert.NoError(t, Validate(valid))
+
+	invalid := Task{
+		Title:       strings.Repeat("x", 201),
+		Description: "",
+		DueDate:     time.Now().AddDate(0, 0, -1),
+		Status:      "someday",
+		Priority:    "whenever",
+	}
+	err := Validate(invalid)
+	var validation *ValidationError
+	if assert.ErrorAs(t, err, &validation) {
+		assert.Equal(t, []FieldError{
+			{Field: "title", Message: "must be at most 200 characters"},
+			{Field: "description", Message: "is required"},
+			{Field: "due_date", Message: "must not be in the past"},
+			{Field: "status", Message: "must be one of pending, in_progress, blocked, done or archived", err: ErrUnknownStatus},
+			{Field: "priority", Message: "must be one of low, normal, high or urgent", err: ErrInvalidPriority},
+		}, validation.Fields)
+	}
+	assert.ErrorIs(t, err, ErrInvalidFields)
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+	assert.ErrorIs(t, err, ErrInvalidPriority)
+
+	// rules of fields left out are not checked
+	invalid = valid
+	invalid.DueDate = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, Validate(invalid, "DueDate"))
+}
+
+func TestMergePatch(t *testing.T) {
+	merged, err := MergePatch(
+		[]byte(`{"a":"b","c":{"d":"e","f":"g"},"h":[1,2]}`),
+		[]byte(`{"a":"z","c":{"f":null},"h":[3],"i":true}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":"z","c":{"d":"e"},"h":[3],"i":true}`, string(merged))
+
+	_, err = MergePatch([]byte(`{}`), []byte(`["a"]`))
+	assert.ErrorIs(t, err, ErrInvalidMergePatch)
+}
+
+func TestPatchTask(t *testing.T) {
+	due := time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)
+	task := Task{ID: "1", Title: "Write docs", Description: "API docs", DueDate: due, Status: StatusPending, Priority: PriorityHigh, Assignee: "bob", Owner: "alice"}
+
+	// members left out stay, null clears
+	patched, err := PatchTask(task, []byte(`{"title":"Write more docs","assignee":null,"due_date":null,"priority":null}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Write more docs", patched.Title)
+	assert.Equal(t, "API docs", patched.Description)
+	assert.Empty(t, patched.Assignee)
+	assert.True(t, patched.DueDate.IsZero())
+	assert.Empty(t, patched.Priority)
+	assert.Equal(t, "alice", patched.Owner)
+	assert.Equal(t, StatusPending, patched.Status)
+
+	// an empty patch changes nothing
+	patched, err = PatchTask(task, []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, task.Title, patched.Title)
+	assert.True(t, patched.DueDate.Equal(due))
+
+	// what the server sets cannot be patched
+	_, err = PatchTask(task, []byte(`{"status":"done","owner":"eve"}`))
+	var validation *ValidationError
+	if assert.ErrorAs(t, err, &validation) {
+		assert.Equal(t, []FieldError{
+			{Field: "owner", Message: "cannot be changed"},
+			{Field: "status", Message: "cannot be changed"},
+		}, validation.Fields)
+	}
+
+	_, err = PatchTask(task, []byte(`{"title":42}`))
+	if assert.ErrorAs(t, err, &validation) {
+		assert.Equal(t, []FieldError{{Field: "title", Message: "cannot be a number"}}, validation.Fields)
+	}
+
+	_, err = PatchTask(task, []byte(`null`))
+	assert.ErrorIs(t, err, ErrInvalidMergePatch)
 }
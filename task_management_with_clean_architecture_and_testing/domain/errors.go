@@ -0,0 +1,52 @@
+package domain
+
+// Kind classifies an error by what the caller can do about it. Delivery maps
+// every kind to one response status.
+type Kind string
+
+const (
+	KindValidation           Kind = "validation"            // the request is malformed or breaks a rule
+	KindUnauthenticated      Kind = "unauthenticated"       // the caller could not be identified
+	KindForbidden            Kind = "forbidden"             // the caller may not do this
+	KindNotFound             Kind = "not_found"             // what the request names does not exist
+	KindConflict             Kind = "conflict"              // the current state does not allow this
+	KindRateLimited          Kind = "rate_limited"          // the caller must wait before retrying
+	KindTimeout              Kind = "timeout"               // the operation did not finish in time
+	KindUnsupported          Kind = "unsupported"           // the request body is in a format not accepted
+	KindPreconditionFailed   Kind = "precondition_failed"   // the request was based on a state that changed
+	KindPreconditionRequired Kind = "precondition_required" // the request must say what state it is based on
+)
+
+// Error is an error the API reports to its clients. Code identifies it for
+// programs and stays stable; Message is meant for people and may be reworded.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func newError(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same code, so a reworded copy of a sentinel
+// still is that sentinel.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Reword returns e with a message that says more about the failure.
+func (e *Error) Reword(message string) *Error {
+	return newError(e.Kind, e.Code, message)
+}
+
+var (
+	ErrInvalidRequest    = newError(KindValidation, "invalid_request", "the request is invalid")
+	ErrUnsupportedFormat = newError(KindUnsupported, "unsupported_format", "the request body is in a format not accepted")
+	ErrIfMatchRequired   = newError(KindPreconditionRequired, "if_match_required", "If-Match must name the version the change is based on")
+)
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidCredentials is the only answer to a failed login, whether the
+	// user does not exist or the password is wrong, so logins cannot be used
+	// to find out which usernames exist.
+	ErrInvalidCredentials = newError(KindUnauthenticated, "invalid_credentials", "invalid username or password")
+	ErrTooManyAttempts    = newError(KindRateLimited, "too_many_attempts", "too many failed login attempts, try again later")
+)
+
+// ThrottledError rejects a login because of earlier failures. It matches
+// ErrTooManyAttempts.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// Attempts is what is remembered about the failed logins of one account or
+// one client address.
+type Attempts struct {
+	Failures int
+	Last     time.Time // when the latest failure happened
+}
+
+// LoginPolicy limits how fast passwords can be guessed. An account locks
+// after MaxFailures failed logins, for Lockout at first and twice as long
+// with each further failure. A client address that fails IPMaxFailures
+// times is blocked for IPWindow after its latest failure.
+type LoginPolicy struct {
+	MaxFailures   int
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+	FailureWindow time.Duration // an account's failures are forgotten this long after the last one
+	IPMaxFailures int
+	IPWindow      time.Duration
+}
+
+// DefaultLoginPolicy is used when no policy is configured.
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		MaxFailures:   5,
+		Lockout:       time.Minute,
+		MaxLockout:    time.Hour,
+		FailureWindow: 24 * time.Hour,
+		IPMaxFailures: 20,
+		IPWindow:      15 * time.Minute,
+	}
+}
+
+// Validate rejects policies that would never lock or would forget a lockout
+// before it ends.
+func (p LoginPolicy) Validate() error {
+	if p.MaxFailures < 1 || p.IPMaxFailures < 1 {
+		return errors.New("login policy: failure limits must be at least 1")
+	}
+	if p.Lockout <= 0 || p.MaxLockout < p.Lockout {
+		return errors.New("login policy: lockout must be positive and at most the maximum lockout")
+	}
+	if p.FailureWindow < p.MaxLockout || p.IPWindow <= 0 {
+		return errors.New("login policy: failure windows must be positive and outlast the maximum lockout")
+	}
+	return nil
+}
+
+// AccountLockedUntil returns when an account with the failures a may log in
+// again, or the zero time if it is not locked.
+func (p LoginPolicy) AccountLockedUntil(a Attempts) time.Time {
+	if a.Failures < p.MaxFailures {
+		return time.Time{}
+	}
+	lockout := p.Lockout
+	for i := p.MaxFailures; i < a.Failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return a.Last.Add(lockout)
+}
+
+// IPBlockedUntil returns when a client address with the failures a may try
+// again, or the zero time if it is not blocked.
+func (p LoginPolicy) IPBlockedUntil(a Attempts) time.Time {
+	if a.Failures < p.IPMaxFailures {
+		return time.Time{}
+	}
+	return a.Last.Add(p.IPWindow)
+}
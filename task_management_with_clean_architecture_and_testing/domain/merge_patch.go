@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidMergePatch = newError(KindValidation, "invalid_merge_patch", "a merge patch must be a JSON object")
+
+// MergePatch applies an RFC 7386 JSON merge patch to the JSON object target:
+// members of patch replace those of target, objects are merged member by
+// member, and null removes a member.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var doc, changes map[string]any
+	if err := json.Unmarshal(target, &doc); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, ErrInvalidMergePatch
+	}
+	return json.Marshal(mergeObject(doc, changes))
+}
+
+func mergeObject(target, patch map[string]any) map[string]any {
+	if target == nil {
+		target = map[string]any{}
+	}
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, name)
+		case map[string]any:
+			current, _ := target[name].(map[string]any)
+			target[name] = mergeObject(current, value)
+		default:
+			target[name] = value
+		}
+	}
+	return target
+}
+
+// taskReadOnlyFields are the members of a task only the server sets. The
+// status changes through transitions, and deleted by deleting and restoring.
+var taskReadOnlyFields = []string{"id", "owner", "status", "created_at", "updated_at", "version", "deleted"}
+
+// PatchTask applies a JSON merge patch to task, returning the patched task.
+// Leaving a member out keeps it, and null clears it: the due date, the
+// assignee, or the priority, which then is normal again. The result still
+// has to be validated.
+func PatchTask(task Task, patch []byte) (Task, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return Task{}, ErrInvalidMergePatch
+	}
+	var readOnly []FieldError
+	for _, name := range taskReadOnlyFields {
+		if _, ok := members[name]; ok {
+			readOnly = append(readOnly, FieldError{Field: name, Message: "cannot be changed"})
+		}
+	}
+	if len(readOnly) > 0 {
+		return Task{}, &ValidationError{Fields: readOnly}
+	}
+
+	current, err := json.Marshal(task)
+	if err != nil {
+		return Task{}, err
+	}
+	merged, err := MergePatch(current, patch)
+	if err != nil {
+		return Task{}, err
+	}
+	var patched Task
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return Task{}, &ValidationError{Fields: []FieldError{{Field: typeErr.Field, Message: "cannot be a " + typeErr.Value}}}
+		}
+		return Task{}, ErrInvalidRequest.Reword(err.Error())
+	}
+	return patched, nil
+}
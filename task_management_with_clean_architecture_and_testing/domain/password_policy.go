@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrWeakPassword is matched by every PasswordPolicyError.
+var ErrWeakPassword = newError(KindValidation, "weak_password", "password does not meet the password policy")
+
+// PasswordPolicyError lists every rule of the policy a password breaks, so
+// users can fix them all at once. It matches ErrWeakPassword.
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error() + ": " + strings.Join(e.Problems, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// maxPasswordBytes is the longest password bcrypt hashes completely; it
+// ignores everything after.
+const maxPasswordBytes = 72
+
+// PasswordPolicy decides which new passwords are accepted. A password needs
+// MinLength characters, and characters from at least MinClasses of the four
+// classes lower case, upper case, digits and symbols. Passwords in Denylist,
+// such as common or breached ones, are refused whatever their strength.
+type PasswordPolicy struct {
+	MinLength  int
+	MinClasses int
+	// Denylist holds refused passwords in lower case; see NormalizeDenied.
+	Denylist map[string]struct{}
+}
+
+// DefaultPasswordPolicy is used when no policy is configured.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MinClasses: 1}
+}
+
+// Validate rejects policies that no password could meet.
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 1 || p.MinLength > maxPasswordBytes {
+		return fmt.Errorf("password policy: minimum length must be between 1 and %d", maxPasswordBytes)
+	}
+	if p.MinClasses < 0 || p.MinClasses > 4 {
+		return errors.New("password policy: character classes must be between 0 and 4")
+	}
+	return nil
+}
+
+// NormalizeDenied is how passwords are compared with the denylist, so that
+// changing the case of a common password does not get it accepted.
+func NormalizeDenied(password string) string {
+	return strings.ToLower(password)
+}
+
+// Check returns a *PasswordPolicyError if password, chosen by username, breaks
+// the policy.
+func (p PasswordPolicy) Check(username, password string) error {
+	var problems []string
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes))
+	}
+	if classes := characterClasses(password); classes < p.MinClasses {
+		problems = append(problems, fmt.Sprintf("must mix at least %d of lower case, upper case, digits and symbols", p.MinClasses))
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		problems = append(problems, "must not be the username")
+	}
+	if _, ok := p.Denylist[NormalizeDenied(password)]; ok {
+		problems = append(problems, "is too common")
+	}
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+	return classes
+}
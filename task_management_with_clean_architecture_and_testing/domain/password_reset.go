@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+var (
+	ErrWrongPassword     = newError(KindForbidden, "wrong_password", "current password is incorrect")
+	ErrInvalidResetToken = newError(KindValidation, "invalid_reset_token", "password reset token is invalid or expired")
+)
+
+// PasswordReset is an outstanding request to reset a user's password. Only
+// the hash of its token is stored; the token itself is sent to the user and
+// works once, until ExpiresAt.
+type PasswordReset struct {
+	TokenHash string
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
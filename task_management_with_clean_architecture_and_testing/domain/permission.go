@@ -0,0 +1,86 @@
+package domain
+
+import "fmt"
+
+// Permission names one kind of operation a role may perform.
+type Permission string
+
+const (
+	PermTasksRead    Permission = "tasks:read"    // list and read the tasks one owns or is assigned to
+	PermTasksWrite   Permission = "tasks:write"   // create tasks, change one's own tasks, move tasks through the lifecycle
+	PermTasksManage  Permission = "tasks:manage"  // read and change every task, archive and unarchive
+	PermUsersManage  Permission = "users:manage"  // register admins, activate and deactivate users
+	PermUsersPromote Permission = "users:promote" // assign roles to users
+)
+
+// Built-in roles. Register gives new users RoleUser and RegisterAdmin gives
+// RoleAdmin, so every role set must define both.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrUnknownRole          = newError(KindValidation, "unknown_role", "role is not defined")
+	ErrPermissionDenied     = newError(KindForbidden, "permission_denied", "Forbidden for you")
+	ErrSecondFactorRequired = newError(KindForbidden, "second_factor_required", "your role requires two-factor authentication, enroll and log in again")
+)
+
+var knownPermissions = map[Permission]bool{
+	PermTasksRead:    true,
+	PermTasksWrite:   true,
+	PermTasksManage:  true,
+	PermUsersManage:  true,
+	PermUsersPromote: true,
+}
+
+// RoleSet maps every role name to the permissions it grants.
+type RoleSet map[string][]Permission
+
+// DefaultRoles is used when no role configuration is supplied.
+func DefaultRoles() RoleSet {
+	return RoleSet{
+		RoleUser:  {PermTasksRead, PermTasksWrite},
+		RoleAdmin: {PermTasksRead, PermTasksWrite, PermTasksManage, PermUsersManage, PermUsersPromote},
+	}
+}
+
+// Validate checks that the built-in roles exist and that every permission is
+// known, so a typo in the configuration fails at startup instead of silently
+// locking users out.
+func (r RoleSet) Validate() error {
+	for _, role := range []string{RoleUser, RoleAdmin} {
+		if _, ok := r[role]; !ok {
+			return fmt.Errorf("role %q must be defined", role)
+		}
+	}
+	for role, perms := range r {
+		for _, p := range perms {
+			if !knownPermissions[p] {
+				return fmt.Errorf("role %q grants unknown permission %q", role, p)
+			}
+		}
+	}
+	return nil
+}
+
+// Defines reports whether role can be assigned to users.
+func (r RoleSet) Defines(role string) bool {
+	_, ok := r[role]
+	return ok
+}
+
+// Permissions returns what role grants. Users stored before roles were
+// assigned on registration have no role and count as RoleUser; unknown roles
+// grant nothing.
+func (r RoleSet) Permissions(role string) []Permission {
+	if role == "" {
+		role = RoleUser
+	}
+	return r[role]
+}
+
+// Actor builds the actor for a user holding role.
+func (r RoleSet) Actor(username, role string) Actor {
+	return Actor{Username: username, Role: role, Permissions: r.Permissions(role)}
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+var (
+	ErrSessionNotFound     = newError(KindNotFound, "session_not_found", "session not found")
+	ErrSessionChanged      = newError(KindConflict, "session_changed", "session was rotated by another request")
+	ErrInvalidRefreshToken = newError(KindUnauthenticated, "invalid_refresh_token", "refresh token is invalid or expired")
+	ErrRefreshTokenReused  = newError(KindUnauthenticated, "refresh_token_reused", "refresh token was already used, the session has been revoked")
+	ErrMissingCredentials  = newError(KindUnauthenticated, "missing_credentials", "Authorization header missing!")
+	ErrInvalidAuthHeader   = newError(KindUnauthenticated, "invalid_authorization_header", "Invalid authorization header")
+	ErrInvalidAccessToken  = newError(KindUnauthenticated, "invalid_access_token", "Invalid JWT")
+	ErrSessionEnded        = newError(KindUnauthenticated, "session_ended", "Session has ended, please log in again")
+)
+
+// Session is one login of a user. Every access token names the session it
+// was issued for, so revoking the session invalidates the tokens at once.
+// Refresh tokens carry the generation they were issued at; each refresh moves
+// the session to the next generation, which makes older refresh tokens
+// recognisable as reused.
+type Session struct {
+	ID         string
+	Username   string
+	Generation int
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // the last refresh token issued expires here
+	Revoked    bool
+	// SecondFactor is set when the login was confirmed with a two-factor
+	// code; the session's access tokens say so.
+	SecondFactor bool
+}
+
+// Active reports whether tokens of the session are still accepted at now.
+func (s Session) Active(now time.Time) bool {
+	return !s.Revoked && now.Before(s.ExpiresAt)
+}
+
+// TokenPair is what a login or a refresh hands to the client.
+type TokenPair struct {
+	AccessToken  string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
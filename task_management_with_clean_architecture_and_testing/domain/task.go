@@ -1,13 +1,84 @@
 package domain
 
-import (
-	"time"
-)
+import "time"
 
+// Task is a unit of work. The validate tags are the rules a task must follow
+// when it is created or changed; see Validate.
 type Task struct {
 	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	DueDate     time.Time `json:"due_date"`
-	Status      string    `json:"status"`
+	Title       string    `json:"title" validate:"notblank,max=200"`
+	Description string    `json:"description" validate:"notblank,max=5000"`
+	DueDate     time.Time `json:"due_date" validate:"notpast"`
+	Status      string    `json:"status" validate:"status"`
+	Priority    Priority  `json:"priority" validate:"priority"`
+	Assignee    string    `json:"assignee,omitempty" validate:"max=100"` // username of the user the task is assigned to
+	Owner       string    `json:"owner,omitempty"`                       // username of the user who created the task
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Version counts the changes to the task. Writes name the version they
+	// were based on and fail if another write came first.
+	Version int64 `json:"version"`
+	// Deleted is set while the task is in the trash.
+	Deleted *Deletion `json:"deleted,omitempty"`
+}
+
+// Deletion records who moved a task to the trash, and when. Trashed tasks
+// are hidden from every listing and lookup but the trash, until they are
+// restored or purged.
+type Deletion struct {
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// AnyVersion names no version in particular: a write based on it succeeds
+// against whatever version is stored.
+const AnyVersion int64 = -1
+
+// Priority ranks how urgent a task is.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+var (
+	ErrTaskNotFound    = newError(KindNotFound, "task_not_found", "Task not found")
+	ErrInvalidPriority = newError(KindValidation, "invalid_priority", "priority must be one of low, normal, high or urgent")
+	ErrUnknownAssignee = newError(KindValidation, "unknown_assignee", "assignee does not exist")
+	ErrForbidden       = newError(KindForbidden, "task_forbidden", "you are not allowed to change this task")
+	ErrVersionMismatch = newError(KindPreconditionFailed, "version_mismatch", "the task was changed since that version")
+	ErrNotInTrash      = newError(KindNotFound, "task_not_in_trash", "no task with that id is in the trash")
+	// ErrDuplicateTaskID reports a new task whose generated ID is in use
+	// already, which means tasks were added without the generator since its
+	// sequence started. The sequence moved on, so trying again may succeed.
+	ErrDuplicateTaskID = newError(KindConflict, "duplicate_task_id", "the generated task ID is in use already, try again")
+)
+
+// ParsePriority validates p, defaulting an empty priority to normal.
+func ParsePriority(p Priority) (Priority, error) {
+	switch p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return p, nil
+	}
+	return "", ErrInvalidPriority
+}
+
+// Rank orders priorities from low (1) to urgent (4); unknown values rank 0.
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityNormal:
+		return 2
+	case PriorityHigh:
+		return 3
+	case PriorityUrgent:
+		return 4
+	}
+	return 0
 }
@@ -0,0 +1,78 @@
+package domain
+
+import "time"
+
+// Fields tasks can be sorted by.
+const (
+	SortByCreatedAt = "created_at"
+	SortByDueDate   = "due_date"
+	SortByPriority  = "priority"
+)
+
+const (
+	DefaultTaskPageSize = 50
+	MaxTaskPageSize     = 200
+)
+
+var (
+	ErrInvalidSort   = newError(KindValidation, "invalid_sort", "sort must be one of created_at, due_date or priority")
+	ErrInvalidLimit  = newError(KindValidation, "invalid_limit", "limit must be between 1 and 200")
+	ErrInvalidCursor = newError(KindValidation, "invalid_cursor", "cursor is invalid or belongs to a different sort order")
+	ErrInvalidOrder  = newError(KindValidation, "invalid_order", "order must be asc or desc")
+	ErrInvalidDate   = newError(KindValidation, "invalid_date", "dates must be RFC 3339 timestamps or YYYY-MM-DD dates")
+)
+
+// TaskQuery selects, orders and pages the tasks returned by a listing. Zero
+// values mean "no constraint".
+type TaskQuery struct {
+	Status     string    // lifecycle state, legacy spellings included
+	Assignee   string    // exact username
+	DueAfter   time.Time // inclusive; tasks without a due date never match a range
+	DueBefore  time.Time // inclusive
+	Text       string    // case-insensitive substring of title or description
+	VisibleTo  string    // username that must own or be assigned the task; set by the use case, never by clients
+	Trashed    bool      // list the trash instead of the live tasks; set by the use case, never by clients
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string // opaque, taken from TaskPage.NextCursor
+}
+
+// TaskPage is one page of a listing.
+type TaskPage struct {
+	Tasks      []Task `json:"tasks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int64  `json:"total"` // tasks matching the filters across all pages
+}
+
+// Normalize validates q and fills in the default sort and page size.
+func (q *TaskQuery) Normalize() error {
+	if q.Status != "" {
+		status, err := NormalizeStatus(q.Status)
+		if err != nil {
+			return err
+		}
+		q.Status = status
+	}
+
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByDueDate, SortByPriority:
+	default:
+		return ErrInvalidSort
+	}
+
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultTaskPageSize
+	case q.Limit < 0 || q.Limit > MaxTaskPageSize:
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+// HasDueRange reports whether q filters on the due date.
+func (q TaskQuery) HasDueRange() bool {
+	return !q.DueAfter.IsZero() || !q.DueBefore.IsZero()
+}
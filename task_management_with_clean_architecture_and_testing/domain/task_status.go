@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Task lifecycle states.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+	StatusArchived   = "archived"
+)
+
+var (
+	ErrUnknownStatus          = newError(KindValidation, "invalid_status", "status must be one of pending, in_progress, blocked, done or archived")
+	ErrTransitionNotPermitted = newError(KindForbidden, "transition_not_permitted", "your role may not perform this transition")
+	ErrStatusChanged          = newError(KindConflict, "status_changed", "task status was changed by another request")
+	ErrInvalidTransition      = newError(KindConflict, "invalid_transition", "the task cannot move to that status")
+)
+
+// TransitionError reports a status change the lifecycle does not allow. It
+// matches ErrInvalidTransition.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move task from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// taskTransitions lists, for every state, the states it may move to and the
+// permission needed to make that move. An empty permission means anyone who
+// may work on the task.
+var taskTransitions = map[string]map[string]Permission{
+	StatusPending: {
+		StatusInProgress: "",
+		StatusArchived:   PermTasksManage,
+	},
+	StatusInProgress: {
+		StatusPending: "",
+		StatusBlocked: "",
+		StatusDone:    "",
+	},
+	StatusBlocked: {
+		StatusInProgress: "",
+	},
+	StatusDone: {
+		StatusInProgress: "", // reopen
+		StatusArchived:   PermTasksManage,
+	},
+	StatusArchived: {
+		StatusPending: PermTasksManage, // unarchive
+	},
+}
+
+// legacyStatuses maps the free-form values stored before the lifecycle
+// existed onto lifecycle states.
+var legacyStatuses = map[string]string{
+	"pending":     StatusPending,
+	"in progress": StatusInProgress,
+	"in_progress": StatusInProgress,
+	"blocked":     StatusBlocked,
+	"completed":   StatusDone,
+	"done":        StatusDone,
+	"archived":    StatusArchived,
+}
+
+// storedLegacyStatuses are the values written by Add before the lifecycle
+// existed, and by the older task manager variants.
+var storedLegacyStatuses = []string{"Pending", "In Progress", "Completed"}
+
+// StatusSpellings lists every stored value that normalises to status, so
+// storage filters also match tasks written before the lifecycle existed.
+func StatusSpellings(status string) []string {
+	spellings := []string{status}
+	for _, legacy := range storedLegacyStatuses {
+		if s, _ := NormalizeStatus(legacy); s == status {
+			spellings = append(spellings, legacy)
+		}
+	}
+	return spellings
+}
+
+// NormalizeStatus maps a stored or client supplied status onto a lifecycle
+// state, accepting legacy spellings such as "Pending" or "Completed".
+func NormalizeStatus(status string) (string, error) {
+	if s, ok := legacyStatuses[strings.ToLower(strings.TrimSpace(status))]; ok {
+		return s, nil
+	}
+	return "", ErrUnknownStatus
+}
+
+// CheckTransition reports whether actor may move a task from one state to
+// another. Illegal moves return a *TransitionError.
+func CheckTransition(from, to string, actor Actor) error {
+	required, ok := taskTransitions[from][to]
+	if !ok {
+		return &TransitionError{From: from, To: to}
+	}
+	if required != "" && !actor.Can(required) {
+		return ErrTransitionNotPermitted
+	}
+	return nil
+}
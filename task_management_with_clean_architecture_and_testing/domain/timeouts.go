@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTimeout reports an operation that did not finish within its timeout,
+// usually because the storage is slow or unreachable.
+var ErrTimeout = newError(KindTimeout, "timeout", "the operation timed out, please try again")
+
+// Timeouts bounds how long one operation may take. Read covers lookups and
+// listings, Write everything that changes stored data.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// DefaultTimeouts is used when no timeouts are configured.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{Read: 5 * time.Second, Write: 10 * time.Second}
+}
+
+// Validate rejects timeouts that would fail every operation.
+func (t Timeouts) Validate() error {
+	if t.Read <= 0 || t.Write <= 0 {
+		return errors.New("timeouts must be positive")
+	}
+	return nil
+}
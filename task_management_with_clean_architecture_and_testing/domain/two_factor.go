@@ -0,0 +1,46 @@
+package domain
+
+var (
+	ErrTwoFactorEnabled     = newError(KindConflict, "two_factor_enabled", "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = newError(KindConflict, "two_factor_not_enrolled", "start two-factor enrollment first")
+	ErrTwoFactorNotEnabled  = newError(KindConflict, "two_factor_not_enabled", "two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode = newError(KindValidation, "invalid_two_factor_code", "invalid two-factor code")
+	ErrInvalidChallenge     = newError(KindUnauthenticated, "invalid_challenge", "login challenge is invalid or expired, log in again")
+	// ErrLoginNotConfirmed wraps ErrInvalidTwoFactorCode at login, where a
+	// wrong code fails the authentication.
+	ErrLoginNotConfirmed = newError(KindUnauthenticated, "login_not_confirmed", "login was not confirmed")
+)
+
+// TwoFactor is the TOTP (RFC 6238) second factor of a user. Enrollment
+// stores the secret; it is only required at login once a code confirmed
+// that the user's authenticator produces the same codes.
+type TwoFactor struct {
+	Enabled bool   `bson:"enabled"`
+	Secret  string `bson:"secret,omitempty"`
+	// LastStep is the time step of the last code accepted. Codes of that step
+	// or earlier are refused, so an observed code cannot be replayed.
+	LastStep int64 `bson:"laststep,omitempty"`
+	// RecoveryCodes are hashes of the single-use codes that replace the
+	// authenticator when it is lost.
+	RecoveryCodes []string `bson:"recoverycodes,omitempty"`
+}
+
+// IsZero lets storage omit the second factor of users who never enrolled.
+func (t TwoFactor) IsZero() bool {
+	return !t.Enabled && t.Secret == "" && t.LastStep == 0 && len(t.RecoveryCodes) == 0
+}
+
+// TwoFactorEnrollment is what a user needs to set up their authenticator.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// LoginResult is the outcome of a password check: either the tokens, or,
+// for users with two-factor authentication, a challenge to complete with a
+// code.
+type LoginResult struct {
+	TokenPair
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
@@ -1,13 +1,87 @@
 package domain
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrUserNotFound       = newError(KindNotFound, "user_not_found", "user does not exist")
+	ErrAccountDeactivated = newError(KindForbidden, "account_deactivated", "account is deactivated")
+	ErrUsernameTaken      = newError(KindConflict, "username_taken", "username already exists")
+)
+
+// User is a stored account. It holds the password hash, so responses use
+// UserProfile instead.
 type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty"`
 	Username string             `bson:"username,omitempty"`
 	Password string             `bson:"password,omitempty"`
 	Role     string             `bson:"role,omitempty"`
-	Activate string             `bson:"activate,omitempty"`
+	Status   AccountStatus      `bson:"status,omitempty"`
+	// TwoFactor is managed through enrollment only; registration clears it.
+	TwoFactor TwoFactor `bson:"two_factor,omitempty"`
+	// LegacyActivate is the "true"/"false" flag stored before Status existed.
+	// It is only read, for users whose Status was never set.
+	LegacyActivate string `bson:"activate,omitempty" json:"Activate,omitempty"`
+}
+
+// AccountState says whether a user may sign in.
+type AccountState string
+
+const (
+	AccountActive      AccountState = "active"
+	AccountDeactivated AccountState = "deactivated"
+)
+
+// AccountStatus records the state of an account and the last change to it.
+type AccountStatus struct {
+	State     AccountState `bson:"state"`
+	Reason    string       `bson:"reason,omitempty"`
+	ChangedAt time.Time    `bson:"changedat"`
+}
+
+// IsZero lets storage omit a status that was never set.
+func (s AccountStatus) IsZero() bool {
+	return s.State == "" && s.Reason == "" && s.ChangedAt.IsZero()
+}
+
+// Active reports whether the user may sign in and use their tokens. Users
+// stored before the status existed are active unless they were deactivated
+// through the legacy flag.
+func (u User) Active() bool {
+	if u.Status.State != "" {
+		return u.Status.State == AccountActive
+	}
+	return u.LegacyActivate != "false"
+}
+
+// Actor is the authenticated user on whose behalf a use case runs, with the
+// permissions of their role resolved when the request came in.
+type Actor struct {
+	Username    string
+	Role        string
+	Permissions []Permission
+}
+
+// Can reports whether the actor's role grants p.
+func (a Actor) Can(p Permission) bool {
+	for _, granted := range a.Permissions {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSee reports whether the actor may read task: managers see everything,
+// other users the tasks they own or are assigned to.
+func (a Actor) CanSee(task Task) bool {
+	return a.Can(PermTasksManage) || (a.Username != "" && (task.Owner == a.Username || task.Assignee == a.Username))
+}
+
+// CanModify reports whether the actor may edit or delete task.
+func (a Actor) CanModify(task Task) bool {
+	return a.Can(PermTasksManage) || (a.Username != "" && task.Owner == a.Username)
 }
@@ -0,0 +1,94 @@
+package domain
+
+import "time"
+
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+var (
+	ErrInvalidAccountState = newError(KindValidation, "invalid_account_status", "status must be active or deactivated")
+	ErrInvalidUserLimit    = newError(KindValidation, "invalid_limit", "limit must be between 1 and 200")
+	ErrSelfAdministration  = newError(KindForbidden, "self_administration", "you cannot change the role of or delete your own account")
+)
+
+// UserQuery selects and pages the users returned by a listing, ordered by
+// username. Zero values mean "no constraint".
+type UserQuery struct {
+	Role   string
+	Status AccountState // users stored before statuses existed match by their legacy flag
+	Limit  int
+	Cursor string // opaque, taken from UserPage.NextCursor
+}
+
+// Normalize validates q and fills in the default page size.
+func (q *UserQuery) Normalize() error {
+	switch q.Status {
+	case "", AccountActive, AccountDeactivated:
+	default:
+		return ErrInvalidAccountState
+	}
+
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultUserPageSize
+	case q.Limit < 0 || q.Limit > MaxUserPageSize:
+		return ErrInvalidUserLimit
+	}
+	return nil
+}
+
+// Matches reports whether user passes the filters of q.
+func (q UserQuery) Matches(user User) bool {
+	if q.Role != "" && user.Role != q.Role {
+		return false
+	}
+	return q.Status == "" || user.State() == q.Status
+}
+
+// State is the account state of the user, derived from the legacy flag for
+// users whose status was never set.
+func (u User) State() AccountState {
+	if u.Active() {
+		return AccountActive
+	}
+	return AccountDeactivated
+}
+
+// UserProfile is what administrators see of a user. It leaves out the
+// password hash and the second factor's secrets, which User holds and must
+// therefore never be serialized itself.
+type UserProfile struct {
+	ID               string       `json:"id"`
+	Username         string       `json:"username"`
+	Role             string       `json:"role"`
+	Status           AccountState `json:"status"`
+	StatusReason     string       `json:"status_reason,omitempty"`
+	StatusChangedAt  *time.Time   `json:"status_changed_at,omitempty"`
+	TwoFactorEnabled bool         `json:"two_factor_enabled"`
+}
+
+// Profile returns the administrators' view of u.
+func (u User) Profile() UserProfile {
+	profile := UserProfile{
+		ID:               u.ID.Hex(),
+		Username:         u.Username,
+		Role:             u.Role,
+		Status:           u.State(),
+		StatusReason:     u.Status.Reason,
+		TwoFactorEnabled: u.TwoFactor.Enabled,
+	}
+	if !u.Status.ChangedAt.IsZero() {
+		changedAt := u.Status.ChangedAt
+		profile.StatusChangedAt = &changedAt
+	}
+	return profile
+}
+
+// UserPage is one page of a user listing.
+type UserPage struct {
+	Users      []UserProfile `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Total      int64         `json:"total"` // users matching the filters across all pages
+}
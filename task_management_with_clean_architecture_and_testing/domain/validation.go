@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrInvalidFields is matched by every *ValidationError.
+var ErrInvalidFields = newError(KindValidation, "invalid_fields", "some fields are invalid")
+
+// FieldError says what is wrong with one field of a request, named as in
+// its JSON, so clients can show it next to the input.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// err is the sentinel of the broken rule, for rules that have one
+	err error
+}
+
+// ValidationError lists every field of a request that breaks a rule, so
+// they can all be fixed at once. It matches ErrInvalidFields, and the
+// sentinels of the rules that have one, like ErrInvalidPriority.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Field + " " + f.Message
+	}
+	return ErrInvalidFields.Error() + ": " + strings.Join(problems, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrInvalidFields}
+	for _, f := range e.Fields {
+		if f.err != nil {
+			errs = append(errs, f.err)
+		}
+	}
+	return errs
+}
+
+// rules are the custom rules of validate tags, with the message and the
+// sentinel error reported when a field breaks them.
+var rules = map[string]struct {
+	check   validator.Func
+	message string
+	err     *Error
+}{
+	// notblank refuses empty strings and strings of white space only
+	"notblank": {
+		check: func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		},
+		message: "is required",
+	},
+	// notpast refuses dates before today; the zero time means no date
+	"notpast": {
+		check: func(fl validator.FieldLevel) bool {
+			t, ok := fl.Field().Interface().(time.Time)
+			return ok && (t.IsZero() || !t.Before(time.Now().Truncate(24*time.Hour)))
+		},
+		message: "must not be in the past",
+	},
+	// status accepts the lifecycle states, legacy spellings included, or
+	// nothing
+	"status": {
+		check: func(fl validator.FieldLevel) bool {
+			if fl.Field().String() == "" {
+				return true
+			}
+			_, err := NormalizeStatus(fl.Field().String())
+			return err == nil
+		},
+		message: "must be one of pending, in_progress, blocked, done or archived",
+		err:     ErrUnknownStatus,
+	},
+	// priority accepts the priorities, or nothing for the default
+	"priority": {
+		check: func(fl validator.FieldLevel) bool {
+			_, err := ParsePriority(Priority(fl.Field().String()))
+			return err == nil
+		},
+		message: "must be one of low, normal, high or urgent",
+		err:     ErrInvalidPriority,
+	},
+}
+
+// RegisterRules teaches v the custom rules of the domain, and to name fields
+// as in their JSON. The domain validates with such a validator; request
+// binding should too, so both report the same fields.
+func RegisterRules(v *validator.Validate) {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	for tag, rule := range rules {
+		if err := v.RegisterValidation(tag, rule.check); err != nil {
+			panic(err)
+		}
+	}
+}
+
+var validate = func() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	RegisterRules(v)
+	return v
+}()
+
+// Validate checks s against the validate tags of its fields, leaving out
+// the fields named in except. Broken rules are reported together as a
+// *ValidationError.
+func Validate(s any, except ...string) error {
+	err := validate.StructExcept(s, except...)
+	if fields, ok := FieldErrors(err); ok {
+		return fields
+	}
+	return err
+}
+
+// FieldErrors turns the errors of a validator, such as the one requests are
+// bound with, into a *ValidationError. It reports false for other errors.
+func FieldErrors(err error) (*ValidationError, bool) {
+	var broken validator.ValidationErrors
+	if !errors.As(err, &broken) {
+		return nil, false
+	}
+	fields := make([]FieldError, len(broken))
+	for i, fe := range broken {
+		fields[i] = FieldError{Field: fe.Field(), Message: ruleMessage(fe)}
+		if rule, ok := rules[fe.Tag()]; ok && rule.err != nil {
+			fields[i].err = rule.err
+		}
+	}
+	return &ValidationError{Fields: fields}, true
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	if rule, ok := rules[fe.Tag()]; ok {
+		return rule.message
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	}
+	return "is invalid"
+}
@@ -1,116 +1,182 @@
 package infrastructures
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"context"
 	"strings"
+	"task_with_clean_arc_and_test/domain"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
-func init() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
+// AccessChecker reports whether tokens that verify may still be used: their
+// login session must not be logged out or revoked, and their user must not be
+// deactivated. It also checks API keys, returning the key and the current
+// role of its user.
+type AccessChecker interface {
+	SessionActive(ctx context.Context, id string) (bool, error)
+	UserActive(ctx context.Context, username string) (bool, error)
+	AuthenticateAPIKey(ctx context.Context, token string) (domain.APIKey, string, error)
+}
+
+// Authenticator accepts requests carrying an access token or an API key and
+// resolves the role of the caller into permissions. Roles are looked up on
+// every request, so editing a role's permissions applies to tokens that are
+// already issued, while a user's role itself changes with their next token.
+type Authenticator struct {
+	tokens *TokenService
+	access AccessChecker
+	roles  domain.RoleSet
+	// twoFactorRoles lists the roles whose permissions are only granted to
+	// tokens of logins confirmed with a second factor. Users holding them
+	// can still log in with their password alone, to enroll.
+	twoFactorRoles map[string]bool
 }
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// NewAuthenticator accepts tokens issued by tokens as long as access allows
+// them. roles grants their permissions, which for twoFactorRoles need a login
+// confirmed with a second factor.
+func NewAuthenticator(tokens *TokenService, access AccessChecker, roles domain.RoleSet, twoFactorRoles []string) *Authenticator {
+	required := make(map[string]bool, len(twoFactorRoles))
+	for _, role := range twoFactorRoles {
+		required[role] = true
+	}
+	return &Authenticator{tokens: tokens, access: access, roles: roles, twoFactorRoles: required}
+}
 
-func AuthMiddleware(requiredRole string) gin.HandlerFunc {
+// AuthUser accepts requests carrying a valid access token that access still
+// allows, or an API key in its place.
+func (a *Authenticator) AuthUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
 		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Authorization header missing!"})
-			c.Abort()
+			AbortWithProblem(c, domain.ErrMissingCredentials)
 			return
 		}
 
 		authParts := strings.Split(authHeader, " ")
-		fmt.Print(authParts)
 
 		if len(authParts) != 2 || strings.ToLower(authParts[0]) != "bearer" {
-			c.JSON(401, gin.H{"error": "Invalid authorization header"})
-			c.Abort()
+			AbortWithProblem(c, domain.ErrInvalidAuthHeader)
 			return
 		}
 
-		token, err := jwt.Parse(authParts[1], func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(401, gin.H{"error": "Invalid JWT"})
-			c.Abort()
+		if strings.HasPrefix(authParts[1], domain.APIKeyPrefix) {
+			a.authAPIKey(c, authParts[1])
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userRole := claims["role"].(string)
-			if userRole != requiredRole && requiredRole != "" {
-				c.JSON(403, gin.H{"error": "Forbidden for you"})
-				c.Abort()
-				return
-			}
-			c.Set("user", claims) // store data in the ctx to make it accessible for the other handlers
-		} else {
-			c.JSON(401, gin.H{"error": "Invalid JWT claims"})
-			c.Abort()
+		claims, err := a.tokens.parseToken(authParts[1])
+		if err != nil {
+			AbortWithProblem(c, domain.ErrInvalidAccessToken)
 			return
 		}
 
-		c.Next() // used to proceed the request further
-	}
-}
-
-func AuthUser() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-
-		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Authorization header missing!"})
-			c.Abort()
+		sessionID, _ := claims["sid"].(string)
+		username, _ := claims["username"].(string)
+		if sessionID == "" || username == "" || claims["typ"] != nil {
+			AbortWithProblem(c, domain.ErrInvalidAccessToken.Reword("Invalid JWT claims"))
 			return
 		}
 
-		authParts := strings.Split(authHeader, " ")
-		fmt.Print(authParts)
-
-		if len(authParts) != 2 || strings.ToLower(authParts[0]) != "bearer" {
-			c.JSON(401, gin.H{"error": "Invalid authorization header"})
-			c.Abort()
+		active, err := a.access.SessionActive(c.Request.Context(), sessionID)
+		if err != nil {
+			AbortWithProblem(c, err)
+			return
+		}
+		if !active {
+			AbortWithProblem(c, domain.ErrSessionEnded)
 			return
 		}
 
-		token, err := jwt.Parse(authParts[1], func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(401, gin.H{"error": "Invalid JWT"})
-			c.Abort()
+		active, err = a.access.UserActive(c.Request.Context(), username)
+		if err != nil {
+			AbortWithProblem(c, err)
+			return
+		}
+		if !active {
+			AbortWithProblem(c, domain.ErrAccountDeactivated)
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		a.accept(c, claims, nil)
+	}
+}
+
+// authAPIKey accepts the request if token is a valid API key. The key is
+// stored in c next to claims shaped like those of an access token, so the
+// handlers need not tell the two apart.
+func (a *Authenticator) authAPIKey(c *gin.Context, token string) {
+	key, role, err := a.access.AuthenticateAPIKey(c.Request.Context(), token)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
 
-			c.Set("user", claims) // store data in the ctx to make it accessible for the other handlers
-		} else {
-			c.JSON(401, gin.H{"error": "Invalid JWT claims"})
-			c.Abort()
+	a.accept(c, jwt.MapClaims{"username": key.Username, "role": role, "mfa": key.SecondFactor}, &key)
+}
+
+// accept stores the caller in c, for the handlers, and proceeds. A role that
+// requires two-factor authentication grants nothing to a token of a
+// password-only login. API keys only grant what their scopes allow.
+func (a *Authenticator) accept(c *gin.Context, claims jwt.MapClaims, key *domain.APIKey) {
+	username, _ := claims["username"].(string)
+	role, _ := claims["role"].(string)
+	actor := a.roles.Actor(username, role)
+	if a.twoFactorRoles[role] && claims["mfa"] != true {
+		actor.Permissions = nil
+		c.Set("missingSecondFactor", true)
+	}
+	if key != nil {
+		actor = actor.Restrict(key.Scopes)
+		c.Set("apiKey", *key)
+	}
+	c.Set("user", claims)
+	c.Set("actor", actor)
+	c.Next()
+}
+
+// RequireSession turns away requests authenticated with an API key. It
+// guards what keys must not do: manage the account, its second factor, and
+// other keys.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("apiKey"); ok {
+			AbortWithProblem(c, domain.ErrSessionRequired)
 			return
 		}
-		c.Next() // used to proceed the request further
+		c.Next()
 	}
 }
+
+// ActorFromContext returns the caller the auth middleware stored in c, with
+// the permissions their role currently grants.
+func ActorFromContext(c *gin.Context) domain.Actor {
+	value, _ := c.Get("actor")
+	actor, _ := value.(domain.Actor)
+	return actor
+}
+
+// missingSecondFactor reports whether the caller's role requires a second
+// factor the login did not provide.
+func missingSecondFactor(c *gin.Context) bool {
+	return c.GetBool("missingSecondFactor")
+}
+
+// SecondFactorFromContext reports whether the login behind the request was
+// confirmed with a two-factor code.
+func SecondFactorFromContext(c *gin.Context) bool {
+	value, _ := c.Get("user")
+	claims, _ := value.(jwt.MapClaims)
+	return claims["mfa"] == true
+}
+
+// SessionIDFromContext returns the session of the access token the auth
+// middleware accepted.
+func SessionIDFromContext(c *gin.Context) string {
+	value, _ := c.Get("user")
+	claims, _ := value.(jwt.MapClaims)
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
@@ -0,0 +1,65 @@
+package infrastructures
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWK is the public part of a signing key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 (RFC 8037)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is the document other services fetch to verify our tokens.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key of k.
+func (k SigningKey) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// JWKS returns the public keys of every key tokens are verified with,
+// including rotated ones whose tokens have not expired yet.
+func (s *KeySet) JWKS() JWKS {
+	keys := s.Keys()
+	set := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+// JWKSHandler serves the public keys of keys at /.well-known/jwks.json.
+func JWKSHandler(keys *KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// verifiers refetch after a rotation once this has passed
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, keys.JWKS())
+	}
+}
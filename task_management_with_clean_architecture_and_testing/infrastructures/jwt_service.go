@@ -1,15 +1,63 @@
 package infrastructures
 
 import (
+	"fmt"
+	"sync"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// DefaultPasswordHashCost is the bcrypt cost new passwords are hashed with
+// unless configured otherwise.
+const DefaultPasswordHashCost = 14
+
+// PasswordHasher hashes and checks passwords with bcrypt at a fixed cost.
+type PasswordHasher struct {
+	cost int
+
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewPasswordHasher hashes new passwords at cost. Stored hashes of another
+// cost keep working; see NeedsRehash.
+func NewPasswordHasher(cost int) (*PasswordHasher, error) {
+	if err := ValidatePasswordHashCost(cost); err != nil {
+		return nil, err
+	}
+	return &PasswordHasher{cost: cost}, nil
+}
+
+// ValidatePasswordHashCost checks that bcrypt accepts cost.
+func ValidatePasswordHashCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
 	return string(bytes), err
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err
+func (h *PasswordHasher) Check(password, hash string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// CheckUnknown takes as long as checking a real password, so unknown
+// usernames cannot be told apart by how long a login takes.
+func (h *PasswordHasher) CheckUnknown(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummyHash, _ = h.Hash("not the password of any user")
+	})
+	h.Check(password, h.dummyHash)
+}
+
+// NeedsRehash reports whether hash was made with another cost than the
+// configured one, so the password should be hashed again the next time it
+// is known, at login.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost != h.cost
 }
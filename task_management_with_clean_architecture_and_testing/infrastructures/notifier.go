@@ -0,0 +1,66 @@
+package infrastructures
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier delivers messages to users outside of the API, such as the token
+// of a password reset they requested.
+type Notifier interface {
+	SendPasswordReset(username, token string, expiresAt time.Time) error
+}
+
+type logNotifier struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogNotifier returns a Notifier that writes every message to out instead
+// of delivering it, for local use.
+func NewLogNotifier(out io.Writer) Notifier {
+	return &logNotifier{out: out}
+}
+
+func (n *logNotifier) SendPasswordReset(username, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return writePasswordReset(n.out, username, token, expiresAt)
+}
+
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier returns a Notifier that appends every message to the file
+// at path, creating it if needed. The file holds live reset tokens, so only
+// its owner may read it.
+func NewFileNotifier(path string) Notifier {
+	return &fileNotifier{path: path}
+}
+
+func (n *fileNotifier) SendPasswordReset(username, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// opened for each message, so the file can be rotated or removed
+	f, err := os.OpenFile(n.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writePasswordReset(f, username, token, expiresAt); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writePasswordReset(w io.Writer, username, token string, expiresAt time.Time) error {
+	_, err := fmt.Fprintf(w, "%s password reset for %s: token %s, valid until %s\n",
+		time.Now().Format(time.RFC3339), username, token, expiresAt.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,40 @@
+package infrastructures
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogNotifier(t *testing.T) {
+	var out bytes.Buffer
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, NewLogNotifier(&out).SendPasswordReset("bob", "secret-token", expiresAt))
+	assert.Contains(t, out.String(), "password reset for bob: token secret-token, valid until 2030-01-02T03:04:05Z")
+}
+
+func TestFileNotifierAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	notifier := NewFileNotifier(path)
+
+	require.NoError(t, notifier.SendPasswordReset("bob", "first", time.Now()))
+	require.NoError(t, notifier.SendPasswordReset("alice", "second", time.Now()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "token first")
+	assert.Contains(t, lines[1], "token second")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
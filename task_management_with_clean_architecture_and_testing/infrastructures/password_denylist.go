@@ -0,0 +1,33 @@
+package infrastructures
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"task_with_clean_arc_and_test/domain"
+)
+
+// LoadPasswordDenylist reads the passwords a domain.PasswordPolicy refuses
+// from a text file with one password per line, such as a list of common or
+// breached passwords. Empty lines and lines starting with # are skipped.
+func LoadPasswordDenylist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	denylist := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		denylist[domain.NormalizeDenied(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return denylist, nil
+}
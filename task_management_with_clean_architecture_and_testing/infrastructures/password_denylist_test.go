@@ -0,0 +1,49 @@
+package infrastructures
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoadPasswordDenylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# common passwords\nPassword1\n\n  qwertyuiop  \n"), 0600))
+
+	denylist, err := LoadPasswordDenylist(path)
+	require.NoError(t, err)
+	assert.Len(t, denylist, 2)
+
+	policy := domain.DefaultPasswordPolicy()
+	policy.Denylist = denylist
+	assert.ErrorIs(t, policy.Check("bob", "PASSWORD1"), domain.ErrWeakPassword)
+	assert.ErrorIs(t, policy.Check("bob", "qwertyuiop"), domain.ErrWeakPassword)
+	assert.NoError(t, policy.Check("bob", "# common passwords"))
+
+	_, err = LoadPasswordDenylist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	hasher, err := NewPasswordHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	stronger, err := NewPasswordHasher(bcrypt.MinCost + 1)
+	require.NoError(t, err)
+	assert.True(t, stronger.NeedsRehash(hash))
+	assert.NoError(t, stronger.Check("password", hash))
+	assert.False(t, stronger.NeedsRehash("not a bcrypt hash"))
+
+	_, err = NewPasswordHasher(bcrypt.MaxCost + 1)
+	assert.Error(t, err)
+}
@@ -1,26 +1,129 @@
 package infrastructures
 
 import (
+	"errors"
 	"task_with_clean_arc_and_test/domain"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	AccessTokenTTL  = time.Hour
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// ChallengeTokenTTL is how long a user has to enter their two-factor code
+// after the password was accepted.
+const ChallengeTokenTTL = 5 * time.Minute
+
+// refreshTokenType and challengeTokenType mark tokens that cannot be used as
+// access tokens.
+const (
+	refreshTokenType   = "refresh"
+	challengeTokenType = "2fa"
+)
+
+// TokenService issues and verifies the tokens of this server, signed with
+// its keys.
+type TokenService struct {
+	keys *KeySet
+}
+
+// NewTokenService signs tokens with the current key of keys and accepts
+// tokens of every key in it.
+func NewTokenService(keys *KeySet) *TokenService {
+	return &TokenService{keys: keys}
+}
+
+// Keys returns the signing keys, for rotation and the JWKS.
+func (t *TokenService) Keys() *KeySet {
+	return t.keys
+}
+
 type Claims struct {
 	Username string `json:"username"`
 	Role     string `json:"role"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(existingUser domain.User) (string, error) {
+// GenerateToken issues an access token for existingUser within session. The
+// mfa claim says whether the login was confirmed with a second factor.
+func (t *TokenService) GenerateToken(existingUser domain.User, session domain.Session) (string, error) {
 	claims := jwt.MapClaims{
 		"id":       existingUser.ID,
 		"username": existingUser.Username,
 		"role":     existingUser.Role,
-		"exp":      time.Now().Add(time.Hour * 1).Unix(),
+		"sid":      session.ID,
+		"mfa":      session.SecondFactor,
+		"exp":      time.Now().Add(AccessTokenTTL).Unix(),
+	}
+
+	return t.keys.sign(claims)
+}
+
+// GenerateRefreshToken issues the refresh token for the current generation
+// of session. It expires with the session.
+func (t *TokenService) GenerateRefreshToken(session domain.Session) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":      refreshTokenType,
+		"sid":      session.ID,
+		"gen":      session.Generation,
+		"username": session.Username,
+		"exp":      session.ExpiresAt.Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return t.keys.sign(claims)
+}
+
+// ParseRefreshToken verifies a refresh token and returns the session and
+// generation it was issued for.
+func (t *TokenService) ParseRefreshToken(tokenString string) (sessionID string, generation int, err error) {
+	claims, err := t.parseToken(tokenString)
+	if err != nil || claims["typ"] != refreshTokenType {
+		return "", 0, domain.ErrInvalidRefreshToken
+	}
+	sessionID, _ = claims["sid"].(string)
+	gen, ok := claims["gen"].(float64)
+	if sessionID == "" || !ok {
+		return "", 0, domain.ErrInvalidRefreshToken
+	}
+	return sessionID, int(gen), nil
+}
+
+// GenerateChallengeToken proves, for ChallengeTokenTTL, that username gave
+// the right password and only has to enter a two-factor code.
+func (t *TokenService) GenerateChallengeToken(username string) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":      challengeTokenType,
+		"username": username,
+		"exp":      time.Now().Add(ChallengeTokenTTL).Unix(),
+	}
+	return t.keys.sign(claims)
+}
+
+// ParseChallengeToken verifies a challenge token and returns its user.
+func (t *TokenService) ParseChallengeToken(tokenString string) (string, error) {
+	claims, err := t.parseToken(tokenString)
+	if err != nil || claims["typ"] != challengeTokenType {
+		return "", domain.ErrInvalidChallenge
+	}
+	username, _ := claims["username"].(string)
+	if username == "" {
+		return "", domain.ErrInvalidChallenge
+	}
+	return username, nil
+}
+
+// parseToken verifies the signature and expiry of a token issued by this server.
+func (t *TokenService) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, t.keys.verificationKey)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
 }
@@ -0,0 +1,101 @@
+package infrastructures
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the body of every error response, an RFC 7807 problem detail.
+// Code is the stable code of the domain error, for programs; Detail is the
+// message, for people.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Problems lists every rule a password breaks, for weak_password.
+	Problems []string `json:"problems,omitempty"`
+	// Errors lists every field that breaks a rule, for invalid_fields.
+	Errors []domain.FieldError `json:"errors,omitempty"`
+}
+
+// kindStatus is the response status of every kind of domain error.
+var kindStatus = map[domain.Kind]int{
+	domain.KindValidation:           http.StatusBadRequest,
+	domain.KindUnauthenticated:      http.StatusUnauthorized,
+	domain.KindForbidden:            http.StatusForbidden,
+	domain.KindNotFound:             http.StatusNotFound,
+	domain.KindConflict:             http.StatusConflict,
+	domain.KindRateLimited:          http.StatusTooManyRequests,
+	domain.KindTimeout:              http.StatusGatewayTimeout,
+	domain.KindUnsupported:          http.StatusUnsupportedMediaType,
+	domain.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	domain.KindPreconditionRequired: http.StatusPreconditionRequired,
+}
+
+// AbortWithProblem ends the request with the problem err describes. Domain
+// errors answer the status of their kind. Any other error answers 500 with
+// a generic message and is attached to c for the logs, unless the client
+// went away, which answers 503.
+func AbortWithProblem(c *gin.Context, err error) {
+	problem := newProblem(c, err)
+	var throttled *domain.ThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	}
+	if problem.Status == http.StatusInternalServerError {
+		_ = c.Error(err)
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+func newProblem(c *gin.Context, err error) Problem {
+	problem := Problem{
+		Type:     "about:blank",
+		Status:   http.StatusInternalServerError,
+		Detail:   "the server could not complete the request",
+		Instance: c.Request.URL.Path,
+		Code:     "internal",
+	}
+
+	var domainErr *domain.Error
+	switch {
+	case errors.As(err, &domainErr) && kindStatus[domainErr.Kind] != 0:
+		problem.Status = kindStatus[domainErr.Kind]
+		problem.Code = domainErr.Code
+		problem.Detail = err.Error()
+		if domainErr.Kind == domain.KindTimeout {
+			// the cause says which storage call ran out of time, which is
+			// of no use to clients
+			problem.Detail = domainErr.Message
+		}
+	case c.Request.Context().Err() != nil:
+		problem.Status = http.StatusServiceUnavailable
+		problem.Code = "request_canceled"
+		problem.Detail = "request canceled"
+	}
+
+	var weak *domain.PasswordPolicyError
+	if errors.As(err, &weak) {
+		problem.Detail = domain.ErrWeakPassword.Error()
+		problem.Problems = weak.Problems
+	}
+	var invalid *domain.ValidationError
+	if errors.As(err, &invalid) {
+		problem.Detail = domain.ErrInvalidFields.Error()
+		problem.Errors = invalid.Fields
+	}
+	problem.Title = http.StatusText(problem.Status)
+	return problem
+}
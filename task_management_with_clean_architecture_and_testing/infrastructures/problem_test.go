@@ -0,0 +1,63 @@
+package infrastructures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbortWithProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	answer := func(ctx context.Context, err error) (*httptest.ResponseRecorder, *gin.Context, Problem) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/tasks/7", nil).WithContext(ctx)
+		AbortWithProblem(c, err)
+
+		assert.True(t, c.IsAborted())
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		var problem Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, w.Code, problem.Status)
+		assert.Equal(t, "/tasks/7", problem.Instance)
+		return w, c, problem
+	}
+	ctx := context.Background()
+
+	w, _, problem := answer(ctx, domain.ErrStatusChanged)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, Problem{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict, Detail: domain.ErrStatusChanged.Error(), Instance: "/tasks/7", Code: "status_changed"}, problem)
+
+	w, _, problem = answer(ctx, &domain.ThrottledError{RetryAfter: 1500 * time.Millisecond})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "too_many_attempts", problem.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w, _, problem = answer(ctx, fmt.Errorf("%w: %w", domain.ErrTimeout, context.DeadlineExceeded))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, domain.ErrTimeout.Error(), problem.Detail, "the cause stays in the server")
+
+	// anything else is hidden from the client, and kept for the logs
+	w, c, problem := answer(ctx, errors.New("connection reset by peer"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "internal", problem.Code)
+	assert.NotContains(t, problem.Detail, "connection reset")
+	assert.Len(t, c.Errors, 1)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	w, _, problem = answer(canceled, context.Canceled)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "request_canceled", problem.Code)
+}
@@ -0,0 +1,54 @@
+package infrastructures
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadRoles reads role definitions from a JSON file mapping every role name
+// to the permissions it grants, for example
+//
+//	{"user": ["tasks:read", "tasks:write"], "auditor": ["tasks:read", "tasks:manage"], ...}
+func LoadRoles(path string) (domain.RoleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r domain.RoleSet
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// RequirePermission lets the request through only if the role of the caller
+// grants every one of perms. It runs after AuthUser, which stores the caller.
+func RequirePermission(perms ...domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("user"); !ok {
+			AbortWithProblem(c, domain.ErrMissingCredentials)
+			return
+		}
+
+		actor := ActorFromContext(c)
+		for _, p := range perms {
+			if actor.Can(p) {
+				continue
+			}
+			if missingSecondFactor(c) {
+				AbortWithProblem(c, domain.ErrSecondFactorRequired)
+			} else {
+				AbortWithProblem(c, domain.ErrPermissionDenied)
+			}
+			return
+		}
+		c.Next()
+	}
+}
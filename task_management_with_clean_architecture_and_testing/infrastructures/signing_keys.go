@@ -0,0 +1,285 @@
+package infrastructures
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrUnknownKey        = errors.New("token was signed with an unknown key")
+	ErrRetireCurrentKey  = errors.New("the current signing key cannot be retired")
+	ErrVerificationOnly  = errors.New("key has no private part and cannot sign")
+	errUnsupportedKey    = errors.New("unsupported key type, use RSA or Ed25519")
+	errUnsupportedMethod = errors.New("unsupported signing algorithm, use RS256 or EdDSA")
+)
+
+// SigningKey is one key tokens are signed or verified with. ID is sent as
+// the kid header of every token the key signs.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	signer crypto.Signer // nil for keys that only verify
+	public crypto.PublicKey
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key.
+func NewSigningKey(id string, private crypto.Signer) (SigningKey, error) {
+	key, err := NewVerificationKey(id, private.Public())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	key.signer = private
+	return key, nil
+}
+
+// NewVerificationKey wraps a public key of a retired signing key, so tokens
+// it signed keep verifying until they expire.
+func NewVerificationKey(id string, public crypto.PublicKey) (SigningKey, error) {
+	if id == "" {
+		return SigningKey{}, errors.New("signing key needs an id")
+	}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodRS256, public: public}, nil
+	case ed25519.PublicKey:
+		return SigningKey{ID: id, Method: SigningMethodEdDSA, public: public}, nil
+	}
+	return SigningKey{}, errUnsupportedKey
+}
+
+// GenerateSigningKey creates a fresh key for alg, "RS256" or "EdDSA", with a
+// random id. Keys generated at startup are meant for development: tokens
+// stop verifying when the server restarts.
+func GenerateSigningKey(alg string) (SigningKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return SigningKey{}, err
+	}
+
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return SigningKey{}, errUnsupportedMethod
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return NewSigningKey(hex.EncodeToString(id), private)
+}
+
+// CanSign reports whether the key holds a private key.
+func (k SigningKey) CanSign() bool {
+	return k.signer != nil
+}
+
+// KeySet holds the key new tokens are signed with and every key whose tokens
+// are still accepted. Rotating keeps the previous key for verification, so
+// tokens issued before the rotation stay valid until they expire.
+type KeySet struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]SigningKey
+}
+
+// NewKeySet signs with current and also verifies tokens of others.
+func NewKeySet(current SigningKey, others ...SigningKey) (*KeySet, error) {
+	if !current.CanSign() {
+		return nil, ErrVerificationOnly
+	}
+	s := &KeySet{current: current.ID, keys: map[string]SigningKey{current.ID: current}}
+	for _, key := range others {
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// GenerateKeySet returns a key set holding one fresh key for alg. Like the
+// key, it suits development and tests only.
+func GenerateKeySet(alg string) (*KeySet, error) {
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(key)
+}
+
+// Rotate makes next the signing key. The previous key keeps verifying until
+// it is retired.
+func (s *KeySet) Rotate(next SigningKey) error {
+	if !next.CanSign() {
+		return ErrVerificationOnly
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[next.ID]; ok && next.ID != s.current {
+		return fmt.Errorf("duplicate signing key id %q", next.ID)
+	}
+	s.keys[next.ID] = next
+	s.current = next.ID
+	return nil
+}
+
+// Retire stops accepting tokens signed with the key id. Retire a key once
+// the longest-lived token it signed, a refresh token, has expired.
+func (s *KeySet) Retire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == s.current {
+		return ErrRetireCurrentKey
+	}
+	if _, ok := s.keys[id]; !ok {
+		return ErrUnknownKey
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// Current returns the key new tokens are signed with.
+func (s *KeySet) Current() SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keys[s.current]
+}
+
+// Keys returns every key tokens are verified with, ordered by id.
+func (s *KeySet) Keys() []SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// sign issues a token carrying claims, signed with the current key.
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := s.Current()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// verificationKey is the jwt.Keyfunc for tokens of s. The algorithm must be
+// the one of the key the kid names, so a token cannot pick a weaker one.
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// LoadKeyDir reads every *.pem file in dir; the file name without the
+// extension is the key id. Files may hold a private key (PKCS#8, or PKCS#1
+// for RSA) or, for retired keys, just the public key (PKIX). The key named
+// current signs new tokens; when current is empty the private key with the
+// greatest id does, so date-named files such as 2024-06-01.pem rotate in
+// simply by being added.
+func LoadKeyDir(dir, current string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []SigningKey
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readPEMKey(id, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	// paths are sorted, so the last private key has the greatest id
+	signer := -1
+	for i, key := range keys {
+		if (current == "" && key.CanSign()) || key.ID == current {
+			signer = i
+		}
+	}
+	if signer < 0 {
+		if current != "" {
+			return nil, fmt.Errorf("signing key %q not found in %s", current, dir)
+		}
+		return nil, fmt.Errorf("no private key found in %s", dir)
+	}
+	var others []SigningKey
+	for i, key := range keys {
+		if i != signer {
+			others = append(others, key)
+		}
+	}
+	return NewKeySet(keys[signer], others...)
+}
+
+func readPEMKey(id, path string) (SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return SigningKey{}, errUnsupportedKey
+		}
+		return NewSigningKey(id, signer)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		return NewSigningKey(id, private)
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		return NewVerificationKey(id, public)
+	}
+	return SigningKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
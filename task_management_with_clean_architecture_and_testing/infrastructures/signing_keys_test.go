@@ -0,0 +1,185 @@
+package infrastructures
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/suite"
+)
+
+type SigningKeysTestSuite struct {
+	suite.Suite
+	tokens *TokenService
+}
+
+func (suite *SigningKeysTestSuite) generate(alg string) SigningKey {
+	key, err := GenerateSigningKey(alg)
+	suite.Require().NoError(err)
+	return key
+}
+
+func (suite *SigningKeysTestSuite) refreshToken() string {
+	token, err := suite.tokens.GenerateRefreshToken(domain.Session{ID: "s1", Username: "bob", Generation: 2, ExpiresAt: time.Now().Add(time.Hour)})
+	suite.Require().NoError(err)
+	return token
+}
+
+func (suite *SigningKeysTestSuite) TestSignAndVerify() {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		key := suite.generate(alg)
+		keys, err := NewKeySet(key)
+		suite.Require().NoError(err)
+		suite.tokens = NewTokenService(keys)
+
+		token := suite.refreshToken()
+		parsed, _ := jwt.Parse(token, nil)
+		suite.Equal(alg, parsed.Header["alg"])
+		suite.Equal(key.ID, parsed.Header["kid"])
+
+		sessionID, generation, err := suite.tokens.ParseRefreshToken(token)
+		suite.NoError(err, alg)
+		suite.Equal("s1", sessionID)
+		suite.Equal(2, generation)
+	}
+}
+
+func (suite *SigningKeysTestSuite) TestRotationKeepsOldTokensValid() {
+	old := suite.generate("EdDSA")
+	keys, err := NewKeySet(old)
+	suite.Require().NoError(err)
+	suite.tokens = NewTokenService(keys)
+	before := suite.refreshToken()
+
+	next := suite.generate("RS256")
+	suite.Require().NoError(keys.Rotate(next))
+	after := suite.refreshToken()
+	parsed, _ := jwt.Parse(after, nil)
+	suite.Equal(next.ID, parsed.Header["kid"])
+
+	_, _, err = suite.tokens.ParseRefreshToken(before)
+	suite.NoError(err)
+	_, _, err = suite.tokens.ParseRefreshToken(after)
+	suite.NoError(err)
+
+	suite.ErrorIs(keys.Retire(next.ID), ErrRetireCurrentKey)
+	suite.Require().NoError(keys.Retire(old.ID))
+	_, _, err = suite.tokens.ParseRefreshToken(before)
+	suite.ErrorIs(err, domain.ErrInvalidRefreshToken)
+	_, _, err = suite.tokens.ParseRefreshToken(after)
+	suite.NoError(err)
+}
+
+func (suite *SigningKeysTestSuite) TestRejectsForeignAndConfusedTokens() {
+	key := suite.generate("RS256")
+	keys, err := NewKeySet(key)
+	suite.Require().NoError(err)
+	suite.tokens = NewTokenService(keys)
+	claims := jwt.MapClaims{"typ": refreshTokenType, "sid": "s1", "gen": 0, "exp": time.Now().Add(time.Hour).Unix()}
+
+	// HS256 keyed with the public key, which anybody can fetch
+	public, err := x509.MarshalPKIXPublicKey(key.public)
+	suite.Require().NoError(err)
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = key.ID
+	token, err := confused.SignedString(public)
+	suite.Require().NoError(err)
+	_, _, err = suite.tokens.ParseRefreshToken(token)
+	suite.ErrorIs(err, domain.ErrInvalidRefreshToken)
+
+	// same kid, somebody else's key
+	foreign := suite.generate("RS256")
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	forged.Header["kid"] = key.ID
+	token, err = forged.SignedString(foreign.signer)
+	suite.Require().NoError(err)
+	_, _, err = suite.tokens.ParseRefreshToken(token)
+	suite.ErrorIs(err, domain.ErrInvalidRefreshToken)
+}
+
+func (suite *SigningKeysTestSuite) writePEM(dir, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+func (suite *SigningKeysTestSuite) TestLoadKeyDir() {
+	dir := suite.T().TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	suite.Require().NoError(err)
+	suite.writePEM(dir, "2024-01-01.pem", "PRIVATE KEY", der)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	suite.Require().NoError(err)
+	suite.writePEM(dir, "2024-06-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	retired, err := rsa.GenerateKey(rand.Reader, 2048)
+	suite.Require().NoError(err)
+	der, err = x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	suite.Require().NoError(err)
+	suite.writePEM(dir, "2023-01-01.pem", "PUBLIC KEY", der)
+
+	keys, err := LoadKeyDir(dir, "")
+	suite.Require().NoError(err)
+	suite.Equal("2024-06-01", keys.Current().ID)
+	suite.Equal("RS256", keys.Current().Method.Alg())
+	suite.Len(keys.Keys(), 3)
+
+	keys, err = LoadKeyDir(dir, "2024-01-01")
+	suite.Require().NoError(err)
+	suite.Equal("EdDSA", keys.Current().Method.Alg())
+
+	_, err = LoadKeyDir(dir, "2023-01-01")
+	suite.ErrorIs(err, ErrVerificationOnly)
+	_, err = LoadKeyDir(dir, "2025-01-01")
+	suite.Error(err)
+	_, err = LoadKeyDir(suite.T().TempDir(), "")
+	suite.Error(err)
+}
+
+func (suite *SigningKeysTestSuite) TestJWKS() {
+	rsaKey := suite.generate("RS256")
+	edKey := suite.generate("EdDSA")
+	keys, err := NewKeySet(rsaKey, edKey)
+	suite.Require().NoError(err)
+	suite.tokens = NewTokenService(keys)
+	token := suite.refreshToken()
+
+	set := keys.JWKS()
+	suite.Require().Len(set.Keys, 2)
+	for _, jwk := range set.Keys {
+		suite.Equal("sig", jwk.Use)
+		switch jwk.KeyID {
+		case edKey.ID:
+			suite.Equal(JWK{KeyType: "OKP", KeyID: edKey.ID, Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519",
+				X: base64.RawURLEncoding.EncodeToString(edKey.public.(ed25519.PublicKey))}, jwk)
+		case rsaKey.ID:
+			// a verifier holding only the JWK accepts our tokens
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			suite.Require().NoError(err)
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			suite.Require().NoError(err)
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return public, nil })
+			suite.NoError(err)
+		default:
+			suite.Failf("unexpected key", "kid %q", jwk.KeyID)
+		}
+	}
+}
+
+func TestSigningKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(SigningKeysTestSuite))
+}
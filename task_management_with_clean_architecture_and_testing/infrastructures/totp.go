@@ -0,0 +1,133 @@
+package infrastructures
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). Authenticator apps assume exactly these when
+// the otpauth URI does not say otherwise.
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpModulo = 1000000 // 10^totpDigits
+	// totpSkew is how many periods a code may be early or late, for clocks
+	// that drift and codes typed at the end of their period.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160-bit secret, base32 encoded as
+// authenticator apps expect it.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI that authenticator apps scan as a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code for secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, totpStep(t)), nil
+}
+
+// ValidateTOTP checks code against secret around now. It returns the time
+// step the code belongs to, which must be greater than the step of the last
+// code accepted, so that a code cannot be used twice.
+func ValidateTOTP(secret, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCode is HOTP (RFC 4226) of key at counter step.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// recoveryCodeBytes gives recovery codes 80 random bits, too many to guess
+// or to search for offline from a leaked hash.
+const recoveryCodeBytes = 10
+
+// GenerateRecoveryCode returns a random single-use code such as
+// "k3v9-q2xm-7hfa-m4tc", for users who lost their authenticator.
+func GenerateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return groupRecoveryCode(strings.ToLower(totpEncoding.EncodeToString(b))), nil
+}
+
+// groupRecoveryCode splits code into dash-separated groups of four.
+func groupRecoveryCode(code string) string {
+	groups := make([]string, 0, len(code)/4+1)
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+// HashRecoveryCode hashes a recovery code for storage. With 80 random bits
+// the codes are random enough that a fast hash suffices, unlike passwords.
+// Case, spaces and dashes do not matter, so codes may be typed without their
+// grouping; the code is grouped again before hashing, which keeps the hashes
+// of codes stored before that the same.
+func HashRecoveryCode(code string) string {
+	bare := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(groupRecoveryCode(bare)))
+	return hex.EncodeToString(sum[:])
+}
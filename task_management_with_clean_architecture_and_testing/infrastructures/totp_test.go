@@ -0,0 +1,93 @@
+package infrastructures
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// the RFC lists 8-digit codes; ours are their last 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "at %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, now, 0)
+	require.True(t, ok)
+	// one period of clock drift either way is tolerated, two are not
+	_, ok = ValidateTOTP(rfc6238Secret, code, now.Add(totpPeriod), 0)
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(rfc6238Secret, code, now.Add(-totpPeriod), 0)
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(rfc6238Secret, code, now.Add(2*totpPeriod), 0)
+	assert.False(t, ok)
+
+	// a code is accepted once
+	_, ok = ValidateTOTP(rfc6238Secret, code, now, step)
+	assert.False(t, ok)
+	next, err := TOTPCode(rfc6238Secret, now.Add(totpPeriod))
+	require.NoError(t, err)
+	_, ok = ValidateTOTP(rfc6238Secret, next, now, step)
+	assert.True(t, ok)
+
+	_, ok = ValidateTOTP(rfc6238Secret, "12345", now, 0)
+	assert.False(t, ok)
+	_, ok = ValidateTOTP("not base32!", code, now, 0)
+	assert.False(t, ok)
+}
+
+func TestGenerateTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+	other, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+
+	uri, err := url.Parse(TOTPURI("Task Manager", "bob", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Task Manager:bob", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Task Manager", uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`, code)
+
+	assert.Equal(t, HashRecoveryCode(code), HashRecoveryCode(" "+code+" "))
+	assert.Equal(t, HashRecoveryCode(code), HashRecoveryCode(strings.ReplaceAll(code, "-", "")))
+	assert.Equal(t, HashRecoveryCode(code), HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))))
+	// hashes stored before dashes were ignored hashed the code as shown
+	sum := sha256.Sum256([]byte(code))
+	assert.Equal(t, hex.EncodeToString(sum[:]), HashRecoveryCode(code))
+	other, err := GenerateRecoveryCode()
+	require.NoError(t, err)
+	assert.NotEqual(t, HashRecoveryCode(code), HashRecoveryCode(other))
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyRepository stores API keys, which the auth middleware looks up by
+// the hash of the key on every request made with one.
+type APIKeyRepository interface {
+	Create(ctx context.Context, key domain.APIKey) error
+	// GetByHash returns ErrAPIKeyNotFound if no key has keyHash.
+	GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error)
+	// ListUser returns the keys of username, oldest first.
+	ListUser(ctx context.Context, username string) ([]domain.APIKey, error)
+	// Touch records that the key with keyHash was used at usedAt; touching
+	// a deleted key is not an error.
+	Touch(ctx context.Context, keyHash string, usedAt time.Time) error
+	// Delete removes the key id of username. It returns ErrAPIKeyNotFound if
+	// username has no such key, so nobody can delete the keys of others.
+	Delete(ctx context.Context, username, id string) error
+	// DeleteUser removes every key of username.
+	DeleteUser(ctx context.Context, username string) error
+}
+
+type apiKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(db *mongo.Database) APIKeyRepository {
+	return &apiKeyRepository{
+		collection: db.Collection("api_keys"),
+	}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key domain.APIKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.collection.FindOne(ctx, bson.D{{Key: "keyhash", Value: keyHash}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return domain.APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (r *apiKeyRepository) ListUser(ctx context.Context, username string) ([]domain.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.D{{Key: "username", Value: username}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []domain.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, keyHash string, usedAt time.Time) error {
+	update := bson.D{{Key: "$set", Value: bson.M{"lastusedat": usedAt}}}
+	_, err := r.collection.UpdateOne(ctx, bson.D{{Key: "keyhash", Value: keyHash}}, update)
+	return err
+}
+
+func (r *apiKeyRepository) Delete(ctx context.Context, username, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.D{{Key: "id", Value: id}, {Key: "username", Value: username}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) DeleteUser(ctx context.Context, username string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	return err
+}
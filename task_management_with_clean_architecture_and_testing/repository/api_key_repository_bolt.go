@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltAPIKeyRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltAPIKeyRepository returns an APIKeyRepository that persists keys as
+// JSON in the api_keys bucket of db, keyed by key hash.
+func NewBoltAPIKeyRepository(db *bolt.DB) APIKeyRepository {
+	return &boltAPIKeyRepository{db: db}
+}
+
+func (r *boltAPIKeyRepository) Create(ctx context.Context, key domain.APIKey) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(apiKeysBucket), key.KeyHash, key)
+	})
+}
+
+func (r *boltAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(apiKeysBucket).Get([]byte(keyHash))
+		if data == nil {
+			return ErrAPIKeyNotFound
+		}
+		return json.Unmarshal(data, &key)
+	})
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (r *boltAPIKeyRepository) ListUser(ctx context.Context, username string) ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		keys, err = userAPIKeys(tx.Bucket(apiKeysBucket), username)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+func (r *boltAPIKeyRepository) Touch(ctx context.Context, keyHash string, usedAt time.Time) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		data := bucket.Get([]byte(keyHash))
+		if data == nil {
+			return nil
+		}
+		var key domain.APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		key.LastUsedAt = &usedAt
+		return putJSON(bucket, keyHash, key)
+	})
+}
+
+func (r *boltAPIKeyRepository) Delete(ctx context.Context, username, id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		keys, err := userAPIKeys(bucket, username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.ID == id {
+				return bucket.Delete([]byte(key.KeyHash))
+			}
+		}
+		return ErrAPIKeyNotFound
+	})
+}
+
+func (r *boltAPIKeyRepository) DeleteUser(ctx context.Context, username string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		keys, err := userAPIKeys(bucket, username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key.KeyHash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// userAPIKeys reads the keys of username. Callers delete only after it
+// returns, since the bucket must not change while ForEach walks it.
+func userAPIKeys(bucket *bolt.Bucket, username string) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	err := bucket.ForEach(func(k, v []byte) error {
+		var key domain.APIKey
+		if err := json.Unmarshal(v, &key); err != nil {
+			return err
+		}
+		if key.Username == username {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+type inMemoryAPIKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[string]domain.APIKey // keyed by key hash
+}
+
+// NewInMemoryAPIKeyRepository returns an APIKeyRepository that keeps keys in
+// process memory, so they stop working when the server stops.
+func NewInMemoryAPIKeyRepository() APIKeyRepository {
+	return &inMemoryAPIKeyRepository{
+		keys: make(map[string]domain.APIKey),
+	}
+}
+
+func (r *inMemoryAPIKeyRepository) Create(ctx context.Context, key domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys[key.KeyHash] = key
+	return nil
+}
+
+func (r *inMemoryAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[keyHash]
+	if !ok {
+		return domain.APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *inMemoryAPIKeyRepository) ListUser(ctx context.Context, username string) ([]domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []domain.APIKey{}
+	for _, key := range r.keys {
+		if key.Username == username {
+			keys = append(keys, key)
+		}
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+func (r *inMemoryAPIKeyRepository) Touch(ctx context.Context, keyHash string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[keyHash]; ok {
+		key.LastUsedAt = &usedAt
+		r.keys[keyHash] = key
+	}
+	return nil
+}
+
+func (r *inMemoryAPIKeyRepository) Delete(ctx context.Context, username, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, key := range r.keys {
+		if key.ID == id && key.Username == username {
+			delete(r.keys, hash)
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (r *inMemoryAPIKeyRepository) DeleteUser(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, key := range r.keys {
+		if key.Username == username {
+			delete(r.keys, hash)
+		}
+	}
+	return nil
+}
+
+// sortAPIKeys orders keys oldest first, as ListUser returns them.
+func sortAPIKeys(keys []domain.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	tasksBucket          = []byte("tasks")
+	usersBucket          = []byte("users")
+	sessionsBucket       = []byte("sessions")
+	passwordResetsBucket = []byte("password_resets")
+	apiKeysBucket        = []byte("api_keys")
+)
+
+// OpenBoltDB opens (or creates) the single-file database used by the bolt
+// repositories and makes sure every bucket they need exists.
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{tasksBucket, usersBucket, sessionsBucket, passwordResetsBucket, apiKeysBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
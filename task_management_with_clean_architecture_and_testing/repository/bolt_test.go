@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltRepositoriesSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "task_manager.db")
+
+	db, err := OpenBoltDB(path)
+	require.NoError(t, err)
+	tasks := NewBoltTaskRepository(db, NewBoltSequence(db))
+	require.NoError(t, tasks.Add(ctx, domain.Task{Title: "Task 1", Description: "Description 1"}))
+	require.NoError(t, tasks.Add(ctx, domain.Task{Title: "Task 2", Description: "Description 2"}))
+	require.NoError(t, tasks.Trash(ctx, "2", 0, domain.Deletion{By: "testUser", At: time.Now()}))
+	_, err = tasks.Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, NewBoltUserRepository(db).Register(ctx, domain.User{Username: "testUser", Password: "hash"}))
+	require.NoError(t, db.Close())
+
+	db, err = OpenBoltDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	tasks = NewBoltTaskRepository(db, NewBoltSequence(db))
+	users := NewBoltUserRepository(db)
+
+	task, err := tasks.GetOne(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Task 1", task.Title)
+
+	// the sequence survives the restart, so a deleted ID is not handed out again
+	require.NoError(t, tasks.Add(ctx, domain.Task{Title: "Task 3", Description: "Description 3"}))
+	all, err := tasks.GetAll(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, all, 2) {
+		assert.Equal(t, "3", all[1].ID)
+	}
+
+	assert.ErrorIs(t, users.Register(ctx, domain.User{Username: "testUser"}), ErrUsernameExists)
+}
+
+func TestBoltPingerFailsOnceClosed(t *testing.T) {
+	db, err := OpenBoltDB(filepath.Join(t.TempDir(), "task_manager.db"))
+	require.NoError(t, err)
+	pinger := NewBoltPinger(db)
+
+	assert.NoError(t, pinger.Ping(context.Background()))
+	require.NoError(t, db.Close())
+	assert.Error(t, pinger.Ping(context.Background()))
+}
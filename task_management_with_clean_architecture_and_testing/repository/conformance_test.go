@@ -0,0 +1,1120 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backend describes one storage implementation. Every backend returned by
+// backends has to pass the conformance suites below.
+type backend struct {
+	name     string
+	tasks    func(t *testing.T) TaskRepository
+	users    func(t *testing.T) UserRepository
+	sessions func(t *testing.T) SessionRepository
+	resets   func(t *testing.T) PasswordResetRepository
+	apiKeys  func(t *testing.T) APIKeyRepository
+}
+
+func backends() []backend {
+	return []backend{
+		{
+			name:     "memory",
+			tasks:    func(*testing.T) TaskRepository { return NewInMemoryTaskRepository(NewInMemorySequence(0)) },
+			users:    func(*testing.T) UserRepository { return NewInMemoryUserRepository() },
+			sessions: func(*testing.T) SessionRepository { return NewInMemorySessionRepository() },
+			resets:   func(*testing.T) PasswordResetRepository { return NewInMemoryPasswordResetRepository() },
+			apiKeys:  func(*testing.T) APIKeyRepository { return NewInMemoryAPIKeyRepository() },
+		},
+		{
+			name: "bolt",
+			tasks: func(t *testing.T) TaskRepository {
+				db := openTestBolt(t)
+				return NewBoltTaskRepository(db, NewBoltSequence(db))
+			},
+			users:    func(t *testing.T) UserRepository { return NewBoltUserRepository(openTestBolt(t)) },
+			sessions: func(t *testing.T) SessionRepository { return NewBoltSessionRepository(openTestBolt(t)) },
+			resets:   func(t *testing.T) PasswordResetRepository { return NewBoltPasswordResetRepository(openTestBolt(t)) },
+			apiKeys:  func(t *testing.T) APIKeyRepository { return NewBoltAPIKeyRepository(openTestBolt(t)) },
+		},
+		{
+			name: "mongo",
+			tasks: func(t *testing.T) TaskRepository {
+				client := mongoTestClient(t)
+				clearCollection(t, client, "tasks")
+				clearCollection(t, client, countersCollection)
+				db := migratedMongo(t, client)
+				return NewTaskRepository(db, NewMongoSequence(db, TaskSequence))
+			},
+			users: func(t *testing.T) UserRepository {
+				client := mongoTestClient(t)
+				clearCollection(t, client, "users")
+				return NewUserRepository(migratedMongo(t, client))
+			},
+			sessions: func(t *testing.T) SessionRepository {
+				client := mongoTestClient(t)
+				clearCollection(t, client, "sessions")
+				return NewSessionRepository(migratedMongo(t, client))
+			},
+			resets: func(t *testing.T) PasswordResetRepository {
+				client := mongoTestClient(t)
+				clearCollection(t, client, "password_resets")
+				return NewPasswordResetRepository(migratedMongo(t, client))
+			},
+			apiKeys: func(t *testing.T) APIKeyRepository {
+				client := mongoTestClient(t)
+				clearCollection(t, client, "api_keys")
+				return NewAPIKeyRepository(migratedMongo(t, client))
+			},
+		},
+	}
+}
+
+func openTestBolt(t *testing.T) *bolt.DB {
+	db, err := OpenBoltDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// migratedMongo returns the test database once MigrateMongo prepared it.
+func migratedMongo(t *testing.T, client *mongo.Client) *mongo.Database {
+	db := client.Database("task_manager")
+	if err := MigrateMongo(context.TODO(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func clearCollection(t *testing.T, client *mongo.Client, name string) {
+	_, err := client.Database("task_manager").Collection(name).DeleteMany(context.TODO(), bson.D{{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type TaskRepositoryConformanceSuite struct {
+	suite.Suite
+	backend backend
+	repo    TaskRepository
+}
+
+func (suite *TaskRepositoryConformanceSuite) SetupTest() {
+	suite.repo = suite.backend.tasks(suite.T())
+}
+
+func (suite *TaskRepositoryConformanceSuite) addTask(title string) {
+	ctx := context.Background()
+	err := suite.repo.Add(ctx, domain.Task{Title: title, Description: "Description of " + title})
+	suite.Require().NoError(err)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestAddAssignsSequentialIDs() {
+	ctx := context.Background()
+	for i := 1; i <= 11; i++ {
+		suite.addTask("Task " + strconv.Itoa(i))
+	}
+
+	tasks, err := suite.repo.GetAll(ctx)
+	suite.NoError(err)
+	suite.Require().Len(tasks, 11)
+	for i, task := range tasks {
+		suite.Equal(strconv.Itoa(i+1), task.ID)
+	}
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestAdd_PersistsAllFields() {
+	ctx := context.Background()
+	// millisecond precision in UTC, which every backend round-trips exactly
+	due := time.Date(2030, 1, 2, 15, 4, 5, 6e6, time.UTC)
+	created := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	err := suite.repo.Add(ctx, domain.Task{
+		Title:       "Task 1",
+		Description: "Description 1",
+		DueDate:     due,
+		Status:      "Pending",
+		Priority:    domain.PriorityHigh,
+		Assignee:    "alice",
+		Owner:       "carol",
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	})
+	suite.Require().NoError(err)
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.Require().NoError(err)
+	suite.Equal("carol", result.Owner)
+	suite.True(due.Equal(result.DueDate))
+	suite.Equal("Pending", result.Status)
+	suite.Equal(domain.PriorityHigh, result.Priority)
+	suite.Equal("alice", result.Assignee)
+	suite.True(created.Equal(result.CreatedAt))
+	suite.True(created.Equal(result.UpdatedAt))
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestGetOne() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal("1", result.ID)
+	suite.Equal("Task 1", result.Title)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestGetOne_NotFound() {
+	ctx := context.Background()
+	result, err := suite.repo.GetOne(ctx, "13")
+	suite.ErrorIs(err, mongo.ErrNoDocuments)
+	suite.Equal(domain.Task{}, result)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestGetAll_Empty() {
+	ctx := context.Background()
+	result, err := suite.repo.GetAll(ctx)
+	suite.NoError(err)
+	suite.Equal(0, len(result))
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestUpdate() {
+	ctx := context.Background()
+	created := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	err := suite.repo.Add(ctx, domain.Task{Title: "Task 1", Description: "Description 1", Status: "Pending", Owner: "carol", CreatedAt: created})
+	suite.Require().NoError(err)
+
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 8, 2, 9, 0, 0, 0, time.UTC)
+	err = suite.repo.Update(ctx, "1", 0, domain.Task{
+		Title:       "Updated Title",
+		Description: "Updated Description",
+		DueDate:     due,
+		Status:      "Completed",
+		Priority:    domain.PriorityUrgent,
+		Assignee:    "bob",
+		Owner:       "mallory",
+		CreatedAt:   updated,
+		UpdatedAt:   updated,
+	})
+	suite.NoError(err)
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal("Updated Title", result.Title)
+	suite.Equal("Updated Description", result.Description)
+	suite.True(due.Equal(result.DueDate))
+	suite.Equal(domain.PriorityUrgent, result.Priority)
+	suite.Equal("bob", result.Assignee)
+	suite.True(updated.Equal(result.UpdatedAt))
+	suite.Equal(int64(1), result.Version)
+	// status, owner and creation time are not editable through Update
+	suite.Equal("Pending", result.Status)
+	suite.Equal("carol", result.Owner)
+	suite.True(created.Equal(result.CreatedAt))
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestUpdate_NotFound() {
+	ctx := context.Background()
+	err := suite.repo.Update(ctx, "12000", 0, domain.Task{Title: "Updated Title", Description: "Updated Description"})
+	suite.EqualError(err, "task with id 12000 not found")
+	suite.ErrorIs(err, ErrTaskNotFound)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestUpdate_VersionMismatch() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.repo.Add(ctx, domain.Task{Title: "Task 1", Description: "Description 1", Version: 3}))
+
+	err := suite.repo.Update(ctx, "1", 2, domain.Task{Title: "Updated Title", Description: "Updated Description"})
+	suite.ErrorIs(err, ErrVersionMismatch)
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal("Task 1", result.Title)
+	suite.Equal(int64(3), result.Version)
+}
+
+func (suite *TaskRepositoryConformanceSuite) trash(id string, version int64, at time.Time) {
+	suite.Require().NoError(suite.repo.Trash(context.Background(), id, version, domain.Deletion{By: "admin", At: at}))
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestTrash() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+	suite.addTask("Task 2")
+
+	suite.trash("1", 0, time.Now())
+
+	_, err := suite.repo.GetOne(ctx, "1")
+	suite.ErrorIs(err, mongo.ErrNoDocuments)
+	all, err := suite.repo.GetAll(ctx)
+	suite.NoError(err)
+	suite.Equal([]string{"2"}, taskIDs(all))
+	suite.Equal([]string{"2"}, taskIDs(suite.find(domain.TaskQuery{}).Tasks))
+
+	trash := suite.find(domain.TaskQuery{Trashed: true})
+	suite.Equal(int64(1), trash.Total)
+	suite.Require().Len(trash.Tasks, 1)
+	suite.Equal("Task 1", trash.Tasks[0].Title)
+	suite.Require().NotNil(trash.Tasks[0].Deleted)
+	suite.Equal("admin", trash.Tasks[0].Deleted.By)
+	suite.Equal(int64(1), trash.Tasks[0].Version)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestTrash_NotFound() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+	suite.trash("1", 0, time.Now())
+
+	deletion := domain.Deletion{By: "admin", At: time.Now()}
+	suite.ErrorIs(suite.repo.Trash(ctx, "12000", 0, deletion), ErrTaskNotFound)
+	suite.ErrorIs(suite.repo.Trash(ctx, "1", 1, deletion), ErrTaskNotFound, "already in the trash")
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestTrash_VersionMismatch() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+
+	suite.ErrorIs(suite.repo.Trash(ctx, "1", 1, domain.Deletion{By: "admin", At: time.Now()}), ErrVersionMismatch)
+
+	_, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestTrashedTasksCannotChange() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+	suite.trash("1", 0, time.Now())
+
+	suite.ErrorIs(suite.repo.Update(ctx, "1", 1, domain.Task{Title: "Changed", Description: "Changed"}), ErrTaskNotFound)
+	suite.ErrorIs(suite.repo.SetStatus(ctx, "1", "", domain.StatusDone, time.Now()), ErrTaskNotFound)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestRestore() {
+	ctx := context.Background()
+	suite.addTask("Task 1")
+	suite.trash("1", 0, time.Now())
+
+	updatedAt := time.Now().Truncate(time.Millisecond)
+	restored, err := suite.repo.Restore(ctx, "1", updatedAt)
+	suite.Require().NoError(err)
+	suite.Equal("Task 1", restored.Title)
+	suite.Nil(restored.Deleted)
+	suite.Equal(int64(2), restored.Version)
+	suite.True(updatedAt.Equal(restored.UpdatedAt))
+
+	task, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal(restored.Version, task.Version)
+	suite.Empty(suite.find(domain.TaskQuery{Trashed: true}).Tasks)
+
+	_, err = suite.repo.Restore(ctx, "1", updatedAt)
+	suite.ErrorIs(err, ErrNotInTrash, "no longer in the trash")
+	_, err = suite.repo.Restore(ctx, "12000", updatedAt)
+	suite.ErrorIs(err, ErrNotInTrash)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestPurge() {
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		suite.addTask("Task " + strconv.Itoa(i))
+	}
+	now := time.Now()
+	suite.trash("1", 0, now.Add(-48*time.Hour))
+	suite.trash("2", 0, now)
+
+	purged, err := suite.repo.Purge(ctx, now.Add(-24*time.Hour))
+	suite.NoError(err)
+	suite.Equal(int64(1), purged)
+
+	suite.Equal([]string{"2"}, taskIDs(suite.find(domain.TaskQuery{Trashed: true}).Tasks))
+	_, err = suite.repo.Restore(ctx, "1", now)
+	suite.ErrorIs(err, ErrNotInTrash, "purged for good")
+	all, err := suite.repo.GetAll(ctx)
+	suite.NoError(err)
+	suite.Equal([]string{"3"}, taskIDs(all))
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestSetStatus() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.repo.Add(ctx, domain.Task{Title: "Task 1", Description: "Description 1", Status: "pending"}))
+
+	at := time.Date(2024, 8, 2, 9, 0, 0, 0, time.UTC)
+	suite.NoError(suite.repo.SetStatus(ctx, "1", "pending", "in_progress", at))
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal("in_progress", result.Status)
+	suite.True(at.Equal(result.UpdatedAt))
+	suite.Equal(int64(1), result.Version)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestSetStatus_StaleExpectation() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.repo.Add(ctx, domain.Task{Title: "Task 1", Description: "Description 1", Status: "in_progress"}))
+
+	err := suite.repo.SetStatus(ctx, "1", "pending", "done", time.Now())
+	suite.ErrorIs(err, ErrStatusChanged)
+
+	result, err := suite.repo.GetOne(ctx, "1")
+	suite.NoError(err)
+	suite.Equal("in_progress", result.Status)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestReassignUser() {
+	ctx := context.Background()
+	for _, task := range []domain.Task{
+		{Title: "Task 1", Description: "d", Owner: "alice", Assignee: "alice"},
+		{Title: "Task 2", Description: "d", Owner: "alice", Assignee: "bob"},
+		{Title: "Task 3", Description: "d", Owner: "bob", Assignee: "alice"},
+		{Title: "Task 4", Description: "d", Owner: "bob"},
+	} {
+		suite.Require().NoError(suite.repo.Add(ctx, task))
+	}
+
+	at := time.Date(2024, 8, 2, 9, 0, 0, 0, time.UTC)
+	changed, err := suite.repo.ReassignUser(ctx, "alice", "carol", at)
+	suite.NoError(err)
+	suite.Equal(int64(3), changed)
+
+	want := map[string][2]string{"1": {"carol", "carol"}, "2": {"carol", "bob"}, "3": {"bob", "carol"}, "4": {"bob", ""}}
+	for id, people := range want {
+		task, err := suite.repo.GetOne(ctx, id)
+		suite.NoError(err)
+		suite.Equal(people[0], task.Owner, id)
+		suite.Equal(people[1], task.Assignee, id)
+		suite.Equal(id != "4", at.Equal(task.UpdatedAt), id)
+	}
+
+	// an empty target leaves the tasks without owner or assignee
+	changed, err = suite.repo.ReassignUser(ctx, "bob", "", at)
+	suite.NoError(err)
+	suite.Equal(int64(3), changed)
+	task, err := suite.repo.GetOne(ctx, "4")
+	suite.NoError(err)
+	suite.Empty(task.Owner)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestSetStatus_NotFound() {
+	ctx := context.Background()
+	err := suite.repo.SetStatus(ctx, "12000", "pending", "done", time.Now())
+	suite.ErrorIs(err, ErrTaskNotFound)
+}
+
+// seedQueryTasks stores five tasks with distinct creation times, one of them
+// carrying a legacy status spelling.
+func (suite *TaskRepositoryConformanceSuite) seedQueryTasks() {
+	ctx := context.Background()
+	base := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tasks := []domain.Task{
+		{Title: "Write docs", Description: "API reference", Status: "pending", Priority: domain.PriorityLow, Assignee: "alice", Owner: "bob", DueDate: base.Add(10 * day)},
+		{Title: "Fix login", Description: "Token expiry bug", Status: "in_progress", Priority: domain.PriorityUrgent, Assignee: "bob", Owner: "bob", DueDate: base.Add(2 * day)},
+		{Title: "Release", Description: "Ship the DOCS site", Status: "Pending", Priority: domain.PriorityHigh, Assignee: "alice"},
+		{Title: "Refactor", Description: "Clean up handlers", Status: "done", Priority: domain.PriorityNormal, Assignee: "bob", DueDate: base.Add(5 * day)},
+		{Title: "Plan sprint", Description: "Next iteration", Status: "pending", Priority: domain.PriorityHigh, Owner: "carol", DueDate: base.Add(7 * day)},
+	}
+	for i, task := range tasks {
+		task.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		task.UpdatedAt = task.CreatedAt
+		suite.Require().NoError(suite.repo.Add(ctx, task))
+	}
+}
+
+func (suite *TaskRepositoryConformanceSuite) find(query domain.TaskQuery) domain.TaskPage {
+	ctx := context.Background()
+	suite.Require().NoError(query.Normalize())
+	page, err := suite.repo.Find(ctx, query)
+	suite.Require().NoError(err)
+	return page
+}
+
+func taskIDs(tasks []domain.Task) []string {
+	ids := []string{}
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestFind_Filters() {
+	suite.seedQueryTasks()
+	base := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+
+	page := suite.find(domain.TaskQuery{})
+	suite.Equal([]string{"1", "2", "3", "4", "5"}, taskIDs(page.Tasks))
+	suite.Equal(int64(5), page.Total)
+	suite.Empty(page.NextCursor)
+
+	page = suite.find(domain.TaskQuery{Status: "pending"})
+	suite.Equal([]string{"1", "3", "5"}, taskIDs(page.Tasks), "legacy spellings match too")
+
+	page = suite.find(domain.TaskQuery{Assignee: "bob"})
+	suite.Equal([]string{"2", "4"}, taskIDs(page.Tasks))
+
+	page = suite.find(domain.TaskQuery{DueAfter: base.Add(3 * 24 * time.Hour), DueBefore: base.Add(7 * 24 * time.Hour)})
+	suite.Equal([]string{"4", "5"}, taskIDs(page.Tasks), "bounds are inclusive and undated tasks never match")
+
+	page = suite.find(domain.TaskQuery{Text: "docs"})
+	suite.Equal([]string{"1", "3"}, taskIDs(page.Tasks), "text matches title or description, ignoring case")
+
+	page = suite.find(domain.TaskQuery{VisibleTo: "bob"})
+	suite.Equal([]string{"1", "2", "4"}, taskIDs(page.Tasks), "owned or assigned")
+
+	page = suite.find(domain.TaskQuery{VisibleTo: "alice", Text: "docs"})
+	suite.Equal([]string{"1", "3"}, taskIDs(page.Tasks), "visibility combines with the text search")
+
+	page = suite.find(domain.TaskQuery{Status: "pending", Assignee: "alice", Text: "ship"})
+	suite.Equal([]string{"3"}, taskIDs(page.Tasks))
+	suite.Equal(int64(1), page.Total)
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestFind_Sorting() {
+	suite.seedQueryTasks()
+
+	page := suite.find(domain.TaskQuery{SortBy: domain.SortByCreatedAt, Descending: true})
+	suite.Equal([]string{"5", "4", "3", "2", "1"}, taskIDs(page.Tasks))
+
+	page = suite.find(domain.TaskQuery{SortBy: domain.SortByDueDate})
+	suite.Equal([]string{"3", "2", "4", "5", "1"}, taskIDs(page.Tasks), "tasks without a due date come first")
+
+	page = suite.find(domain.TaskQuery{SortBy: domain.SortByPriority, Descending: true})
+	suite.Equal([]string{"2", "5", "3", "4", "1"}, taskIDs(page.Tasks), "ties break on ID in the same direction")
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestFind_CursorPagination() {
+	suite.seedQueryTasks()
+
+	for _, query := range []domain.TaskQuery{
+		{SortBy: domain.SortByCreatedAt},
+		{SortBy: domain.SortByDueDate, Descending: true},
+		{SortBy: domain.SortByPriority},
+		{SortBy: domain.SortByPriority, Descending: true},
+	} {
+		full := suite.find(query)
+
+		var walked []string
+		query.Limit = 2
+		for pages := 0; ; pages++ {
+			suite.Require().Less(pages, 5, "pagination does not terminate")
+			page := suite.find(query)
+			suite.Equal(int64(5), page.Total)
+			suite.LessOrEqual(len(page.Tasks), 2)
+			walked = append(walked, taskIDs(page.Tasks)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		suite.Equal(taskIDs(full.Tasks), walked, "sort %s desc=%v", query.SortBy, query.Descending)
+	}
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestFind_InvalidCursor() {
+	ctx := context.Background()
+	suite.seedQueryTasks()
+
+	query := domain.TaskQuery{Limit: 2}
+	page := suite.find(query)
+	suite.Require().NotEmpty(page.NextCursor)
+
+	for _, bad := range []domain.TaskQuery{
+		{Cursor: "not a cursor"},
+		{Cursor: page.NextCursor, SortBy: domain.SortByPriority},
+		{Cursor: page.NextCursor, Descending: true},
+	} {
+		suite.Require().NoError(bad.Normalize())
+		_, err := suite.repo.Find(ctx, bad)
+		suite.ErrorIs(err, domain.ErrInvalidCursor)
+	}
+}
+
+func (suite *TaskRepositoryConformanceSuite) TestConcurrentAddsGetUniqueIDs() {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			suite.NoError(suite.repo.Add(ctx, domain.Task{Title: "Task", Description: "Description"}))
+		}()
+	}
+	wg.Wait()
+
+	tasks, err := suite.repo.GetAll(ctx)
+	suite.NoError(err)
+	seen := make(map[string]bool)
+	for _, task := range tasks {
+		suite.False(seen[task.ID], "duplicate id %s", task.ID)
+		seen[task.ID] = true
+	}
+	suite.Len(seen, 20)
+}
+
+type UserRepositoryConformanceSuite struct {
+	suite.Suite
+	backend backend
+	repo    UserRepository
+}
+
+func (suite *UserRepositoryConformanceSuite) SetupTest() {
+	suite.repo = suite.backend.users(suite.T())
+}
+
+func (suite *UserRepositoryConformanceSuite) TestRegister_AssignsID() {
+	ctx := context.Background()
+	err := suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash", Role: "user"})
+	suite.NoError(err)
+
+	user, err := suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.False(user.ID.IsZero())
+	suite.Equal("hash", user.Password)
+	suite.Equal("user", user.Role)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestRegister_ExistingUser() {
+	ctx := context.Background()
+	user := domain.User{Username: "existingUser", Password: "hash"}
+	suite.NoError(suite.repo.Register(ctx, user))
+
+	suite.ErrorIs(suite.repo.Register(ctx, user), ErrUsernameExists)
+	suite.ErrorIs(suite.repo.RegisterAdmin(ctx, user), ErrUsernameExists)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestLoginUser_NotFound() {
+	ctx := context.Background()
+	_, err := suite.repo.LoginUser(ctx, "invalidUser")
+	suite.ErrorIs(err, mongo.ErrNoDocuments)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetAccountStatus() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash", LegacyActivate: "true"}))
+	changedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	status := domain.AccountStatus{State: domain.AccountDeactivated, Reason: "left the team", ChangedAt: changedAt}
+	suite.NoError(suite.repo.SetAccountStatus(ctx, "testUser", status))
+	user, err := suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.False(user.Active())
+	suite.Equal(domain.AccountDeactivated, user.Status.State)
+	suite.Equal("left the team", user.Status.Reason)
+	suite.True(changedAt.Equal(user.Status.ChangedAt))
+	suite.Empty(user.LegacyActivate)
+
+	suite.NoError(suite.repo.SetAccountStatus(ctx, "testUser", domain.AccountStatus{State: domain.AccountActive, ChangedAt: changedAt}))
+	user, err = suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.True(user.Active())
+	suite.Empty(user.Status.Reason)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetAccountStatus_UserNotFound() {
+	ctx := context.Background()
+	status := domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+	suite.ErrorIs(suite.repo.SetAccountStatus(ctx, "nonexistentUser", status), ErrUserDoesNotExist)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetTwoFactor() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash"}))
+	user, err := suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.True(user.TwoFactor.IsZero())
+
+	twoFactor := domain.TwoFactor{Enabled: true, Secret: "JBSWY3DPEHPK3PXP", LastStep: 42, RecoveryCodes: []string{"a", "b"}}
+	suite.NoError(suite.repo.SetTwoFactor(ctx, "testUser", twoFactor))
+	user, err = suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.Equal(twoFactor, user.TwoFactor)
+
+	suite.NoError(suite.repo.SetTwoFactor(ctx, "testUser", domain.TwoFactor{}))
+	user, err = suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.True(user.TwoFactor.IsZero())
+
+	suite.ErrorIs(suite.repo.SetTwoFactor(ctx, "invalidUser", twoFactor), ErrUserDoesNotExist)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetPassword() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash", Role: "user"}))
+
+	suite.NoError(suite.repo.SetPassword(ctx, "testUser", "newHash"))
+	user, err := suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.Equal("newHash", user.Password)
+	suite.Equal("user", user.Role)
+
+	suite.ErrorIs(suite.repo.SetPassword(ctx, "invalidUser", "newHash"), ErrUserDoesNotExist)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetRole() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash", Role: "user"}))
+
+	suite.NoError(suite.repo.SetRole(ctx, "testUser", "admin"))
+	user, err := suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.Equal("admin", user.Role)
+
+	suite.NoError(suite.repo.SetRole(ctx, "testUser", "auditor"))
+	user, err = suite.repo.LoginUser(ctx, "testUser")
+	suite.NoError(err)
+	suite.Equal("auditor", user.Role)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestSetRole_UserNotFound() {
+	ctx := context.Background()
+	suite.ErrorIs(suite.repo.SetRole(ctx, "nonexistentUser", "admin"), ErrUserDoesNotExist)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestUsernameExists() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash"}))
+
+	exists, err := suite.repo.UsernameExists(ctx, "testUser")
+	suite.NoError(err)
+	suite.True(exists)
+
+	exists, err = suite.repo.UsernameExists(ctx, "nonExistentUser")
+	suite.NoError(err)
+	suite.False(exists)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestFind() {
+	ctx := context.Background()
+	changedAt := time.Now().UTC().Truncate(time.Millisecond)
+	for _, user := range []domain.User{
+		{Username: "dave", Password: "hash", Role: "admin", Status: domain.AccountStatus{State: domain.AccountActive, ChangedAt: changedAt}},
+		{Username: "alice", Password: "hash", Role: "user", Status: domain.AccountStatus{State: domain.AccountActive, ChangedAt: changedAt}},
+		{Username: "carol", Password: "hash", Role: "user", Status: domain.AccountStatus{State: domain.AccountDeactivated, Reason: "left", ChangedAt: changedAt}},
+		{Username: "bob", Password: "hash", Role: "user", LegacyActivate: "false"},
+		{Username: "erin", Password: "hash", Role: "user", LegacyActivate: "true"},
+	} {
+		suite.Require().NoError(suite.repo.Register(ctx, user))
+	}
+	find := func(query domain.UserQuery) domain.UserPage {
+		suite.Require().NoError(query.Normalize())
+		page, err := suite.repo.Find(ctx, query)
+		suite.Require().NoError(err)
+		return page
+	}
+	usernames := func(page domain.UserPage) []string {
+		names := []string{}
+		for _, user := range page.Users {
+			names = append(names, user.Username)
+		}
+		return names
+	}
+
+	suite.Equal([]string{"alice", "bob", "carol", "dave", "erin"}, usernames(find(domain.UserQuery{})))
+	suite.Equal([]string{"alice", "erin"}, usernames(find(domain.UserQuery{Role: "user", Status: domain.AccountActive})))
+	deactivated := find(domain.UserQuery{Status: domain.AccountDeactivated})
+	suite.Equal([]string{"bob", "carol"}, usernames(deactivated))
+	suite.Equal("left", deactivated.Users[1].StatusReason)
+	suite.True(changedAt.Equal(*deactivated.Users[1].StatusChangedAt))
+
+	first := find(domain.UserQuery{Limit: 2})
+	suite.Equal([]string{"alice", "bob"}, usernames(first))
+	suite.Equal(int64(5), first.Total)
+	suite.Require().NotEmpty(first.NextCursor)
+	second := find(domain.UserQuery{Limit: 2, Cursor: first.NextCursor})
+	suite.Equal([]string{"carol", "dave"}, usernames(second))
+	last := find(domain.UserQuery{Limit: 2, Cursor: second.NextCursor})
+	suite.Equal([]string{"erin"}, usernames(last))
+	suite.Empty(last.NextCursor)
+
+	_, err := suite.repo.Find(ctx, domain.UserQuery{Limit: 2, Cursor: "%%%"})
+	suite.ErrorIs(err, domain.ErrInvalidCursor)
+}
+
+func (suite *UserRepositoryConformanceSuite) TestDelete() {
+	ctx := context.Background()
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash"}))
+
+	suite.NoError(suite.repo.Delete(ctx, "testUser"))
+	exists, err := suite.repo.UsernameExists(ctx, "testUser")
+	suite.NoError(err)
+	suite.False(exists)
+
+	suite.ErrorIs(suite.repo.Delete(ctx, "testUser"), ErrUserDoesNotExist)
+	// the username is free again
+	suite.NoError(suite.repo.Register(ctx, domain.User{Username: "testUser", Password: "hash"}))
+}
+
+func (suite *UserRepositoryConformanceSuite) TestConcurrentRegisterKeepsUsernamesUnique() {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- suite.repo.Register(ctx, domain.User{Username: "sameName", Password: "hash"})
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			suite.ErrorIs(err, ErrUsernameExists)
+		}
+	}
+	suite.Equal(1, succeeded)
+}
+
+type SessionRepositoryConformanceSuite struct {
+	suite.Suite
+	backend backend
+	repo    SessionRepository
+}
+
+func (suite *SessionRepositoryConformanceSuite) SetupTest() {
+	suite.repo = suite.backend.sessions(suite.T())
+}
+
+func (suite *SessionRepositoryConformanceSuite) newSession(id, username string) domain.Session {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := domain.Session{ID: id, Username: username, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	suite.Require().NoError(suite.repo.Create(ctx, session))
+	return session
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestCreateAndGet() {
+	ctx := context.Background()
+	session := suite.newSession("s1", "alice")
+
+	stored, err := suite.repo.Get(ctx, "s1")
+	suite.NoError(err)
+	suite.Equal(session.Username, stored.Username)
+	suite.Equal(0, stored.Generation)
+	suite.True(session.ExpiresAt.Equal(stored.ExpiresAt))
+	suite.False(stored.Revoked)
+
+	_, err = suite.repo.Get(ctx, "missing")
+	suite.ErrorIs(err, ErrSessionNotFound)
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestRotate() {
+	ctx := context.Background()
+	session := suite.newSession("s1", "alice")
+	later := session.ExpiresAt.Add(time.Hour)
+
+	suite.NoError(suite.repo.Rotate(ctx, "s1", 0, later))
+	stored, err := suite.repo.Get(ctx, "s1")
+	suite.NoError(err)
+	suite.Equal(1, stored.Generation)
+	suite.True(later.Equal(stored.ExpiresAt))
+
+	// a second refresh with the same token loses
+	suite.ErrorIs(suite.repo.Rotate(ctx, "s1", 0, later), ErrSessionChanged)
+	suite.ErrorIs(suite.repo.Rotate(ctx, "missing", 0, later), ErrSessionNotFound)
+
+	suite.NoError(suite.repo.Revoke(ctx, "s1"))
+	suite.ErrorIs(suite.repo.Rotate(ctx, "s1", 1, later), ErrSessionChanged)
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestRevoke() {
+	ctx := context.Background()
+	suite.newSession("s1", "alice")
+	suite.newSession("s2", "alice")
+
+	suite.NoError(suite.repo.Revoke(ctx, "s1"))
+	suite.NoError(suite.repo.Revoke(ctx, "missing"))
+
+	stored, err := suite.repo.Get(ctx, "s1")
+	suite.NoError(err)
+	suite.True(stored.Revoked)
+	stored, err = suite.repo.Get(ctx, "s2")
+	suite.NoError(err)
+	suite.False(stored.Revoked)
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestRevokeUser() {
+	ctx := context.Background()
+	suite.newSession("s1", "alice")
+	suite.newSession("s2", "alice")
+	suite.newSession("s3", "bob")
+
+	suite.NoError(suite.repo.RevokeUser(ctx, "alice"))
+
+	for id, revoked := range map[string]bool{"s1": true, "s2": true, "s3": false} {
+		stored, err := suite.repo.Get(ctx, id)
+		suite.NoError(err)
+		suite.Equal(revoked, stored.Revoked, id)
+	}
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestCreateDropsExpiredSessions() {
+	if suite.backend.name == "mongo" {
+		suite.T().Skip("MongoDB drops expired sessions by a TTL index, about once a minute")
+	}
+	ctx := context.Background()
+	now := time.Now()
+	suite.Require().NoError(suite.repo.Create(ctx, domain.Session{ID: "old", Username: "alice", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}))
+	suite.newSession("s1", "alice")
+
+	_, err := suite.repo.Get(ctx, "old")
+	suite.ErrorIs(err, ErrSessionNotFound)
+	_, err = suite.repo.Get(ctx, "s1")
+	suite.NoError(err)
+}
+
+func (suite *SessionRepositoryConformanceSuite) TestConcurrentRotateHasOneWinner() {
+	ctx := context.Background()
+	suite.newSession("s1", "alice")
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- suite.repo.Rotate(ctx, "s1", 0, time.Now().Add(time.Hour))
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			suite.ErrorIs(err, ErrSessionChanged)
+		}
+	}
+	suite.Equal(1, succeeded)
+}
+
+type PasswordResetRepositoryConformanceSuite struct {
+	suite.Suite
+	backend backend
+	repo    PasswordResetRepository
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) SetupTest() {
+	suite.repo = suite.backend.resets(suite.T())
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) newReset(hash, username string, ttl time.Duration) domain.PasswordReset {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	reset := domain.PasswordReset{TokenHash: hash, Username: username, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	suite.Require().NoError(suite.repo.Create(ctx, reset))
+	return reset
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) TestConsumeWorksOnce() {
+	ctx := context.Background()
+	reset := suite.newReset("h1", "alice", time.Hour)
+
+	stored, err := suite.repo.Consume(ctx, "h1", time.Now())
+	suite.NoError(err)
+	suite.Equal("alice", stored.Username)
+	suite.True(reset.ExpiresAt.Equal(stored.ExpiresAt))
+
+	_, err = suite.repo.Consume(ctx, "h1", time.Now())
+	suite.ErrorIs(err, ErrResetTokenNotFound)
+	_, err = suite.repo.Consume(ctx, "missing", time.Now())
+	suite.ErrorIs(err, ErrResetTokenNotFound)
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) TestConsumeExpired() {
+	ctx := context.Background()
+	suite.newReset("h1", "alice", time.Minute)
+
+	_, err := suite.repo.Consume(ctx, "h1", time.Now().Add(time.Hour))
+	suite.ErrorIs(err, ErrResetTokenNotFound)
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) TestDeleteUser() {
+	ctx := context.Background()
+	suite.newReset("h1", "alice", time.Hour)
+	suite.newReset("h2", "alice", time.Hour)
+	suite.newReset("h3", "bob", time.Hour)
+
+	suite.NoError(suite.repo.DeleteUser(ctx, "alice"))
+
+	for hash, deleted := range map[string]bool{"h1": true, "h2": true, "h3": false} {
+		_, err := suite.repo.Consume(ctx, hash, time.Now())
+		if deleted {
+			suite.ErrorIs(err, ErrResetTokenNotFound, hash)
+		} else {
+			suite.NoError(err, hash)
+		}
+	}
+}
+
+func (suite *PasswordResetRepositoryConformanceSuite) TestConcurrentConsumeHasOneWinner() {
+	ctx := context.Background()
+	suite.newReset("h1", "alice", time.Hour)
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := suite.repo.Consume(ctx, "h1", time.Now())
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			suite.ErrorIs(err, ErrResetTokenNotFound)
+		}
+	}
+	suite.Equal(1, succeeded)
+}
+
+type APIKeyRepositoryConformanceSuite struct {
+	suite.Suite
+	backend backend
+	repo    APIKeyRepository
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) SetupTest() {
+	suite.repo = suite.backend.apiKeys(suite.T())
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) newKey(id, username string, age time.Duration) domain.APIKey {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	key := domain.APIKey{
+		ID:        id,
+		Username:  username,
+		Name:      "key " + id,
+		Prefix:    domain.APIKeyPrefix + id,
+		KeyHash:   "hash-" + id,
+		Scopes:    []domain.Permission{domain.PermTasksRead},
+		CreatedAt: now.Add(-age),
+		ExpiresAt: now.Add(time.Hour),
+	}
+	suite.Require().NoError(suite.repo.Create(ctx, key))
+	return key
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) TestCreateAndGetByHash() {
+	ctx := context.Background()
+	key := suite.newKey("k1", "alice", 0)
+
+	stored, err := suite.repo.GetByHash(ctx, "hash-k1")
+	suite.NoError(err)
+	suite.Equal(key.ID, stored.ID)
+	suite.Equal(key.Username, stored.Username)
+	suite.Equal(key.Prefix, stored.Prefix)
+	suite.Equal(key.Scopes, stored.Scopes)
+	suite.True(key.ExpiresAt.Equal(stored.ExpiresAt))
+	suite.Nil(stored.LastUsedAt)
+
+	_, err = suite.repo.GetByHash(ctx, "missing")
+	suite.ErrorIs(err, ErrAPIKeyNotFound)
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) TestListUser() {
+	ctx := context.Background()
+	suite.newKey("k1", "alice", time.Minute)
+	suite.newKey("k2", "alice", 2*time.Minute)
+	suite.newKey("k3", "bob", 0)
+
+	keys, err := suite.repo.ListUser(ctx, "alice")
+	suite.NoError(err)
+	suite.Require().Len(keys, 2)
+	suite.Equal("k2", keys[0].ID)
+	suite.Equal("k1", keys[1].ID)
+
+	keys, err = suite.repo.ListUser(ctx, "nobody")
+	suite.NoError(err)
+	suite.Empty(keys)
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) TestTouch() {
+	ctx := context.Background()
+	suite.newKey("k1", "alice", 0)
+	usedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	suite.NoError(suite.repo.Touch(ctx, "hash-k1", usedAt))
+	suite.NoError(suite.repo.Touch(ctx, "missing", usedAt))
+
+	stored, err := suite.repo.GetByHash(ctx, "hash-k1")
+	suite.NoError(err)
+	suite.Require().NotNil(stored.LastUsedAt)
+	suite.True(usedAt.Equal(*stored.LastUsedAt))
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) TestDelete() {
+	ctx := context.Background()
+	suite.newKey("k1", "alice", 0)
+
+	suite.ErrorIs(suite.repo.Delete(ctx, "bob", "k1"), ErrAPIKeyNotFound)
+	suite.NoError(suite.repo.Delete(ctx, "alice", "k1"))
+	suite.ErrorIs(suite.repo.Delete(ctx, "alice", "k1"), ErrAPIKeyNotFound)
+
+	_, err := suite.repo.GetByHash(ctx, "hash-k1")
+	suite.ErrorIs(err, ErrAPIKeyNotFound)
+}
+
+func (suite *APIKeyRepositoryConformanceSuite) TestDeleteUser() {
+	ctx := context.Background()
+	suite.newKey("k1", "alice", 0)
+	suite.newKey("k2", "alice", 0)
+	suite.newKey("k3", "bob", 0)
+
+	suite.NoError(suite.repo.DeleteUser(ctx, "alice"))
+
+	for id, deleted := range map[string]bool{"k1": true, "k2": true, "k3": false} {
+		_, err := suite.repo.GetByHash(ctx, "hash-"+id)
+		if deleted {
+			suite.ErrorIs(err, ErrAPIKeyNotFound, id)
+		} else {
+			suite.NoError(err, id)
+		}
+	}
+}
+
+func TestRepositoryConformance(t *testing.T) {
+	for _, b := range backends() {
+		t.Run(b.name, func(t *testing.T) {
+			t.Run("tasks", func(t *testing.T) {
+				suite.Run(t, &TaskRepositoryConformanceSuite{backend: b})
+			})
+			t.Run("users", func(t *testing.T) {
+				suite.Run(t, &UserRepositoryConformanceSuite{backend: b})
+			})
+			t.Run("sessions", func(t *testing.T) {
+				suite.Run(t, &SessionRepositoryConformanceSuite{backend: b})
+			})
+			t.Run("password resets", func(t *testing.T) {
+				suite.Run(t, &PasswordResetRepositoryConformanceSuite{backend: b})
+			})
+			t.Run("API keys", func(t *testing.T) {
+				suite.Run(t, &APIKeyRepositoryConformanceSuite{backend: b})
+			})
+		})
+	}
+}
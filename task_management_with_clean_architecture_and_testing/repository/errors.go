@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"fmt"
+	"task_with_clean_arc_and_test/domain"
+)
+
+// Errors shared by every storage backend so callers see the same failures
+// regardless of which implementation is wired in.
+var (
+	ErrTaskNotFound       = domain.ErrTaskNotFound
+	ErrStatusChanged      = domain.ErrStatusChanged
+	ErrVersionMismatch    = domain.ErrVersionMismatch
+	ErrNotInTrash         = domain.ErrNotInTrash
+	ErrDuplicateTaskID    = domain.ErrDuplicateTaskID
+	ErrSessionNotFound    = domain.ErrSessionNotFound
+	ErrSessionChanged     = domain.ErrSessionChanged
+	ErrUsernameExists     = domain.ErrUsernameTaken
+	ErrUserDoesNotExist   = domain.ErrUserNotFound
+	ErrResetTokenNotFound = domain.ErrInvalidResetToken
+	ErrAPIKeyNotFound     = domain.ErrAPIKeyNotFound
+)
+
+func taskWithIDNotFound(id string) error {
+	return ErrTaskNotFound.Reword(fmt.Sprintf("task with id %s not found", id))
+}
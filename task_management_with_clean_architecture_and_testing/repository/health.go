@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Pinger reports whether a storage backend can serve requests, for the
+// readiness probe.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type mongoPinger struct {
+	client *mongo.Client
+}
+
+// NewMongoPinger pings the primary of the client's deployment.
+func NewMongoPinger(client *mongo.Client) Pinger {
+	return mongoPinger{client: client}
+}
+
+func (p mongoPinger) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx, readpref.Primary())
+}
+
+type boltPinger struct {
+	db *bolt.DB
+}
+
+// NewBoltPinger checks that the bolt file is still open and readable.
+func NewBoltPinger(db *bolt.DB) Pinger {
+	return boltPinger{db: db}
+}
+
+func (p boltPinger) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+type inMemoryPinger struct{}
+
+// NewInMemoryPinger is always ready, as the in-memory repositories cannot
+// become unreachable.
+func NewInMemoryPinger() Pinger {
+	return inMemoryPinger{}
+}
+
+func (inMemoryPinger) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
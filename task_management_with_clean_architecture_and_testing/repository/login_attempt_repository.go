@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+// LoginAttemptRepository counts failed logins per key, an account or a
+// client address. Counters forget themselves once no failure was added for
+// their ttl, so the store never has to be cleaned up by its callers.
+type LoginAttemptRepository interface {
+	// Get returns the failures recorded for key, or none if they expired
+	// before now.
+	Get(key string, now time.Time) (domain.Attempts, error)
+	// AddFailure records a failure of key at now and returns the updated
+	// count. It must be atomic, so concurrent guesses are all counted.
+	AddFailure(key string, now time.Time, ttl time.Duration) (domain.Attempts, error)
+	// Reset forgets the failures of key.
+	Reset(key string) error
+}
+
+// maxAttemptKeys is how many counters the in-memory store holds before it
+// first sweeps expired ones.
+const maxAttemptKeys = 100000
+
+type attemptEntry struct {
+	attempts domain.Attempts
+	expires  time.Time
+}
+
+type inMemoryLoginAttemptRepository struct {
+	mu      sync.Mutex
+	entries map[string]attemptEntry
+	sweepAt int
+}
+
+// NewInMemoryLoginAttemptRepository returns a LoginAttemptRepository that
+// keeps counters in process memory. Each server instance counts on its own,
+// and counters reset when it restarts.
+func NewInMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &inMemoryLoginAttemptRepository{
+		entries: make(map[string]attemptEntry),
+		sweepAt: maxAttemptKeys,
+	}
+}
+
+func (r *inMemoryLoginAttemptRepository) Get(key string, now time.Time) (domain.Attempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return domain.Attempts{}, nil
+	}
+	return entry.attempts, nil
+}
+
+func (r *inMemoryLoginAttemptRepository) AddFailure(key string, now time.Time, ttl time.Duration) (domain.Attempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		entry = attemptEntry{}
+		if len(r.entries) >= r.sweepAt {
+			r.sweep(now)
+		}
+	}
+	entry.attempts.Failures++
+	entry.attempts.Last = now
+	entry.expires = now.Add(ttl)
+	r.entries[key] = entry
+	return entry.attempts, nil
+}
+
+func (r *inMemoryLoginAttemptRepository) Reset(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, key)
+	return nil
+}
+
+// sweep drops expired counters. Live ones are kept even past
+// maxAttemptKeys, since dropping them would lift lockouts; the next sweep
+// then waits until the store has doubled.
+func (r *inMemoryLoginAttemptRepository) sweep(now time.Time) {
+	for key, entry := range r.entries {
+		if !now.Before(entry.expires) {
+			delete(r.entries, key)
+		}
+	}
+	r.sweepAt = maxAttemptKeys
+	if 2*len(r.entries) > r.sweepAt {
+		r.sweepAt = 2 * len(r.entries)
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryLoginAttemptRepository(t *testing.T) {
+	repo := NewInMemoryLoginAttemptRepository()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	attempts, err := repo.Get("account:bob", now)
+	require.NoError(t, err)
+	assert.Zero(t, attempts.Failures)
+
+	repo.AddFailure("account:bob", now, time.Minute)
+	attempts, err = repo.AddFailure("account:bob", now.Add(30*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+	assert.Equal(t, now.Add(30*time.Second), attempts.Last)
+
+	// the ttl runs from the latest failure
+	attempts, _ = repo.Get("account:bob", now.Add(80*time.Second))
+	assert.Equal(t, 2, attempts.Failures)
+	attempts, _ = repo.Get("account:bob", now.Add(90*time.Second))
+	assert.Zero(t, attempts.Failures)
+	attempts, _ = repo.AddFailure("account:bob", now.Add(90*time.Second), time.Minute)
+	assert.Equal(t, 1, attempts.Failures)
+
+	require.NoError(t, repo.Reset("account:bob"))
+	attempts, _ = repo.Get("account:bob", now.Add(90*time.Second))
+	assert.Zero(t, attempts.Failures)
+}
+
+func TestInMemoryLoginAttemptRepositoryCountsConcurrentFailures(t *testing.T) {
+	repo := NewInMemoryLoginAttemptRepository()
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repo.AddFailure("ip:192.0.2.1", now, time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	attempts, err := repo.Get("ip:192.0.2.1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 50, attempts.Failures)
+}
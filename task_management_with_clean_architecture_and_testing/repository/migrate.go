@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TaskSequence names the Mongo sequence task IDs are counted in.
+const TaskSequence = "tasks"
+
+// MigrateMongo prepares db for the Mongo repositories and is safe to run on
+// every start. Tasks used to be numbered by reading the highest ID, so it
+// starts the task sequence after the highest numeric ID, renumbers tasks
+// that concurrent creates gave the same ID, and then adds unique indexes on
+// task IDs and usernames, an index for purging the trash, and the indexes
+// sessions, password resets and API keys are looked up by, which also
+// expire sessions and resets.
+func MigrateMongo(ctx context.Context, db *mongo.Database) error {
+	tasks := db.Collection("tasks")
+	if err := startTaskSequence(ctx, db, tasks); err != nil {
+		return fmt.Errorf("starting the task sequence: %w", err)
+	}
+	if err := renumberDuplicateTasks(ctx, tasks, NewMongoSequence(db, TaskSequence)); err != nil {
+		return fmt.Errorf("renumbering tasks with the same id: %w", err)
+	}
+	_, err := tasks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("indexing task ids: %w", err)
+	}
+	_, err = tasks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted.at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return fmt.Errorf("indexing the trash: %w", err)
+	}
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("indexing usernames, which may be taken twice and need to be told apart by hand: %w", err)
+	}
+	_, err = db.Collection("sessions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+		// MongoDB drops each session once its expiresat passed
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("indexing sessions: %w", err)
+	}
+	_, err = db.Collection("password_resets").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+		// MongoDB drops each reset once its expiresat passed, used or not
+		{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("indexing password resets: %w", err)
+	}
+	_, err = db.Collection("api_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "keyhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("indexing API keys: %w", err)
+	}
+	return nil
+}
+
+// startTaskSequence moves the task sequence past the highest numeric task
+// ID, leaving it alone if it is past it already.
+func startTaskSequence(ctx context.Context, db *mongo.Database, tasks *mongo.Collection) error {
+	cursor, err := tasks.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"max": bson.M{"$max": bson.M{"$convert": bson.M{"input": "$id", "to": "long", "onError": nil, "onNull": nil}}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	var result []struct {
+		Max int64 `bson:"max"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return err
+	}
+	if len(result) == 0 || result[0].Max == 0 {
+		return nil
+	}
+	_, err = db.Collection(countersCollection).UpdateOne(ctx,
+		bson.M{"_id": TaskSequence},
+		bson.M{"$max": bson.M{"seq": result[0].Max}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// renumberDuplicateTasks gives every task sharing its ID with an older one a
+// new ID from ids. The oldest task keeps the ID.
+func renumberDuplicateTasks(ctx context.Context, tasks *mongo.Collection, ids IDGenerator) error {
+	cursor, err := tasks.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$id", "docs": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"docs.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Docs []primitive.ObjectID `bson:"docs"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		for _, doc := range duplicate.Docs[1:] {
+			id, err := ids.NextID(ctx)
+			if err != nil {
+				return err
+			}
+			if _, err := tasks.UpdateByID(ctx, doc, bson.M{"$set": bson.M{"id": id}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// skipIfMongoUnavailable skips the calling suite when no MongoDB server
+// answers, so the rest of the tests can run on machines without a database.
+func skipIfMongoUnavailable(t *testing.T, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("MongoDB is not reachable: %v", err)
+	}
+}
+
+var (
+	sharedMongoOnce   sync.Once
+	sharedMongoClient *mongo.Client
+	sharedMongoErr    error
+)
+
+// mongoTestClient returns a client shared by the conformance tests, connecting
+// and pinging only once so an absent server costs a single timeout.
+func mongoTestClient(t *testing.T) *mongo.Client {
+	sharedMongoOnce.Do(func() {
+		client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:27017"))
+		if err != nil {
+			sharedMongoErr = err
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx, nil); err != nil {
+			sharedMongoErr = err
+			return
+		}
+		sharedMongoClient = client
+	})
+	if sharedMongoErr != nil {
+		t.Skipf("MongoDB is not reachable: %v", sharedMongoErr)
+	}
+	return sharedMongoClient
+}
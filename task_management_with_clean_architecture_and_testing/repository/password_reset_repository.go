@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordResetRepository stores outstanding password resets, keyed by the
+// hash of their token.
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset domain.PasswordReset) error
+	// Consume removes the reset for tokenHash and returns it. It returns
+	// ErrResetTokenNotFound if there is none or it expired before now, and it
+	// must be atomic, so a token cannot be consumed twice.
+	Consume(ctx context.Context, tokenHash string, now time.Time) (domain.PasswordReset, error)
+	// DeleteUser removes every reset of username.
+	DeleteUser(ctx context.Context, username string) error
+}
+
+type passwordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPasswordResetRepository(db *mongo.Database) PasswordResetRepository {
+	return &passwordResetRepository{
+		collection: db.Collection("password_resets"),
+	}
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, reset domain.PasswordReset) error {
+	_, err := r.collection.InsertOne(ctx, reset)
+	return err
+}
+
+func (r *passwordResetRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (domain.PasswordReset, error) {
+	var reset domain.PasswordReset
+	err := r.collection.FindOneAndDelete(ctx, bson.D{{Key: "tokenhash", Value: tokenHash}}).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		return domain.PasswordReset{}, ErrResetTokenNotFound
+	}
+	if err != nil {
+		return domain.PasswordReset{}, err
+	}
+	if !now.Before(reset.ExpiresAt) {
+		return domain.PasswordReset{}, ErrResetTokenNotFound
+	}
+	return reset, nil
+}
+
+func (r *passwordResetRepository) DeleteUser(ctx context.Context, username string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.D{{Key: "username", Value: username}})
+	return err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltPasswordResetRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltPasswordResetRepository returns a PasswordResetRepository that
+// persists resets as JSON in the password_resets bucket of db, keyed by token
+// hash.
+func NewBoltPasswordResetRepository(db *bolt.DB) PasswordResetRepository {
+	return &boltPasswordResetRepository{db: db}
+}
+
+func (r *boltPasswordResetRepository) Create(ctx context.Context, reset domain.PasswordReset) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(passwordResetsBucket), reset.TokenHash, reset)
+	})
+}
+
+func (r *boltPasswordResetRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (domain.PasswordReset, error) {
+	var reset domain.PasswordReset
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(passwordResetsBucket)
+		data := bucket.Get([]byte(tokenHash))
+		if data == nil {
+			return ErrResetTokenNotFound
+		}
+		if err := json.Unmarshal(data, &reset); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(tokenHash))
+	})
+	if err != nil {
+		return domain.PasswordReset{}, err
+	}
+	if !now.Before(reset.ExpiresAt) {
+		return domain.PasswordReset{}, ErrResetTokenNotFound
+	}
+	return reset, nil
+}
+
+func (r *boltPasswordResetRepository) DeleteUser(ctx context.Context, username string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(passwordResetsBucket)
+		// the bucket must not change while ForEach walks it
+		var hashes []string
+		err := bucket.ForEach(func(k, v []byte) error {
+			var reset domain.PasswordReset
+			if err := json.Unmarshal(v, &reset); err != nil {
+				return err
+			}
+			if reset.Username == username {
+				hashes = append(hashes, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := bucket.Delete([]byte(hash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
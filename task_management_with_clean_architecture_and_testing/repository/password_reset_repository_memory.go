@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+type inMemoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	resets map[string]domain.PasswordReset // keyed by token hash
+}
+
+// NewInMemoryPasswordResetRepository returns a PasswordResetRepository that
+// keeps resets in process memory, so they stop working when the server stops.
+func NewInMemoryPasswordResetRepository() PasswordResetRepository {
+	return &inMemoryPasswordResetRepository{
+		resets: make(map[string]domain.PasswordReset),
+	}
+}
+
+func (r *inMemoryPasswordResetRepository) Create(ctx context.Context, reset domain.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resets[reset.TokenHash] = reset
+	return nil
+}
+
+func (r *inMemoryPasswordResetRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (domain.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reset, ok := r.resets[tokenHash]
+	if !ok {
+		return domain.PasswordReset{}, ErrResetTokenNotFound
+	}
+	delete(r.resets, tokenHash)
+	if !now.Before(reset.ExpiresAt) {
+		return domain.PasswordReset{}, ErrResetTokenNotFound
+	}
+	return reset, nil
+}
+
+func (r *inMemoryPasswordResetRepository) DeleteUser(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, reset := range r.resets {
+		if reset.Username == username {
+			delete(r.resets, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SessionRepository stores login sessions, which the auth middleware checks
+// on every request.
+type SessionRepository interface {
+	// Create stores a new session. Sessions are dropped some time after they
+	// expire, and then are not found any more.
+	Create(ctx context.Context, session domain.Session) error
+	// Get returns ErrSessionNotFound for unknown IDs.
+	Get(ctx context.Context, id string) (domain.Session, error)
+	// Rotate moves an active session from generation to the next one and
+	// extends it to expiresAt. It returns ErrSessionChanged if the session is
+	// no longer at generation or was revoked meanwhile.
+	Rotate(ctx context.Context, id string, generation int, expiresAt time.Time) error
+	// Revoke ends one session; revoking an unknown session is not an error.
+	Revoke(ctx context.Context, id string) error
+	// RevokeUser ends every session of username.
+	RevokeUser(ctx context.Context, username string) error
+}
+
+type sessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewSessionRepository returns a SessionRepository storing sessions in the
+// sessions collection of db. The TTL index MigrateMongo creates drops them
+// once they expire.
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &sessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session domain.Session) error {
+	_, err := r.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (r *sessionRepository) Get(ctx context.Context, id string) (domain.Session, error) {
+	var session domain.Session
+	err := r.collection.FindOne(ctx, bson.D{{Key: "id", Value: id}}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return domain.Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (r *sessionRepository) Rotate(ctx context.Context, id string, generation int, expiresAt time.Time) error {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "generation", Value: generation}, {Key: "revoked", Value: false}}
+	update := bson.D{
+		{Key: "$inc", Value: bson.M{"generation": 1}},
+		{Key: "$set", Value: bson.M{"expiresat": expiresAt}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := r.collection.CountDocuments(ctx, bson.D{{Key: "id", Value: id}})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrSessionNotFound
+		}
+		return ErrSessionChanged
+	}
+	return nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id string) error {
+	update := bson.D{{Key: "$set", Value: bson.M{"revoked": true}}}
+	_, err := r.collection.UpdateOne(ctx, bson.D{{Key: "id", Value: id}}, update)
+	return err
+}
+
+func (r *sessionRepository) RevokeUser(ctx context.Context, username string) error {
+	update := bson.D{{Key: "$set", Value: bson.M{"revoked": true}}}
+	_, err := r.collection.UpdateMany(ctx, bson.D{{Key: "username", Value: username}}, update)
+	return err
+}
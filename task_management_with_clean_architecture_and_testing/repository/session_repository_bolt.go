@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltSessionRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltSessionRepository returns a SessionRepository that persists sessions
+// as JSON in the sessions bucket of db, keyed by session ID.
+func NewBoltSessionRepository(db *bolt.DB) SessionRepository {
+	return &boltSessionRepository{db: db}
+}
+
+func (r *boltSessionRepository) Create(ctx context.Context, session domain.Session) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		// every login adds a session, so drop the expired ones here to keep
+		// the file bounded by the sessions still in use
+		now := time.Now()
+		var expired [][]byte
+		// the bucket must not change while ForEach walks it
+		err := bucket.ForEach(func(key, data []byte) error {
+			var existing domain.Session
+			if err := json.Unmarshal(data, &existing); err != nil {
+				return err
+			}
+			if !now.Before(existing.ExpiresAt) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return putJSON(bucket, session.ID, session)
+	})
+}
+
+func (r *boltSessionRepository) Get(ctx context.Context, id string) (domain.Session, error) {
+	var session domain.Session
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrSessionNotFound
+		}
+		return json.Unmarshal(data, &session)
+	})
+	if err != nil {
+		return domain.Session{}, err
+	}
+	return session, nil
+}
+
+func (r *boltSessionRepository) Rotate(ctx context.Context, id string, generation int, expiresAt time.Time) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrSessionNotFound
+		}
+		var session domain.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		if session.Revoked || session.Generation != generation {
+			return ErrSessionChanged
+		}
+		session.Generation++
+		session.ExpiresAt = expiresAt
+		return putJSON(bucket, id, session)
+	})
+}
+
+func (r *boltSessionRepository) Revoke(ctx context.Context, id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var session domain.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		session.Revoked = true
+		return putJSON(bucket, id, session)
+	})
+}
+
+func (r *boltSessionRepository) RevokeUser(ctx context.Context, username string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		// the bucket must not change while ForEach walks it
+		var revoked []domain.Session
+		err := bucket.ForEach(func(k, v []byte) error {
+			var session domain.Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if session.Username == username && !session.Revoked {
+				session.Revoked = true
+				revoked = append(revoked, session)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, session := range revoked {
+			if err := putJSON(bucket, session.ID, session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+type inMemorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]domain.Session
+}
+
+// NewInMemorySessionRepository returns a SessionRepository that keeps
+// sessions in process memory, so every session ends when the server stops.
+func NewInMemorySessionRepository() SessionRepository {
+	return &inMemorySessionRepository{
+		sessions: make(map[string]domain.Session),
+	}
+}
+
+func (r *inMemorySessionRepository) Create(ctx context.Context, session domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// every login adds a session, so drop the expired ones here to keep
+	// memory bounded by the sessions still in use
+	now := time.Now()
+	for id, existing := range r.sessions {
+		if !now.Before(existing.ExpiresAt) {
+			delete(r.sessions, id)
+		}
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *inMemorySessionRepository) Get(ctx context.Context, id string) (domain.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return domain.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (r *inMemorySessionRepository) Rotate(ctx context.Context, id string, generation int, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.Revoked || session.Generation != generation {
+		return ErrSessionChanged
+	}
+	session.Generation++
+	session.ExpiresAt = expiresAt
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *inMemorySessionRepository) Revoke(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.Revoked = true
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+func (r *inMemorySessionRepository) RevokeUser(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.Username == username {
+			session.Revoked = true
+			r.sessions[id] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IDGenerator hands out the IDs of new tasks. It never hands out an ID
+// twice, even to concurrent callers. IDs are opaque strings; the sequences
+// count 1, 2, 3 as tasks always were numbered, UUIDs and ULIDs need no
+// shared state.
+type IDGenerator interface {
+	NextID(ctx context.Context) (string, error)
+}
+
+// countersCollection holds one counter document per sequence, named by its
+// _id, counting in seq.
+const countersCollection = "counters"
+
+type mongoSequence struct {
+	counters *mongo.Collection
+	name     string
+}
+
+// NewMongoSequence returns a sequence counted atomically in the counters
+// collection of db, under name.
+func NewMongoSequence(db *mongo.Database, name string) IDGenerator {
+	return &mongoSequence{counters: db.Collection(countersCollection), name: name}
+}
+
+func (s *mongoSequence) NextID(ctx context.Context) (string, error) {
+	filter := bson.M{"_id": s.name}
+	update := bson.M{"$inc": bson.M{"seq": int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// another caller created the counter first, it exists now
+		err = s.counters.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(counter.Seq, 10), nil
+}
+
+type uuids struct{}
+
+// NewUUIDs returns a generator of version 7 UUIDs, which start with the
+// time, so later IDs mostly sort after earlier ones.
+func NewUUIDs() IDGenerator {
+	return uuids{}
+}
+
+func (uuids) NextID(context.Context) (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+	putMillis(u[:6], time.Now())
+	u[6] = 0x70 | u[6]&0x0f // version 7
+	u[8] = 0x80 | u[8]&0x3f // RFC 9562 variant
+	h := hex.EncodeToString(u[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[:8], h[8:12], h[12:16], h[16:20], h[20:]), nil
+}
+
+type ulids struct {
+	mu     sync.Mutex
+	millis uint64
+	random [10]byte
+}
+
+// NewULIDs returns a generator of ULIDs. IDs from the same generator sort in
+// the order they were handed out, also within a millisecond.
+func NewULIDs() IDGenerator {
+	return &ulids{}
+}
+
+// crockford is the base 32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulids) NextID(context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	millis := uint64(time.Now().UnixMilli())
+	if millis > g.millis {
+		if _, err := rand.Read(g.random[:]); err != nil {
+			return "", err
+		}
+		g.millis = millis
+	} else if !increment(g.random[:]) {
+		// the random part ran over within one millisecond; borrow the next
+		g.millis++
+	}
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], g.millis<<16)
+	copy(id[6:], g.random[:])
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
+
+// increment adds one to the big-endian number b, reporting false if it
+// wrapped around to zero.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// putMillis writes the Unix milliseconds of t to the six bytes of b.
+func putMillis(b []byte, t time.Time) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(b, ms[2:])
+}
+
+// NewIDGenerator returns the generator strategy names: "uuid", "ulid", or
+// "sequence" for sequence.
+func NewIDGenerator(strategy string, sequence IDGenerator) (IDGenerator, error) {
+	switch strategy {
+	case "sequence":
+		return sequence, nil
+	case "uuid":
+		return NewUUIDs(), nil
+	case "ulid":
+		return NewULIDs(), nil
+	}
+	return nil, fmt.Errorf("unknown task ID strategy %q", strategy)
+}
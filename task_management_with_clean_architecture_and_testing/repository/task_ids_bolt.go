@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltSequence struct {
+	db *bolt.DB
+}
+
+// NewBoltSequence returns the sequence of the tasks bucket of db. It is
+// persisted with the data, so IDs keep increasing across restarts and are
+// never reused after a delete.
+func NewBoltSequence(db *bolt.DB) IDGenerator {
+	return &boltSequence{db: db}
+}
+
+func (s *boltSequence) NextID(context.Context) (string, error) {
+	var seq uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		seq, err = tx.Bucket(tasksBucket).NextSequence()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(seq, 10), nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+)
+
+type inMemorySequence struct {
+	last atomic.Int64
+}
+
+// NewInMemorySequence returns a sequence counted in process memory, starting
+// after last.
+func NewInMemorySequence(last int64) IDGenerator {
+	s := &inMemorySequence{}
+	s.last.Store(last)
+	return s
+}
+
+func (s *inMemorySequence) NextID(context.Context) (string, error) {
+	return strconv.FormatInt(s.last.Add(1), 10), nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+
+	"task_with_clean_arc_and_test/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// collectIDs takes n IDs from ids on as many goroutines.
+func collectIDs(t *testing.T, ids IDGenerator, n int) []string {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		got  []string
+		errs []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := ids.NextID(context.Background())
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, id)
+			errs = append(errs, err)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	return got
+}
+
+func TestIDGeneratorsAreUniqueUnderConcurrency(t *testing.T) {
+	db := openTestBolt(t)
+	for name, ids := range map[string]IDGenerator{
+		"memory": NewInMemorySequence(0),
+		"bolt":   NewBoltSequence(db),
+		"uuid":   NewUUIDs(),
+		"ulid":   NewULIDs(),
+	} {
+		seen := make(map[string]bool)
+		for _, id := range collectIDs(t, ids, 100) {
+			assert.False(t, seen[id], "%s handed out %s twice", name, id)
+			seen[id] = true
+		}
+	}
+}
+
+func TestInMemorySequenceContinuesAfterLast(t *testing.T) {
+	ids := NewInMemorySequence(41)
+	id, err := ids.NextID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "42", id)
+}
+
+func TestUUIDsAreVersion7(t *testing.T) {
+	id, err := NewUUIDs().NextID(context.Background())
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+}
+
+func TestULIDsSortInOrder(t *testing.T) {
+	ids := NewULIDs()
+	var got []string
+	for i := 0; i < 1000; i++ {
+		id, err := ids.NextID(context.Background())
+		require.NoError(t, err)
+		require.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, id)
+		got = append(got, id)
+	}
+	assert.True(t, sort.StringsAreSorted(got))
+}
+
+func TestNewIDGenerator(t *testing.T) {
+	sequence := NewInMemorySequence(0)
+	ids, err := NewIDGenerator("sequence", sequence)
+	require.NoError(t, err)
+	assert.Same(t, sequence, ids)
+
+	for _, strategy := range []string{"uuid", "ulid"} {
+		ids, err := NewIDGenerator(strategy, sequence)
+		assert.NoError(t, err)
+		assert.NotNil(t, ids)
+	}
+
+	_, err = NewIDGenerator("random", sequence)
+	assert.Error(t, err)
+}
+
+func TestTasksWithULIDsListInInsertionOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryTaskRepository(NewULIDs())
+	for _, title := range []string{"Task 1", "Task 2", "Task 3"} {
+		require.NoError(t, repo.Add(ctx, domain.Task{Title: title, Description: "Description"}))
+	}
+
+	tasks, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 3)
+	for i, title := range []string{"Task 1", "Task 2", "Task 3"} {
+		assert.Equal(t, title, tasks[i].Title)
+		assert.Len(t, tasks[i].ID, 26)
+	}
+}
+
+func TestSortTasksByIDPutsNumbersFirst(t *testing.T) {
+	tasks := []domain.Task{{ID: "b"}, {ID: "10"}, {ID: "a"}, {ID: "9"}}
+	sortTasksByID(tasks)
+	assert.Equal(t, []string{"9", "10", "a", "b"}, taskIDs(tasks))
+}
+
+func TestAddRefusesAnIDInUse(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryTaskRepository(NewInMemorySequence(0))
+	require.NoError(t, repo.Add(ctx, domain.Task{Title: "Task 1", Description: "Description"}))
+
+	// a second generator restarts the sequence, as after a restart without state
+	repo.(*inMemoryTaskRepository).ids = NewInMemorySequence(0)
+	err := repo.Add(ctx, domain.Task{Title: "Task 2", Description: "Description"})
+	assert.ErrorIs(t, err, ErrDuplicateTaskID)
+	// clients get a conflict rather than an internal error
+	var domainErr *domain.Error
+	require.ErrorAs(t, err, &domainErr)
+	assert.Equal(t, domain.KindConflict, domainErr.Kind)
+}
+
+func TestMigrateMongoContinuesNumericIDs(t *testing.T) {
+	ctx := context.Background()
+	client := mongoTestClient(t)
+	db := client.Database("task_manager")
+	require.NoError(t, db.Collection("tasks").Drop(ctx))
+	clearCollection(t, client, countersCollection)
+
+	// "9" sorts above "10" as a string, and two creates once raced to "10"
+	_, err := db.Collection("tasks").InsertMany(ctx, []any{
+		bson.M{"id": "9", "title": "Nine"},
+		bson.M{"id": "10", "title": "Ten"},
+		bson.M{"id": "10", "title": "Also ten"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, MigrateMongo(ctx, db))
+	// running it again changes nothing
+	require.NoError(t, MigrateMongo(ctx, db))
+
+	repo := NewTaskRepository(db, NewMongoSequence(db, TaskSequence))
+	task, err := repo.GetOne(ctx, "11")
+	require.NoError(t, err)
+	assert.Equal(t, "Also ten", task.Title)
+
+	require.NoError(t, repo.Add(ctx, domain.Task{Title: "Twelve", Description: "Description"}))
+	task, err = repo.GetOne(ctx, "12")
+	require.NoError(t, err)
+	assert.Equal(t, "Twelve", task.Title)
+
+	_, err = db.Collection("tasks").InsertOne(ctx, bson.M{"id": "12"})
+	assert.Error(t, err, "the unique index refuses a second task 12")
+}
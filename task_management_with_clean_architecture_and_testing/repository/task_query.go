@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+// taskCursor is the keyset position after the last task of a page: the sort
+// key of that task plus its ID as a tie-breaker. It is handed to clients as
+// opaque base64.
+type taskCursor struct {
+	Sort string    `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	Time time.Time `json:"t,omitempty"` // due date or creation time
+	Rank int       `json:"r,omitempty"` // priority rank
+	ID   string    `json:"id"`
+}
+
+// taskCursorAt returns the position of task in the ordering of query.
+func taskCursorAt(query domain.TaskQuery, task domain.Task) taskCursor {
+	c := taskCursor{Sort: query.SortBy, Desc: query.Descending, ID: task.ID}
+	switch query.SortBy {
+	case domain.SortByPriority:
+		c.Rank = task.Priority.Rank()
+	case domain.SortByDueDate:
+		c.Time = task.DueDate
+	default:
+		c.Time = task.CreatedAt
+	}
+	return c
+}
+
+func encodeTaskCursor(c taskCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTaskCursor parses query.Cursor, rejecting cursors issued for a
+// different ordering.
+func decodeTaskCursor(query domain.TaskQuery) (taskCursor, error) {
+	var c taskCursor
+	data, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return c, domain.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, domain.ErrInvalidCursor
+	}
+	if c.Sort != query.SortBy || c.Desc != query.Descending || c.ID == "" {
+		return c, domain.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// compareToCursor orders task against the position c in the direction of the
+// listing: negative when task comes first, positive when it comes after.
+func compareToCursor(task domain.Task, c taskCursor) int {
+	cmp := compareTaskKey(task, c)
+	if cmp == 0 {
+		cmp = strings.Compare(task.ID, c.ID)
+	}
+	if c.Desc {
+		return -cmp
+	}
+	return cmp
+}
+
+// compareTaskKey compares the sort key of task with the one of c.
+func compareTaskKey(task domain.Task, c taskCursor) int {
+	if c.Sort == domain.SortByPriority {
+		return compareInts(task.Priority.Rank(), c.Rank)
+	}
+	key := task.CreatedAt
+	if c.Sort == domain.SortByDueDate {
+		key = task.DueDate
+	}
+	switch {
+	case key.Before(c.Time):
+		return -1
+	case key.After(c.Time):
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matchesTaskQuery reports whether task passes the filters of query.
+func matchesTaskQuery(task domain.Task, query domain.TaskQuery) bool {
+	if (task.Deleted != nil) != query.Trashed {
+		return false
+	}
+	if query.Status != "" {
+		if status, err := domain.NormalizeStatus(task.Status); err != nil || status != query.Status {
+			return false
+		}
+	}
+	if query.Assignee != "" && task.Assignee != query.Assignee {
+		return false
+	}
+	if query.HasDueRange() {
+		if task.DueDate.IsZero() {
+			return false
+		}
+		if !query.DueAfter.IsZero() && task.DueDate.Before(query.DueAfter) {
+			return false
+		}
+		if !query.DueBefore.IsZero() && task.DueDate.After(query.DueBefore) {
+			return false
+		}
+	}
+	if query.VisibleTo != "" && task.Owner != query.VisibleTo && task.Assignee != query.VisibleTo {
+		return false
+	}
+	if query.Text != "" {
+		text := strings.ToLower(query.Text)
+		if !strings.Contains(strings.ToLower(task.Title), text) &&
+			!strings.Contains(strings.ToLower(task.Description), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryTasks evaluates query over a full set of tasks. The memory and bolt
+// backends hold every task in reach anyway, so they share this instead of
+// building an index.
+func queryTasks(tasks []domain.Task, query domain.TaskQuery) (domain.TaskPage, error) {
+	var after *taskCursor
+	if query.Cursor != "" {
+		c, err := decodeTaskCursor(query)
+		if err != nil {
+			return domain.TaskPage{}, err
+		}
+		after = &c
+	}
+
+	var matched []domain.Task
+	for _, task := range tasks {
+		if matchesTaskQuery(task, query) {
+			matched = append(matched, task)
+		}
+	}
+	page := domain.TaskPage{Total: int64(len(matched)), Tasks: []domain.Task{}}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return compareToCursor(matched[i], taskCursorAt(query, matched[j])) < 0
+	})
+
+	for _, task := range matched {
+		if after != nil && compareToCursor(task, *after) <= 0 {
+			continue
+		}
+		if len(page.Tasks) == query.Limit {
+			page.NextCursor = encodeTaskCursor(taskCursorAt(query, page.Tasks[len(page.Tasks)-1]))
+			break
+		}
+		page.Tasks = append(page.Tasks, task)
+	}
+	return page, nil
+}
+
+// liveTasks returns the tasks of tasks outside the trash.
+func liveTasks(tasks []domain.Task) []domain.Task {
+	var live []domain.Task
+	for _, task := range tasks {
+		if task.Deleted == nil {
+			live = append(live, task)
+		}
+	}
+	return live
+}
+
+// trashedBefore reports whether task was moved to the trash before before.
+func trashedBefore(task domain.Task, before time.Time) bool {
+	return task.Deleted != nil && task.Deleted.At.Before(before)
+}
+
+// reassignTask replaces from as owner and assignee of task with to, reporting
+// whether anything changed.
+func reassignTask(task *domain.Task, from, to string, updatedAt time.Time) bool {
+	changed := false
+	if task.Owner == from {
+		task.Owner = to
+		changed = true
+	}
+	if task.Assignee == from {
+		task.Assignee = to
+		changed = true
+	}
+	if changed {
+		task.UpdatedAt = updatedAt
+		task.Version++
+	}
+	return changed
+}
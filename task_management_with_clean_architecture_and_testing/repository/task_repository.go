@@ -3,51 +3,83 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
-	"strconv"
+	"regexp"
 	"task_with_clean_arc_and_test/domain"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// TaskRepository stores tasks. Every change but Add counts up the version of
+// the task it changes. Tasks in the trash are left out of everything but
+// Find of the trash, Restore, Purge and ReassignUser.
 type TaskRepository interface {
-	GetOne(id string) (domain.Task, error)
-	GetAll() ([]domain.Task, error)
-	Add(task domain.Task) error
-	Delete(id string) error
-	Update(id string, task domain.Task) error
+	GetOne(ctx context.Context, id string) (domain.Task, error)
+	GetAll(ctx context.Context) ([]domain.Task, error)
+	// Find returns the page of tasks selected by query, which must already be
+	// normalised.
+	Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error)
+	Add(ctx context.Context, task domain.Task) error
+	// Trash moves the task to the trash, recording deletion, only if its
+	// stored version is still version, returning ErrVersionMismatch otherwise.
+	Trash(ctx context.Context, id string, version int64, deletion domain.Deletion) error
+	// Restore takes the task out of the trash and returns it, or
+	// ErrNotInTrash if it is not there.
+	Restore(ctx context.Context, id string, updatedAt time.Time) (domain.Task, error)
+	// Purge removes the tasks moved to the trash before before for good,
+	// returning how many it removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// Update replaces the editable fields of the task only if its stored
+	// version is still version, returning ErrVersionMismatch otherwise.
+	Update(ctx context.Context, id string, version int64, task domain.Task) error
+	// SetStatus moves the task to status only if its stored status is still
+	// expected, returning ErrStatusChanged otherwise.
+	SetStatus(ctx context.Context, id, expected, status string, updatedAt time.Time) error
+	// ReassignUser hands every task owned by or assigned to from over to to,
+	// which may be empty to leave them without owner or assignee. It returns
+	// how many tasks changed.
+	ReassignUser(ctx context.Context, from, to string, updatedAt time.Time) (int64, error)
 }
 
 type taskRepository struct {
 	collection *mongo.Collection
+	ids        IDGenerator
 }
 
-func NewTaskRepository(client *mongo.Client) TaskRepository {
+// NewTaskRepository returns a TaskRepository storing tasks in the tasks
+// collection of db. New tasks get their IDs from ids, usually
+// NewMongoSequence(db, TaskSequence), once MigrateMongo has prepared db.
+func NewTaskRepository(db *mongo.Database, ids IDGenerator) TaskRepository {
 	return &taskRepository{
-		collection: client.Database("task_manager").Collection("tasks"),
+		collection: db.Collection("tasks"),
+		ids:        ids,
 	}
 }
 
-func (r *taskRepository) GetOne(id string) (domain.Task, error) {
-	filter := bson.D{{Key: "id", Value: id}}
+// mongoLive matches the tasks outside the trash. Tasks stored before the
+// trash existed have no deleted field, which matches null.
+var mongoLive = bson.E{Key: "deleted", Value: nil}
+
+func (r *taskRepository) GetOne(ctx context.Context, id string) (domain.Task, error) {
+	filter := bson.D{{Key: "id", Value: id}, mongoLive}
 	var res domain.Task
-	err := r.collection.FindOne(context.TODO(), filter).Decode(&res)
+	err := r.collection.FindOne(ctx, filter).Decode(&res)
 	return res, err
 }
 
-func (r *taskRepository) GetAll() ([]domain.Task, error) {
+func (r *taskRepository) GetAll(ctx context.Context) ([]domain.Task, error) {
 	findOption := options.Find()
 	var tasks []domain.Task
-	curr, err := r.collection.Find(context.TODO(), bson.D{{}}, findOption) // the filter is not applied to get the whole task
+	curr, err := r.collection.Find(ctx, bson.D{mongoLive}, findOption)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for curr.Next(context.TODO()) { //iterates till nothing is left
+	for curr.Next(ctx) { //iterates till nothing is left
 		var element domain.Task
 		err := curr.Decode(&element)
 		if err != nil {
@@ -58,67 +90,248 @@ func (r *taskRepository) GetAll() ([]domain.Task, error) {
 	return tasks, nil
 }
 
-func (r *taskRepository) Add(task domain.Task) error {
-	// Retrieve all tasks and sort them by ID in descending order
-	opts := options.Find().SetSort(bson.D{{Key: "id", Value: -1}})
-	cursor, err := r.collection.Find(context.TODO(), bson.D{}, opts)
+func (r *taskRepository) Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error) {
+	filter := mongoTaskFilter(query)
+	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return err
+		return domain.TaskPage{}, err
 	}
-	defer cursor.Close(context.TODO())
-
-	// Initialize the LastID
-	LastID := 0
 
-	// Iterate through the tasks to find the highest ID
-	for cursor.Next(context.TODO()) {
-		var existingTask domain.Task
-		if err := cursor.Decode(&existingTask); err != nil {
-			return err
+	direction, op := 1, "$gt"
+	if query.Descending {
+		direction, op = -1, "$lt"
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"_sortkey": mongoSortKey(query.SortBy)}}},
+	}
+	if query.Cursor != "" {
+		c, err := decodeTaskCursor(query)
+		if err != nil {
+			return domain.TaskPage{}, err
+		}
+		var key interface{} = c.Time
+		if query.SortBy == domain.SortByPriority {
+			key = c.Rank
 		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"_sortkey": bson.M{op: key}},
+			bson.M{"_sortkey": key, "id": bson.M{op: c.ID}},
+		}}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_sortkey", Value: direction}, {Key: "id", Value: direction}}}},
+		bson.D{{Key: "$limit", Value: query.Limit + 1}}, // one extra to learn whether another page follows
+	)
 
-		// Convert the existing ID to an integer
-		id, err := strconv.Atoi(existingTask.ID)
-		if err != nil {
-			return err
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return domain.TaskPage{}, err
+	}
+	tasks := []domain.Task{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return domain.TaskPage{}, err
+	}
+
+	page := domain.TaskPage{Tasks: tasks, Total: total}
+	if len(tasks) > query.Limit {
+		page.Tasks = tasks[:query.Limit]
+		page.NextCursor = encodeTaskCursor(taskCursorAt(query, page.Tasks[query.Limit-1]))
+	}
+	return page, nil
+}
+
+// mongoTaskFilter translates the filters of query into a match document.
+func mongoTaskFilter(query domain.TaskQuery) bson.D {
+	filter := bson.D{mongoLive}
+	if query.Trashed {
+		filter = bson.D{{Key: "deleted", Value: bson.M{"$ne": nil}}}
+	}
+	if query.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: bson.M{"$in": domain.StatusSpellings(query.Status)}})
+	}
+	if query.Assignee != "" {
+		filter = append(filter, bson.E{Key: "assignee", Value: query.Assignee})
+	}
+	if query.HasDueRange() {
+		due := bson.M{"$gt": time.Time{}} // tasks without a due date never match a range
+		if !query.DueAfter.IsZero() {
+			due["$gte"] = query.DueAfter
 		}
+		if !query.DueBefore.IsZero() {
+			due["$lte"] = query.DueBefore
+		}
+		filter = append(filter, bson.E{Key: "duedate", Value: due})
+	}
+	// alternatives go under $and, since a document can hold only one $or
+	var alternatives bson.A
+	if query.VisibleTo != "" {
+		alternatives = append(alternatives, bson.M{"$or": bson.A{
+			bson.M{"owner": query.VisibleTo},
+			bson.M{"assignee": query.VisibleTo},
+		}})
+	}
+	if query.Text != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+		alternatives = append(alternatives, bson.M{"$or": bson.A{
+			bson.M{"title": pattern},
+			bson.M{"description": pattern},
+		}})
+	}
+	if len(alternatives) > 0 {
+		filter = append(filter, bson.E{Key: "$and", Value: alternatives})
+	}
+	return filter
+}
 
-		// Update LastID if the current ID is higher
-		if id > LastID {
-			LastID = id
+// mongoSortKey computes the value tasks are ordered by. Times default to the
+// zero time so documents written before the field existed still page
+// correctly, and priorities are ranked rather than compared as strings.
+func mongoSortKey(sortBy string) interface{} {
+	switch sortBy {
+	case domain.SortByPriority:
+		var branches bson.A
+		for _, p := range []domain.Priority{domain.PriorityLow, domain.PriorityNormal, domain.PriorityHigh, domain.PriorityUrgent} {
+			branches = append(branches, bson.M{"case": bson.M{"$eq": bson.A{"$priority", p}}, "then": p.Rank()})
 		}
+		return bson.M{"$switch": bson.M{"branches": branches, "default": 0}}
+	case domain.SortByDueDate:
+		return bson.M{"$ifNull": bson.A{"$duedate", time.Time{}}}
+	default:
+		return bson.M{"$ifNull": bson.A{"$createdat", time.Time{}}}
 	}
+}
 
-	// Increment the LastID to get the new ID
-	LastID++
-	task.ID = strconv.Itoa(LastID)
-	task.Status = "Pending"
-	task.DueDate = time.Now()
-	if task.Title == "" || task.Description == "" {
-		return errors.New("please provide a title and description")
+func (r *taskRepository) Add(ctx context.Context, task domain.Task) error {
+	id, err := r.ids.NextID(ctx)
+	if err != nil {
+		return err
+	}
+	task.ID = id
+	_, err = r.collection.InsertOne(ctx, task)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateTaskID
 	}
-	_, err = r.collection.InsertOne(context.TODO(), task)
 	return err
 }
 
-func (r *taskRepository) Delete(id string) error {
-	result, err := r.collection.DeleteOne(context.TODO(), bson.D{{Key: "id", Value: id}})
-	if result.DeletedCount == 0 {
-		return errors.New("Task not found")
+func (r *taskRepository) Trash(ctx context.Context, id string, version int64, deletion domain.Deletion) error {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "version", Value: mongoVersion(version)}, mongoLive}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{"deleted": deletion}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.missed(ctx, id, ErrTaskNotFound, ErrVersionMismatch)
+	}
+	return nil
+}
+
+func (r *taskRepository) Restore(ctx context.Context, id string, updatedAt time.Time) (domain.Task, error) {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "deleted", Value: bson.M{"$ne": nil}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{"updatedat": updatedAt}},
+		{Key: "$unset", Value: bson.M{"deleted": ""}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var task domain.Task
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.Task{}, ErrNotInTrash
+	}
+	return task, err
+}
+
+func (r *taskRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.D{{Key: "deleted.at", Value: bson.M{"$lt": before}}})
+	if err != nil {
+		return 0, err
 	}
-	return err // deleted success
+	return result.DeletedCount, nil
 }
 
-func (r *taskRepository) Update(id string, task domain.Task) error {
-	filter := bson.D{{Key: "id", Value: id}}
-	update := bson.D{{Key: "$set", Value: bson.M{"title": task.Title, "description": task.Description}}}
-	if task.Title == "" || task.Description == "" {
-		return errors.New("please provide a title and description")
+func (r *taskRepository) Update(ctx context.Context, id string, version int64, task domain.Task) error {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "version", Value: mongoVersion(version)}, mongoLive}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{
+			"title":       task.Title,
+			"description": task.Description,
+			"duedate":     task.DueDate,
+			"priority":    task.Priority,
+			"assignee":    task.Assignee,
+			"updatedat":   task.UpdatedAt,
+		}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
 	}
-	result, err := r.collection.UpdateOne(context.TODO(), filter, update)
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("task with id %s not found", id)
+		return r.missed(ctx, id, taskWithIDNotFound(id), ErrVersionMismatch)
 	}
+	return nil
+}
 
-	return err // returns nill if the task is in there
+func (r *taskRepository) SetStatus(ctx context.Context, id, expected, status string, updatedAt time.Time) error {
+	filter := bson.D{{Key: "id", Value: id}, {Key: "status", Value: expected}, mongoLive}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{"status": status, "updatedat": updatedAt}},
+		{Key: "$inc", Value: bson.M{"version": 1}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.missed(ctx, id, ErrTaskNotFound, ErrStatusChanged)
+	}
+	return nil
+}
+
+// missed tells why a conditional write matched no task: notFound if there is
+// no task with id outside the trash, changed if the task no longer is as the
+// write expected.
+func (r *taskRepository) missed(ctx context.Context, id string, notFound, changed error) error {
+	count, err := r.collection.CountDocuments(ctx, bson.D{{Key: "id", Value: id}, mongoLive})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return changed
+}
+
+// mongoVersion matches tasks at version. Tasks stored before versions were
+// counted have none, and are at version 0.
+func mongoVersion(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+func (r *taskRepository) ReassignUser(ctx context.Context, from, to string, updatedAt time.Time) (int64, error) {
+	filter := bson.D{{Key: "$or", Value: bson.A{bson.M{"owner": from}, bson.M{"assignee": from}}}}
+	// a pipeline update, so a task both owned and assigned changes once
+	replace := func(field string) bson.M {
+		return bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$" + field, from}}, to, "$" + field}}
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"owner":     replace("owner"),
+		"assignee":  replace("assignee"),
+		"updatedat": updatedAt,
+		"version":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+	}}}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
 }
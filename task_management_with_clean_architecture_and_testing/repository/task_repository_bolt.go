@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type boltTaskRepository struct {
+	db  *bolt.DB
+	ids IDGenerator
+}
+
+// NewBoltTaskRepository returns a TaskRepository that persists tasks as JSON
+// in the tasks bucket of db, keyed by task ID. New tasks get their IDs from
+// ids, usually NewBoltSequence(db).
+func NewBoltTaskRepository(db *bolt.DB, ids IDGenerator) TaskRepository {
+	return &boltTaskRepository{db: db, ids: ids}
+}
+
+func (r *boltTaskRepository) GetOne(ctx context.Context, id string) (domain.Task, error) {
+	var task domain.Task
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		task, err = getLiveTask(tx.Bucket(tasksBucket), id, mongo.ErrNoDocuments) // same error the Mongo backend surfaces
+		return err
+	})
+	if err != nil {
+		return domain.Task{}, err
+	}
+	return task, nil
+}
+
+// getLiveTask reads the task id from bucket, returning notFound if there is
+// none outside the trash.
+func getLiveTask(bucket *bolt.Bucket, id string, notFound error) (domain.Task, error) {
+	var task domain.Task
+	data := bucket.Get([]byte(id))
+	if data == nil {
+		return task, notFound
+	}
+	if err := json.Unmarshal(data, &task); err != nil {
+		return task, err
+	}
+	if task.Deleted != nil {
+		return task, notFound
+	}
+	return task, nil
+}
+
+func (r *boltTaskRepository) GetAll(ctx context.Context) ([]domain.Task, error) {
+	tasks, err := r.all()
+	if err != nil {
+		return nil, err
+	}
+	return liveTasks(tasks), nil
+}
+
+// all returns every task, the trash included, in order of ID.
+func (r *boltTaskRepository) all() ([]domain.Task, error) {
+	var tasks []domain.Task
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(_, data []byte) error {
+			var task domain.Task
+			if err := json.Unmarshal(data, &task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// keys sort as strings ("10" before "2"), so restore numeric order
+	sortTasksByID(tasks)
+	return tasks, nil
+}
+
+func (r *boltTaskRepository) Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error) {
+	tasks, err := r.all()
+	if err != nil {
+		return domain.TaskPage{}, err
+	}
+	return queryTasks(tasks, query)
+}
+
+func (r *boltTaskRepository) Add(ctx context.Context, task domain.Task) error {
+	// bolt has a single writer, so the ID is taken before the transaction
+	// that stores the task rather than within it
+	id, err := r.ids.NextID(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		if bucket.Get([]byte(id)) != nil {
+			return ErrDuplicateTaskID
+		}
+		task.ID = id
+		return putJSON(bucket, task.ID, task)
+	})
+}
+
+func (r *boltTaskRepository) Trash(ctx context.Context, id string, version int64, deletion domain.Deletion) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		existing, err := getLiveTask(bucket, id, ErrTaskNotFound)
+		if err != nil {
+			return err
+		}
+		if existing.Version != version {
+			return ErrVersionMismatch
+		}
+		existing.Deleted = &deletion
+		existing.Version++
+		return putJSON(bucket, id, existing)
+	})
+}
+
+func (r *boltTaskRepository) Restore(ctx context.Context, id string, updatedAt time.Time) (domain.Task, error) {
+	var task domain.Task
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrNotInTrash
+		}
+		if err := json.Unmarshal(data, &task); err != nil {
+			return err
+		}
+		if task.Deleted == nil {
+			return ErrNotInTrash
+		}
+		task.Deleted = nil
+		task.UpdatedAt = updatedAt
+		task.Version++
+		return putJSON(bucket, id, task)
+	})
+	if err != nil {
+		return domain.Task{}, err
+	}
+	return task, nil
+}
+
+func (r *boltTaskRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var purged [][]byte
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		// the bucket must not change while ForEach walks it
+		err := bucket.ForEach(func(key, data []byte) error {
+			var task domain.Task
+			if err := json.Unmarshal(data, &task); err != nil {
+				return err
+			}
+			if trashedBefore(task, before) {
+				purged = append(purged, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range purged {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+func (r *boltTaskRepository) Update(ctx context.Context, id string, version int64, task domain.Task) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		existing, err := getLiveTask(bucket, id, taskWithIDNotFound(id))
+		if err != nil {
+			return err
+		}
+		if existing.Version != version {
+			return ErrVersionMismatch
+		}
+		existing.Title = task.Title
+		existing.Description = task.Description
+		existing.DueDate = task.DueDate
+		existing.Priority = task.Priority
+		existing.Assignee = task.Assignee
+		existing.UpdatedAt = task.UpdatedAt
+		existing.Version++
+		return putJSON(bucket, id, existing)
+	})
+}
+
+func (r *boltTaskRepository) SetStatus(ctx context.Context, id, expected, status string, updatedAt time.Time) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		task, err := getLiveTask(bucket, id, ErrTaskNotFound)
+		if err != nil {
+			return err
+		}
+		if task.Status != expected {
+			return ErrStatusChanged
+		}
+		task.Status = status
+		task.UpdatedAt = updatedAt
+		task.Version++
+		return putJSON(bucket, id, task)
+	})
+}
+
+func (r *boltTaskRepository) ReassignUser(ctx context.Context, from, to string, updatedAt time.Time) (int64, error) {
+	var changed []domain.Task
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		// the bucket must not change while ForEach walks it
+		err := bucket.ForEach(func(_, data []byte) error {
+			var task domain.Task
+			if err := json.Unmarshal(data, &task); err != nil {
+				return err
+			}
+			if reassignTask(&task, from, to, updatedAt) {
+				changed = append(changed, task)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, task := range changed {
+			if err := putJSON(bucket, task.ID, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(changed)), nil
+}
+
+// putJSON stores v under key in bucket.
+func putJSON(bucket *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
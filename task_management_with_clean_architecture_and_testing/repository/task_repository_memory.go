@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type inMemoryTaskRepository struct {
+	mu    sync.RWMutex
+	tasks map[string]domain.Task
+	ids   IDGenerator
+}
+
+// NewInMemoryTaskRepository returns a TaskRepository that keeps tasks in
+// process memory. It behaves like the Mongo implementation and is meant for
+// local runs and tests where no database is available. New tasks get their
+// IDs from ids, usually NewInMemorySequence(0).
+func NewInMemoryTaskRepository(ids IDGenerator) TaskRepository {
+	return &inMemoryTaskRepository{
+		tasks: make(map[string]domain.Task),
+		ids:   ids,
+	}
+}
+
+func (r *inMemoryTaskRepository) GetOne(ctx context.Context, id string) (domain.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok || task.Deleted != nil {
+		return domain.Task{}, mongo.ErrNoDocuments // same error the Mongo backend surfaces
+	}
+	return task, nil
+}
+
+func (r *inMemoryTaskRepository) GetAll(ctx context.Context) ([]domain.Task, error) {
+	return liveTasks(r.all()), nil
+}
+
+// all returns every task, the trash included, in order of ID.
+func (r *inMemoryTaskRepository) all() []domain.Task {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tasks []domain.Task
+	for _, task := range r.tasks {
+		tasks = append(tasks, task)
+	}
+	sortTasksByID(tasks)
+	return tasks
+}
+
+// sortTasksByID orders tasks by ID, numeric IDs by number and before the
+// others. Sequences, UUIDs and ULIDs all grow over time, so this keeps
+// insertion order the way a Mongo collection scan does.
+func sortTasksByID(tasks []domain.Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		a, aErr := strconv.ParseUint(tasks[i].ID, 10, 64)
+		b, bErr := strconv.ParseUint(tasks[j].ID, 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			return a < b
+		case aErr == nil || bErr == nil:
+			return aErr == nil
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+}
+
+func (r *inMemoryTaskRepository) Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error) {
+	return queryTasks(r.all(), query)
+}
+
+func (r *inMemoryTaskRepository) Add(ctx context.Context, task domain.Task) error {
+	id, err := r.ids.NextID(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[id]; ok {
+		return ErrDuplicateTaskID
+	}
+	task.ID = id
+	r.tasks[task.ID] = task
+	return nil
+}
+
+func (r *inMemoryTaskRepository) Trash(ctx context.Context, id string, version int64, deletion domain.Deletion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tasks[id]
+	if !ok || existing.Deleted != nil {
+		return ErrTaskNotFound
+	}
+	if existing.Version != version {
+		return ErrVersionMismatch
+	}
+	existing.Deleted = &deletion
+	existing.Version++
+	r.tasks[id] = existing
+	return nil
+}
+
+func (r *inMemoryTaskRepository) Restore(ctx context.Context, id string, updatedAt time.Time) (domain.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok || task.Deleted == nil {
+		return domain.Task{}, ErrNotInTrash
+	}
+	task.Deleted = nil
+	task.UpdatedAt = updatedAt
+	task.Version++
+	r.tasks[id] = task
+	return task, nil
+}
+
+func (r *inMemoryTaskRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, task := range r.tasks {
+		if trashedBefore(task, before) {
+			delete(r.tasks, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *inMemoryTaskRepository) Update(ctx context.Context, id string, version int64, task domain.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tasks[id]
+	if !ok || existing.Deleted != nil {
+		return taskWithIDNotFound(id)
+	}
+	if existing.Version != version {
+		return ErrVersionMismatch
+	}
+	existing.Title = task.Title
+	existing.Description = task.Description
+	existing.DueDate = task.DueDate
+	existing.Priority = task.Priority
+	existing.Assignee = task.Assignee
+	existing.UpdatedAt = task.UpdatedAt
+	existing.Version++
+	r.tasks[id] = existing
+	return nil
+}
+
+func (r *inMemoryTaskRepository) SetStatus(ctx context.Context, id, expected, status string, updatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok || task.Deleted != nil {
+		return ErrTaskNotFound
+	}
+	if task.Status != expected {
+		return ErrStatusChanged
+	}
+	task.Status = status
+	task.UpdatedAt = updatedAt
+	task.Version++
+	r.tasks[id] = task
+	return nil
+}
+
+func (r *inMemoryTaskRepository) ReassignUser(ctx context.Context, from, to string, updatedAt time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed int64
+	for id, task := range r.tasks {
+		if reassignTask(&task, from, to, updatedAt) {
+			r.tasks[id] = task
+			changed++
+		}
+	}
+	return changed, nil
+}
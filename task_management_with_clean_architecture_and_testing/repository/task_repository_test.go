@@ -25,9 +25,10 @@ func (suite *TaskRepositoryTestSuite) SetupSuite() {
 	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	suite.NoError(err)
+	skipIfMongoUnavailable(suite.T(), client)
 	suite.client = client
 	suite.collection = client.Database("task_manager").Collection("tasks")
-	suite.repo = NewTaskRepository(client)
+	suite.repo = NewTaskRepository(client.Database("task_manager"), NewMongoSequence(client.Database("task_manager"), TaskSequence))
 }
 
 func (suite *TaskRepositoryTestSuite) TearDownSuite() {
@@ -45,17 +46,19 @@ func (suite *TaskRepositoryTestSuite) SetupTest() {
 }
 
 func (suite *TaskRepositoryTestSuite) TestGetOne() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
 	_, err := suite.collection.InsertOne(context.TODO(), task)
 	suite.NoError(err)
 
-	result, err := suite.repo.GetOne("1")
+	result, err := suite.repo.GetOne(ctx, "1")
 	suite.NoError(err)
 	suite.Equal(task.ID, result.ID)
 	suite.Equal(task.Title, result.Title)
 }
 
 func (suite *TaskRepositoryTestSuite) TestGetAll() {
+	ctx := context.Background()
 	tasks := []domain.Task{
 		{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"},
 		{ID: "2", Title: "Task 2", Description: "Description 2", DueDate: time.Now(), Status: "Completed"},
@@ -65,14 +68,15 @@ func (suite *TaskRepositoryTestSuite) TestGetAll() {
 		suite.NoError(err)
 	}
 
-	results, err := suite.repo.GetAll()
+	results, err := suite.repo.GetAll(ctx)
 	suite.NoError(err)
 	suite.Len(results, 2)
 }
 
 func (suite *TaskRepositoryTestSuite) TestAdd() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
-	err := suite.repo.Add(task)
+	err := suite.repo.Add(ctx, task)
 	suite.NoError(err)
 
 	var result domain.Task
@@ -81,26 +85,37 @@ func (suite *TaskRepositoryTestSuite) TestAdd() {
 	suite.Equal(task.ID, result.ID)
 }
 
-func (suite *TaskRepositoryTestSuite) TestDelete() {
-	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
-	_, err := suite.collection.InsertOne(context.TODO(), task)
+func (suite *TaskRepositoryTestSuite) TestTrashAndPurge() {
+	ctx := context.Background()
+	// stored before the trash existed, without a deleted field
+	_, err := suite.collection.InsertOne(context.TODO(), bson.M{"id": "1", "title": "Task 1", "description": "Description 1"})
 	suite.NoError(err)
 
-	err = suite.repo.Delete("1")
+	err = suite.repo.Trash(ctx, "1", 0, domain.Deletion{By: "admin", At: time.Now()})
 	suite.NoError(err)
 
+	var stored bson.M
+	err = suite.collection.FindOne(context.TODO(), bson.D{{Key: "id", Value: "1"}}).Decode(&stored)
+	suite.NoError(err)
+	suite.Equal("admin", stored["deleted"].(bson.M)["by"])
+
+	purged, err := suite.repo.Purge(ctx, time.Now().Add(time.Minute))
+	suite.NoError(err)
+	suite.Equal(int64(1), purged)
+
 	count, err := suite.collection.CountDocuments(context.TODO(), bson.D{{Key: "id", Value: "1"}})
 	suite.NoError(err)
 	suite.Equal(int64(0), count)
 }
 
 func (suite *TaskRepositoryTestSuite) TestUpdate() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
 	_, err := suite.collection.InsertOne(context.TODO(), task)
 	suite.NoError(err)
 
 	updatedTask := domain.Task{Title: "Updated Title", Description: "Updated Description"}
-	err = suite.repo.Update("1", updatedTask)
+	err = suite.repo.Update(ctx, "1", 0, updatedTask)
 	suite.NoError(err)
 
 	var result domain.Task
@@ -111,57 +126,78 @@ func (suite *TaskRepositoryTestSuite) TestUpdate() {
 }
 
 func (suite *TaskRepositoryTestSuite) TestGetOne_NotFound() {
-	result, err := suite.repo.GetOne("13")
+	ctx := context.Background()
+	result, err := suite.repo.GetOne(ctx, "13")
 	suite.Error(err)
 	suite.Equal(domain.Task{}, result)
 }
 
 func (suite *TaskRepositoryTestSuite) TestGetOne_InvalidIDFormat() {
-	result, err := suite.repo.GetOne("invalid_id_format")
+	ctx := context.Background()
+	result, err := suite.repo.GetOne(ctx, "invalid_id_format")
 	suite.Error(err)
 	suite.Equal(domain.Task{}, result)
 }
 
 func (suite *TaskRepositoryTestSuite) TestGetAll_EmptyCollection() {
+	ctx := context.Background()
 	// Ensure the collection is empty
 	err := suite.collection.Drop(context.TODO())
 	suite.NoError(err)
 
-	result, err := suite.repo.GetAll()
+	result, err := suite.repo.GetAll(ctx)
 
 	// Expect no error but an empty slice
 	suite.NoError(err)
 	suite.Equal(0, len(result))
 }
 
-func (suite *TaskRepositoryTestSuite) TestAdd_InvalidTaskData() {
+// The usecase validates tasks, so the repository stores them as given.
+func (suite *TaskRepositoryTestSuite) TestAdd_LeavesValidationToUsecase() {
+	ctx := context.Background()
 	// Missing Title
-	task := domain.Task{ID: "2", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
-	err := suite.repo.Add(task)
-	suite.Error(err)
+	task := domain.Task{Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
+	err := suite.repo.Add(ctx, task)
+	suite.NoError(err)
+
+	count, err := suite.collection.CountDocuments(context.TODO(), bson.D{{Key: "description", Value: "Description 1"}})
+	suite.NoError(err)
+	suite.Equal(int64(1), count)
 }
 
-func (suite *TaskRepositoryTestSuite) TestDelete_NotFound() {
-	err := suite.repo.Delete("12000")
+func (suite *TaskRepositoryTestSuite) TestTrash_NotFound() {
+	ctx := context.Background()
+	err := suite.repo.Trash(ctx, "12000", 0, domain.Deletion{By: "admin", At: time.Now()})
 	suite.Error(err)
 }
 
-func (suite *TaskRepositoryTestSuite) TestDelete_InvalidIDFormat() {
-	err := suite.repo.Delete("invalid_id_format")
+func (suite *TaskRepositoryTestSuite) TestTrash_InvalidIDFormat() {
+	ctx := context.Background()
+	err := suite.repo.Trash(ctx, "invalid_id_format", 0, domain.Deletion{By: "admin", At: time.Now()})
 	suite.Error(err)
 }
 
 func (suite *TaskRepositoryTestSuite) TestUpdate_NotFound() {
+	ctx := context.Background()
 	task := domain.Task{Title: "Updated Title", Description: "Updated Description"}
-	err := suite.repo.Update("12000", task)
+	err := suite.repo.Update(ctx, "12000", 0, task)
 	suite.Error(err)
 }
 
-func (suite *TaskRepositoryTestSuite) TestUpdate_InvalidTaskData() {
-	// Assuming an ID exists
+func (suite *TaskRepositoryTestSuite) TestUpdate_LeavesValidationToUsecase() {
+	ctx := context.Background()
+	_, err := suite.collection.InsertOne(context.TODO(), domain.Task{ID: "1", Title: "Task 1", Description: "Description 1"})
+	suite.NoError(err)
+
 	task := domain.Task{Title: "", Description: "Updated Description"} // Missing Title
-	err := suite.repo.Update("1", task)
-	suite.Error(err)
+	err = suite.repo.Update(ctx, "1", 0, task)
+	suite.NoError(err)
+
+	var result domain.Task
+	err = suite.collection.FindOne(context.TODO(), bson.D{{Key: "id", Value: "1"}}).Decode(&result)
+	suite.NoError(err)
+	suite.Equal("", result.Title)
+	suite.Equal(task.Description, result.Description)
 }
 
 func TestTaskRepositoryTestSuite(t *testing.T) {
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"encoding/base64"
+	"sort"
+	"task_with_clean_arc_and_test/domain"
+)
+
+// Users are listed by username, which is unique, so the cursor is simply the
+// last username of a page, handed to clients as opaque base64.
+func encodeUserCursor(username string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(username))
+}
+
+func decodeUserCursor(cursor string) (string, error) {
+	username, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(username) == 0 {
+		return "", domain.ErrInvalidCursor
+	}
+	return string(username), nil
+}
+
+// queryUsers evaluates query over a full set of users, for the memory and
+// bolt backends.
+func queryUsers(users []domain.User, query domain.UserQuery) (domain.UserPage, error) {
+	after := ""
+	if query.Cursor != "" {
+		username, err := decodeUserCursor(query.Cursor)
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+		after = username
+	}
+
+	var matched []domain.User
+	for _, user := range users {
+		if query.Matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Username < matched[j].Username })
+
+	page := domain.UserPage{Total: int64(len(matched)), Users: []domain.UserProfile{}}
+	for _, user := range matched {
+		if after != "" && user.Username <= after {
+			continue
+		}
+		if len(page.Users) == query.Limit {
+			page.NextCursor = encodeUserCursor(page.Users[len(page.Users)-1].Username)
+			break
+		}
+		page.Users = append(page.Users, user.Profile())
+	}
+	return page, nil
+}
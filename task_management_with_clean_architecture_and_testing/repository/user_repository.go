@@ -2,115 +2,221 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"task_with_clean_arc_and_test/domain"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository interface {
-	Register(user domain.User) error
-	LoginUser(username string) (domain.User, error)
-	RegisterAdmin(user domain.User) error
-	UpdateUser(username string) error
-	Activate(username string) error
-	Deactivate(username string) error
-	UsernameExists(username string) (bool, error)
+	Register(ctx context.Context, user domain.User) error
+	LoginUser(ctx context.Context, username string) (domain.User, error)
+	RegisterAdmin(ctx context.Context, user domain.User) error
+	SetRole(ctx context.Context, username, role string) error
+	SetAccountStatus(ctx context.Context, username string, status domain.AccountStatus) error
+	SetTwoFactor(ctx context.Context, username string, twoFactor domain.TwoFactor) error
+	SetPassword(ctx context.Context, username, hashedPassword string) error
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	// Find returns the page of users selected by query, which must already be
+	// normalised.
+	Find(ctx context.Context, query domain.UserQuery) (domain.UserPage, error)
+	// Delete removes the user, returning ErrUserDoesNotExist if there is none.
+	Delete(ctx context.Context, username string) error
 }
 
 type userRepository struct {
 	collection *mongo.Collection
 }
 
-func NewUserRepository(client *mongo.Client) UserRepository {
+func NewUserRepository(db *mongo.Database) UserRepository {
 	return &userRepository{
-		collection: client.Database("task_manager").Collection("users"),
+		collection: db.Collection("users"),
 	}
 }
 
-func (r *userRepository) Register(user domain.User) error {
-	exists, err := r.UsernameExists(user.Username)
+func (r *userRepository) Register(ctx context.Context, user domain.User) error {
+	exists, err := r.UsernameExists(ctx, user.Username)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return errors.New("username exists")
+		return ErrUsernameExists
 	}
 
-	_, err = r.collection.InsertOne(context.TODO(), user)
+	// the unique index catches a concurrent registration of the username
+	_, err = r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameExists
+	}
 	return err
 }
 
-func (r *userRepository) RegisterAdmin(user domain.User) error {
-	_, err := r.collection.InsertOne(context.TODO(), user)
+func (r *userRepository) RegisterAdmin(ctx context.Context, user domain.User) error {
+	exists, err := r.UsernameExists(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrUsernameExists
+	}
+
+	// the unique index catches a concurrent registration of the username
+	_, err = r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameExists
+	}
 	return err
 }
 
-func (r *userRepository) Activate(username string) error {
+func (r *userRepository) SetAccountStatus(ctx context.Context, username string, status domain.AccountStatus) error {
 	// Check if the user exists
-	exists, err := r.UsernameExists(username)
+	exists, err := r.UsernameExists(ctx, username)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return errors.New("user does not exist")
+		return ErrUserDoesNotExist
 	}
 
-	// Proceed to activate the user
+	// the legacy flag is dropped once the status is set
 	filter := bson.D{{Key: "username", Value: username}}
-	update := bson.D{{Key: "$set", Value: bson.M{"activate": "true"}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{"status": status}},
+		{Key: "$unset", Value: bson.M{"activate": ""}},
+	}
 
-	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
+	_, err = r.collection.UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (r *userRepository) Deactivate(username string) error {
-	// Check if the user exists
-	exists, err := r.UsernameExists(username)
+func (r *userRepository) SetTwoFactor(ctx context.Context, username string, twoFactor domain.TwoFactor) error {
+	filter := bson.D{{Key: "username", Value: username}}
+	update := bson.D{{Key: "$set", Value: bson.M{"two_factor": twoFactor}}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.New("user does not exist")
+	if result.MatchedCount == 0 {
+		return ErrUserDoesNotExist
 	}
+	return nil
+}
+
+func (r *userRepository) SetPassword(ctx context.Context, username, hashedPassword string) error {
 	filter := bson.D{{Key: "username", Value: username}}
-	update := bson.D{{Key: "$set", Value: bson.M{"activate": "false"}}}
+	update := bson.D{{Key: "$set", Value: bson.M{"password": hashedPassword}}}
 
-	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
-	return err
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserDoesNotExist
+	}
+	return nil
 }
 
-func (r *userRepository) UpdateUser(username string) error {
+func (r *userRepository) SetRole(ctx context.Context, username, role string) error {
 	// Check if the user exists
-	exists, err := r.UsernameExists(username)
+	exists, err := r.UsernameExists(ctx, username)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return errors.New("user does not exist")
+		return ErrUserDoesNotExist
 	}
 	filter := bson.D{{Key: "username", Value: username}}
-	update := bson.D{{Key: "$set", Value: bson.M{"role": "admin"}}}
+	update := bson.D{{Key: "$set", Value: bson.M{"role": role}}}
 
-	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
+	_, err = r.collection.UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (r *userRepository) UsernameExists(username string) (bool, error) {
+func (r *userRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
 	var user domain.User
-	err := r.collection.FindOne(context.TODO(), bson.M{"username": username}).Decode(&user)
+	err := r.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return false, err
 	}
 	return err == nil, nil
 }
 
-func (r *userRepository) LoginUser(username string) (domain.User, error) {
+func (r *userRepository) LoginUser(ctx context.Context, username string) (domain.User, error) {
 	var user domain.User
-	err := r.collection.FindOne(context.TODO(), bson.M{"username": username}).Decode(&user)
+	err := r.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
+
+func (r *userRepository) Find(ctx context.Context, query domain.UserQuery) (domain.UserPage, error) {
+	filter := mongoUserFilter(query)
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+	if query.Cursor != "" {
+		after, err := decodeUserCursor(query.Cursor)
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+		filter = append(filter, bson.E{Key: "username", Value: bson.M{"$gt": after}})
+	}
+
+	// one extra to learn whether another page follows
+	opts := options.Find().SetSort(bson.D{{Key: "username", Value: 1}}).SetLimit(int64(query.Limit + 1))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+	var users []domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return domain.UserPage{}, err
+	}
+
+	page := domain.UserPage{Total: total, Users: []domain.UserProfile{}}
+	for i, user := range users {
+		if i == query.Limit {
+			page.NextCursor = encodeUserCursor(users[i-1].Username)
+			break
+		}
+		page.Users = append(page.Users, user.Profile())
+	}
+	return page, nil
+}
+
+// mongoUserFilter translates the filters of query into a match document.
+func mongoUserFilter(query domain.UserQuery) bson.D {
+	filter := bson.D{}
+	if query.Role != "" {
+		filter = append(filter, bson.E{Key: "role", Value: query.Role})
+	}
+	// users without a status are judged by the legacy flag, as User.Active does
+	switch query.Status {
+	case domain.AccountActive:
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.M{"status.state": domain.AccountActive},
+			bson.M{"status.state": bson.M{"$exists": false}, "activate": bson.M{"$ne": "false"}},
+		}})
+	case domain.AccountDeactivated:
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.M{"status.state": domain.AccountDeactivated},
+			bson.M{"status.state": bson.M{"$exists": false}, "activate": "false"},
+		}})
+	}
+	return filter
+}
+
+func (r *userRepository) Delete(ctx context.Context, username string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserDoesNotExist
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"task_with_clean_arc_and_test/domain"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type boltUserRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltUserRepository returns a UserRepository that persists users as JSON
+// in the users bucket of db. Users are keyed by username, which is what keeps
+// usernames unique.
+func NewBoltUserRepository(db *bolt.DB) UserRepository {
+	return &boltUserRepository{db: db}
+}
+
+func (r *boltUserRepository) Register(ctx context.Context, user domain.User) error {
+	return r.insert(user)
+}
+
+func (r *boltUserRepository) RegisterAdmin(ctx context.Context, user domain.User) error {
+	return r.insert(user)
+}
+
+func (r *boltUserRepository) insert(user domain.User) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		if bucket.Get([]byte(user.Username)) != nil {
+			return ErrUsernameExists
+		}
+		if user.ID.IsZero() {
+			user.ID = primitive.NewObjectID()
+		}
+		return putJSON(bucket, user.Username, user)
+	})
+}
+
+func (r *boltUserRepository) SetAccountStatus(ctx context.Context, username string, status domain.AccountStatus) error {
+	return r.set(username, func(u *domain.User) {
+		u.Status = status
+		u.LegacyActivate = ""
+	})
+}
+
+func (r *boltUserRepository) SetTwoFactor(ctx context.Context, username string, twoFactor domain.TwoFactor) error {
+	return r.set(username, func(u *domain.User) { u.TwoFactor = twoFactor })
+}
+
+func (r *boltUserRepository) SetPassword(ctx context.Context, username, hashedPassword string) error {
+	return r.set(username, func(u *domain.User) { u.Password = hashedPassword })
+}
+
+func (r *boltUserRepository) SetRole(ctx context.Context, username, role string) error {
+	return r.set(username, func(u *domain.User) { u.Role = role })
+}
+
+// set loads the stored user, applies fn and writes it back in one transaction.
+func (r *boltUserRepository) set(username string, fn func(u *domain.User)) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		data := bucket.Get([]byte(username))
+		if data == nil {
+			return ErrUserDoesNotExist
+		}
+		var user domain.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		fn(&user)
+		return putJSON(bucket, username, user)
+	})
+}
+
+func (r *boltUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(usersBucket).Get([]byte(username)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+func (r *boltUserRepository) LoginUser(ctx context.Context, username string) (domain.User, error) {
+	var user domain.User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(usersBucket).Get([]byte(username))
+		if data == nil {
+			return mongo.ErrNoDocuments // same error the Mongo backend surfaces
+		}
+		return json.Unmarshal(data, &user)
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (r *boltUserRepository) Find(ctx context.Context, query domain.UserQuery) (domain.UserPage, error) {
+	var users []domain.User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(_, data []byte) error {
+			var user domain.User
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+	return queryUsers(users, query)
+}
+
+func (r *boltUserRepository) Delete(ctx context.Context, username string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		if bucket.Get([]byte(username)) == nil {
+			return ErrUserDoesNotExist
+		}
+		return bucket.Delete([]byte(username))
+	})
+}
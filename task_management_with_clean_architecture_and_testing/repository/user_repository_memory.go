@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"task_with_clean_arc_and_test/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type inMemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.User // keyed by username
+}
+
+// NewInMemoryUserRepository returns a UserRepository that keeps users in
+// process memory, enforcing the same username uniqueness as the Mongo
+// implementation.
+func NewInMemoryUserRepository() UserRepository {
+	return &inMemoryUserRepository{
+		users: make(map[string]domain.User),
+	}
+}
+
+func (r *inMemoryUserRepository) Register(ctx context.Context, user domain.User) error {
+	return r.insert(user)
+}
+
+func (r *inMemoryUserRepository) RegisterAdmin(ctx context.Context, user domain.User) error {
+	return r.insert(user)
+}
+
+func (r *inMemoryUserRepository) insert(user domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Username]; ok {
+		return ErrUsernameExists
+	}
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	r.users[user.Username] = user
+	return nil
+}
+
+func (r *inMemoryUserRepository) SetAccountStatus(ctx context.Context, username string, status domain.AccountStatus) error {
+	return r.set(username, func(u *domain.User) {
+		u.Status = status
+		u.LegacyActivate = ""
+	})
+}
+
+func (r *inMemoryUserRepository) SetTwoFactor(ctx context.Context, username string, twoFactor domain.TwoFactor) error {
+	return r.set(username, func(u *domain.User) { u.TwoFactor = twoFactor })
+}
+
+func (r *inMemoryUserRepository) SetPassword(ctx context.Context, username, hashedPassword string) error {
+	return r.set(username, func(u *domain.User) { u.Password = hashedPassword })
+}
+
+func (r *inMemoryUserRepository) SetRole(ctx context.Context, username, role string) error {
+	return r.set(username, func(u *domain.User) { u.Role = role })
+}
+
+// set applies fn to the stored user under the write lock.
+func (r *inMemoryUserRepository) set(username string, fn func(u *domain.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[username]
+	if !ok {
+		return ErrUserDoesNotExist
+	}
+	fn(&user)
+	r.users[username] = user
+	return nil
+}
+
+func (r *inMemoryUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.users[username]
+	return ok, nil
+}
+
+func (r *inMemoryUserRepository) LoginUser(ctx context.Context, username string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[username]
+	if !ok {
+		return domain.User{}, mongo.ErrNoDocuments // same error the Mongo backend surfaces
+	}
+	return user, nil
+}
+
+func (r *inMemoryUserRepository) Find(ctx context.Context, query domain.UserQuery) (domain.UserPage, error) {
+	r.mu.RLock()
+	users := make([]domain.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	r.mu.RUnlock()
+
+	return queryUsers(users, query)
+}
+
+func (r *inMemoryUserRepository) Delete(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[username]; !ok {
+		return ErrUserDoesNotExist
+	}
+	delete(r.users, username)
+	return nil
+}
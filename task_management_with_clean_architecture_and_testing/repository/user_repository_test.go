@@ -23,9 +23,10 @@ func (suite *UserRepositoryTestSuite) SetupSuite() {
 	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	suite.NoError(err)
+	skipIfMongoUnavailable(suite.T(), client)
 	suite.client = client
 	suite.collection = client.Database("task_manager").Collection("users")
-	suite.repo = NewUserRepository(client)
+	suite.repo = NewUserRepository(client.Database("task_manager"))
 }
 
 func (suite *UserRepositoryTestSuite) TearDownSuite() {
@@ -39,6 +40,7 @@ func (suite *UserRepositoryTestSuite) TearDownTest() {
 }
 
 func (suite *UserRepositoryTestSuite) TestRegister_ExistingUser() {
+	ctx := context.Background()
 	// Hash password for the existing user
 	password := "password123"
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -49,13 +51,14 @@ func (suite *UserRepositoryTestSuite) TestRegister_ExistingUser() {
 	suite.NoError(err)
 
 	// Attempt to register the same user
-	err = suite.repo.Register(existingUser)
-	suite.EqualError(err, "username exists")
+	err = suite.repo.Register(ctx, existingUser)
+	suite.EqualError(err, "username already exists")
 }
 
 func (suite *UserRepositoryTestSuite) TestLoginUser_InvalidCredentials() {
+	ctx := context.Background()
 	// Attempt to login with an invalid username
-	_, err := suite.repo.LoginUser("invalidUser")
+	_, err := suite.repo.LoginUser(ctx, "invalidUser")
 	suite.EqualError(err, "mongo: no documents in result")
 
 	// Register a valid user
@@ -63,42 +66,45 @@ func (suite *UserRepositoryTestSuite) TestLoginUser_InvalidCredentials() {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	suite.NoError(err)
 	validUser := domain.User{Username: "validUser", Password: string(hashedPassword)}
-	err = suite.repo.Register(validUser)
+	err = suite.repo.Register(ctx, validUser)
 	suite.NoError(err)
 
 	// Attempt login with a wrong password
-	_, err = suite.repo.LoginUser("validUser")
+	_, err = suite.repo.LoginUser(ctx, "validUser")
 	suite.NoError(err)
 }
 
 func (suite *UserRepositoryTestSuite) TestActivate_UserNotFound() {
+	ctx := context.Background()
 	// Attempt to activate a non-existent user
-	err := suite.repo.Activate("nonexistentUser")
+	err := suite.repo.SetAccountStatus(ctx, "nonexistentUser", domain.AccountStatus{State: domain.AccountActive})
 	suite.EqualError(err, "user does not exist")
 }
 
-func (suite *UserRepositoryTestSuite) TestUpdateUser_UserNotFound() {
+func (suite *UserRepositoryTestSuite) TestSetRole_UserNotFound() {
+	ctx := context.Background()
 	// Attempt to update a non-existent user
-	err := suite.repo.UpdateUser("nonexistentUser")
+	err := suite.repo.SetRole(ctx, "nonexistentUser", "admin")
 	suite.EqualError(err, "user does not exist")
 }
 
 func (suite *UserRepositoryTestSuite) TestUsernameExists() {
+	ctx := context.Background()
 	// Register a user
 	password := "password123"
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	suite.NoError(err)
 	user := domain.User{Username: "testUser", Password: string(hashedPassword)}
-	err = suite.repo.Register(user)
+	err = suite.repo.Register(ctx, user)
 	suite.NoError(err)
 
 	// Check if username exists
-	exists, err := suite.repo.UsernameExists("testUser")
+	exists, err := suite.repo.UsernameExists(ctx, "testUser")
 	suite.NoError(err)
 	suite.True(exists)
 
 	// Check a non-existent username
-	exists, err = suite.repo.UsernameExists("nonExistentUser")
+	exists, err = suite.repo.UsernameExists(ctx, "nonExistentUser")
 	suite.NoError(err)
 	suite.False(exists)
 }
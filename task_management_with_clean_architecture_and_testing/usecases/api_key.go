@@ -0,0 +1,128 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+// apiKeyTouchInterval is how stale the last-used time of a key may get, so
+// busy scripts do not write to the store on every request.
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey mints a key for actor as request describes. secondFactor
+// says whether the actor's login was confirmed with a two-factor code,
+// which the key then vouches for too.
+func (u *userUsecase) CreateAPIKey(ctx context.Context, actor domain.Actor, secondFactor bool, request domain.APIKeyRequest) (_ domain.CreatedAPIKey, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	now := time.Now()
+	if err := request.Validate(actor, now); err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	id, secret, err := newAPIKeyParts()
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+	prefix := domain.APIKeyPrefix + id
+	token := prefix + "_" + secret
+	key := domain.APIKey{
+		ID:           id,
+		Username:     actor.Username,
+		Name:         request.Name,
+		Prefix:       prefix,
+		KeyHash:      hashToken(token),
+		Scopes:       request.Scopes,
+		CreatedAt:    now,
+		ExpiresAt:    request.ExpiresAt,
+		SecondFactor: secondFactor,
+	}
+	if err := u.apiKeys.Create(ctx, key); err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+	return domain.CreatedAPIKey{APIKeyInfo: key.Info(), Key: token}, nil
+}
+
+// ListAPIKeys returns the keys of username, expired ones included.
+func (u *userUsecase) ListAPIKeys(ctx context.Context, username string) (_ []domain.APIKeyInfo, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	keys, err := u.apiKeys.ListUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]domain.APIKeyInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = key.Info()
+	}
+	return infos, nil
+}
+
+// RevokeAPIKey deletes the key id of username; it stops working at once.
+func (u *userUsecase) RevokeAPIKey(ctx context.Context, username, id string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	return u.apiKeys.Delete(ctx, username, id)
+}
+
+// AuthenticateAPIKey checks token and returns its key and the current role
+// of its user, which is cached like UserActive. Unknown and expired keys,
+// and keys of deleted users, are reported as domain.ErrInvalidAPIKey; keys
+// of deactivated users as domain.ErrAccountDeactivated.
+func (u *userUsecase) AuthenticateAPIKey(ctx context.Context, token string) (_ domain.APIKey, _ string, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	if !strings.HasPrefix(token, domain.APIKeyPrefix) {
+		return domain.APIKey{}, "", domain.ErrInvalidAPIKey
+	}
+	key, err := u.apiKeys.GetByHash(ctx, hashToken(token))
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return domain.APIKey{}, "", domain.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return domain.APIKey{}, "", err
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return domain.APIKey{}, "", domain.ErrInvalidAPIKey
+	}
+
+	status, err := u.status(ctx, key.Username)
+	if err != nil {
+		return domain.APIKey{}, "", err
+	}
+	if !status.exists {
+		return domain.APIKey{}, "", domain.ErrInvalidAPIKey
+	}
+	if !status.active {
+		return domain.APIKey{}, "", domain.ErrAccountDeactivated
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		// a failed update only leaves the last-used time behind
+		if err := u.apiKeys.Touch(ctx, key.KeyHash, now); err != nil {
+			log.Printf("recording use of API key %s: %v", key.Prefix, err)
+		}
+	}
+	return key, status.role, nil
+}
+
+// newAPIKeyParts returns the public ID and the secret of a new key.
+func newAPIKeyParts() (id, secret string, err error) {
+	b := make([]byte, 6+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b[:6]), base64.RawURLEncoding.EncodeToString(b[6:]), nil
+}
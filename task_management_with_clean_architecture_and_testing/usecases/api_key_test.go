@@ -0,0 +1,118 @@
+package usecases_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// APIKeySuite runs the API key use cases against in-memory repositories.
+type APIKeySuite struct {
+	suite.Suite
+	users   repository.UserRepository
+	usecase usecases.UserUsecase
+	bob     domain.Actor
+}
+
+func (suite *APIKeySuite) SetupTest() {
+	ctx := context.Background()
+	suite.users = repository.NewInMemoryUserRepository()
+	tokens, hasher := newTestServices(suite.T())
+	suite.usecase = usecases.NewUserUsecase(suite.users, repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0)), repository.NewInMemorySessionRepository(), repository.NewInMemoryLoginAttemptRepository(), repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), tokens, hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+	suite.bob = domain.DefaultRoles().Actor("bob", domain.RoleUser)
+
+	for _, user := range []domain.User{
+		{Username: "root", Password: "hash", Role: domain.RoleAdmin},
+		{Username: "bob", Password: "hash", Role: domain.RoleUser},
+	} {
+		user.Status = domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+		suite.Require().NoError(suite.users.Register(ctx, user))
+	}
+}
+
+func (suite *APIKeySuite) createKey(name string) domain.CreatedAPIKey {
+	ctx := context.Background()
+	created, err := suite.usecase.CreateAPIKey(ctx, suite.bob, false, domain.APIKeyRequest{Name: name, Scopes: []domain.Permission{domain.PermTasksRead}})
+	suite.Require().NoError(err)
+	return created
+}
+
+func (suite *APIKeySuite) TestCreateAndAuthenticate() {
+	ctx := context.Background()
+	created := suite.createKey("ci")
+	suite.True(strings.HasPrefix(created.Key, created.Prefix+"_"))
+
+	key, role, err := suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.Require().NoError(err)
+	suite.Equal("bob", key.Username)
+	suite.Equal(domain.RoleUser, role)
+	suite.Equal([]domain.Permission{domain.PermTasksRead}, key.Scopes)
+
+	keys, err := suite.usecase.ListAPIKeys(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.Require().Len(keys, 1)
+	suite.Equal(created.Prefix, keys[0].Prefix)
+	suite.NotNil(keys[0].LastUsedAt)
+
+	_, _, err = suite.usecase.AuthenticateAPIKey(ctx, created.Key+"x")
+	suite.ErrorIs(err, domain.ErrInvalidAPIKey)
+	_, _, err = suite.usecase.AuthenticateAPIKey(ctx, "not a key")
+	suite.ErrorIs(err, domain.ErrInvalidAPIKey)
+}
+
+func (suite *APIKeySuite) TestKeysFollowTheirUser() {
+	ctx := context.Background()
+	created := suite.createKey("ci")
+
+	suite.Require().NoError(suite.usecase.AssignRole(ctx, "bob", domain.RoleAdmin, domain.DefaultRoles().Actor("root", domain.RoleAdmin)))
+	_, role, err := suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.NoError(err)
+	suite.Equal(domain.RoleAdmin, role)
+
+	suite.Require().NoError(suite.usecase.Deactivate(ctx, "bob", ""))
+	_, _, err = suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.ErrorIs(err, domain.ErrAccountDeactivated)
+
+	_, err = suite.usecase.DeleteUser(ctx, "bob", "", domain.DefaultRoles().Actor("root", domain.RoleAdmin))
+	suite.Require().NoError(err)
+	_, _, err = suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.ErrorIs(err, domain.ErrInvalidAPIKey)
+	keys, err := suite.usecase.ListAPIKeys(ctx, "bob")
+	suite.NoError(err)
+	suite.Empty(keys)
+}
+
+func (suite *APIKeySuite) TestRevokeAPIKey() {
+	ctx := context.Background()
+	created := suite.createKey("ci")
+	suite.createKey("deploy")
+
+	suite.ErrorIs(suite.usecase.RevokeAPIKey(ctx, "root", created.ID), domain.ErrAPIKeyNotFound)
+	suite.NoError(suite.usecase.RevokeAPIKey(ctx, "bob", created.ID))
+
+	_, _, err := suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.ErrorIs(err, domain.ErrInvalidAPIKey)
+	keys, err := suite.usecase.ListAPIKeys(ctx, "bob")
+	suite.NoError(err)
+	suite.Require().Len(keys, 1)
+	suite.Equal("deploy", keys[0].Name)
+}
+
+func (suite *APIKeySuite) TestScopesMustBeHeld() {
+	ctx := context.Background()
+	_, err := suite.usecase.CreateAPIKey(ctx, suite.bob, false, domain.APIKeyRequest{Name: "ci", Scopes: []domain.Permission{domain.PermUsersManage}})
+	suite.ErrorIs(err, domain.ErrInvalidAPIKeyScope)
+}
+
+func TestAPIKeySuite(t *testing.T) {
+	suite.Run(t, new(APIKeySuite))
+}
@@ -0,0 +1,64 @@
+package usecases
+
+import (
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/repository"
+	"time"
+)
+
+// loginGuard throttles password guessing, per account and per client
+// address, following policy.
+type loginGuard struct {
+	attempts repository.LoginAttemptRepository
+	policy   domain.LoginPolicy
+}
+
+func accountKey(username string) string { return "account:" + username }
+func clientKey(clientIP string) string  { return "ip:" + clientIP }
+
+// check returns a *domain.ThrottledError while the account or the client
+// may not try to log in. Unknown usernames lock like real ones, so a lockout
+// does not reveal that an account exists.
+func (g loginGuard) check(username, clientIP string, now time.Time) error {
+	var until time.Time
+	if clientIP != "" {
+		attempts, err := g.attempts.Get(clientKey(clientIP), now)
+		if err != nil {
+			return err
+		}
+		until = g.policy.IPBlockedUntil(attempts)
+	}
+	attempts, err := g.attempts.Get(accountKey(username), now)
+	if err != nil {
+		return err
+	}
+	if locked := g.policy.AccountLockedUntil(attempts); locked.After(until) {
+		until = locked
+	}
+	if now.Before(until) {
+		return &domain.ThrottledError{RetryAfter: until.Sub(now)}
+	}
+	return nil
+}
+
+// fail records a failed login.
+func (g loginGuard) fail(username, clientIP string, now time.Time) error {
+	if clientIP != "" {
+		if _, err := g.attempts.AddFailure(clientKey(clientIP), now, g.policy.IPWindow); err != nil {
+			return err
+		}
+	}
+	_, err := g.attempts.AddFailure(accountKey(username), now, g.policy.FailureWindow)
+	return err
+}
+
+// succeed forgets the failures of the account. Those of the client address
+// stay, or an attacker could clear them by logging into their own account.
+func (g loginGuard) succeed(username string) error {
+	return g.attempts.Reset(accountKey(username))
+}
+
+// unlock lifts the lockout of an account.
+func (g loginGuard) unlock(username string) error {
+	return g.attempts.Reset(accountKey(username))
+}
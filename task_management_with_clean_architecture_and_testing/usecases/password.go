@@ -0,0 +1,163 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordResetTTL is how long a password reset token works.
+const PasswordResetTTL = 30 * time.Minute
+
+// ChangePassword replaces the password of username after checking the
+// current one, and ends all of their sessions. Wrong current passwords count
+// as failed logins, so a stolen access token cannot be used to guess it.
+func (u *userUsecase) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if err := u.passwords.Check(username, newPassword); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := u.guard.check(username, "", now); err != nil {
+		return err
+	}
+	user, err := u.user(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := u.hasher.Check(currentPassword, user.Password); err != nil {
+		if err := u.guard.fail(username, "", now); err != nil {
+			return err
+		}
+		return domain.ErrWrongPassword
+	}
+	return u.setPassword(ctx, username, newPassword)
+}
+
+// RequestPasswordReset sends username a token for ResetPassword through the
+// notifier. Only the latest token of a user works. Unknown and deactivated
+// users are silently ignored, so the answer does not tell which accounts
+// exist.
+func (u *userUsecase) RequestPasswordReset(ctx context.Context, username string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	user, err := u.repo.LoginUser(ctx, username)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.Active() {
+		return nil
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	reset := domain.PasswordReset{
+		TokenHash: hashToken(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(PasswordResetTTL),
+	}
+	if err := u.resets.DeleteUser(ctx, username); err != nil {
+		return err
+	}
+	if err := u.resets.Create(ctx, reset); err != nil {
+		return err
+	}
+	return u.notifier.SendPasswordReset(username, token, reset.ExpiresAt)
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset,
+// ends all sessions of the user and lifts a lockout of their account. A
+// second factor, if enabled, is still required at the next login. The token
+// keeps working if the password policy refuses newPassword.
+func (u *userUsecase) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	reset, err := u.resets.Consume(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return err
+	}
+	user, err := u.user(ctx, reset.Username)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if !user.Active() {
+		return domain.ErrAccountDeactivated
+	}
+	if err := u.passwords.Check(reset.Username, newPassword); err != nil {
+		// give the token back, so the user can try a stronger password
+		if err := u.resets.Create(ctx, reset); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := u.setPassword(ctx, reset.Username, newPassword); err != nil {
+		return err
+	}
+	return u.guard.unlock(reset.Username)
+}
+
+// setPassword stores the new password and revokes everything the old one
+// gave access to: sessions and outstanding reset tokens.
+func (u *userUsecase) setPassword(ctx context.Context, username, password string) error {
+	hashedPassword, err := u.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := u.repo.SetPassword(ctx, username, hashedPassword); err != nil {
+		return err
+	}
+	if err := u.sessions.RevokeUser(ctx, username); err != nil {
+		return err
+	}
+	return u.resets.DeleteUser(ctx, username)
+}
+
+// rehashPassword stores password, just verified at login, hashed with the
+// configured cost. Failing to do so does not fail the login; it is retried
+// at the next one.
+func (u *userUsecase) rehashPassword(ctx context.Context, username, password string) {
+	hashedPassword, err := u.hasher.Hash(password)
+	if err == nil {
+		err = u.repo.SetPassword(ctx, username, hashedPassword)
+	}
+	if err != nil {
+		log.Printf("rehashing the password of %s: %v", username, err)
+	}
+}
+
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes a reset token or API key for storage. Both are random
+// enough that a fast hash suffices, unlike passwords.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,165 @@
+package usecases_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordingNotifier keeps the last reset token sent to each user.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (n *recordingNotifier) SendPasswordReset(username, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tokens[username] = token
+	return nil
+}
+
+func (n *recordingNotifier) token(username string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.tokens[username]
+}
+
+// PasswordSuite runs password changes and resets against in-memory
+// repositories, since they end the sessions earlier logins stored.
+type PasswordSuite struct {
+	suite.Suite
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	notifier *recordingNotifier
+	tokens   *infrastructures.TokenService
+	usecase  usecases.UserUsecase
+}
+
+func (suite *PasswordSuite) SetupTest() {
+	ctx := context.Background()
+	tokens, hasher := newTestServices(suite.T())
+	suite.tokens = tokens
+	suite.users = repository.NewInMemoryUserRepository()
+	suite.sessions = repository.NewInMemorySessionRepository()
+	suite.notifier = &recordingNotifier{tokens: make(map[string]string)}
+	suite.usecase = usecases.NewUserUsecase(suite.users, repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0)), suite.sessions, repository.NewInMemoryLoginAttemptRepository(), repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), suite.notifier, tokens, hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.users.Register(ctx, domain.User{Username: "bob", Password: string(hashed), Role: domain.RoleUser}))
+}
+
+// login logs bob in with password and returns the session of the tokens.
+func (suite *PasswordSuite) login(password string) string {
+	ctx := context.Background()
+	result, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: password}, "192.0.2.1")
+	suite.Require().NoError(err)
+	sessionID, _, err := suite.tokens.ParseRefreshToken(result.RefreshToken)
+	suite.Require().NoError(err)
+	return sessionID
+}
+
+func (suite *PasswordSuite) sessionActive(sessionID string) bool {
+	ctx := context.Background()
+	active, err := suite.usecase.SessionActive(ctx, sessionID)
+	suite.Require().NoError(err)
+	return active
+}
+
+func (suite *PasswordSuite) TestChangePassword() {
+	ctx := context.Background()
+	sessionID := suite.login("password")
+
+	suite.ErrorIs(suite.usecase.ChangePassword(ctx, "bob", "wrong", "new password"), domain.ErrWrongPassword)
+	suite.True(suite.sessionActive(sessionID))
+
+	suite.Require().NoError(suite.usecase.ChangePassword(ctx, "bob", "password", "new password"))
+	suite.False(suite.sessionActive(sessionID))
+
+	_, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: "password"}, "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidCredentials)
+	suite.login("new password")
+}
+
+func (suite *PasswordSuite) TestWrongCurrentPasswordsLockTheAccount() {
+	ctx := context.Background()
+	for i := 0; i < domain.DefaultLoginPolicy().MaxFailures; i++ {
+		suite.Require().ErrorIs(suite.usecase.ChangePassword(ctx, "bob", "wrong", "new password"), domain.ErrWrongPassword)
+	}
+	suite.ErrorIs(suite.usecase.ChangePassword(ctx, "bob", "password", "new password"), domain.ErrTooManyAttempts)
+}
+
+func (suite *PasswordSuite) TestResetPassword() {
+	ctx := context.Background()
+	sessionID := suite.login("password")
+
+	suite.Require().NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	token := suite.notifier.token("bob")
+	suite.Require().NotEmpty(token)
+
+	suite.ErrorIs(suite.usecase.ResetPassword(ctx, "not a token", "new password"), domain.ErrInvalidResetToken)
+	suite.Require().NoError(suite.usecase.ResetPassword(ctx, token, "new password"))
+	suite.False(suite.sessionActive(sessionID))
+	suite.login("new password")
+
+	// tokens work once
+	suite.ErrorIs(suite.usecase.ResetPassword(ctx, token, "other password"), domain.ErrInvalidResetToken)
+}
+
+func (suite *PasswordSuite) TestNewPasswordsFollowThePolicy() {
+	ctx := context.Background()
+	suite.ErrorIs(suite.usecase.ChangePassword(ctx, "bob", "password", "short"), domain.ErrWeakPassword)
+
+	suite.Require().NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	token := suite.notifier.token("bob")
+	suite.ErrorIs(suite.usecase.ResetPassword(ctx, token, "bob"), domain.ErrWeakPassword)
+	// the token survives a refused password
+	suite.NoError(suite.usecase.ResetPassword(ctx, token, "new password"))
+}
+
+func (suite *PasswordSuite) TestOnlyTheLatestResetTokenWorks() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	first := suite.notifier.token("bob")
+	suite.Require().NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	second := suite.notifier.token("bob")
+
+	suite.ErrorIs(suite.usecase.ResetPassword(ctx, first, "new password"), domain.ErrInvalidResetToken)
+	suite.NoError(suite.usecase.ResetPassword(ctx, second, "new password"))
+}
+
+func (suite *PasswordSuite) TestResetLiftsLockout() {
+	ctx := context.Background()
+	for i := 0; i < domain.DefaultLoginPolicy().MaxFailures; i++ {
+		_, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: "wrong"}, "")
+		suite.Require().ErrorIs(err, domain.ErrInvalidCredentials)
+	}
+
+	suite.Require().NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	suite.Require().NoError(suite.usecase.ResetPassword(ctx, suite.notifier.token("bob"), "new password"))
+	suite.login("new password")
+}
+
+func (suite *PasswordSuite) TestResetRequestsRevealNoAccounts() {
+	ctx := context.Background()
+	suite.NoError(suite.usecase.RequestPasswordReset(ctx, "ghost"))
+	suite.Empty(suite.notifier.token("ghost"))
+
+	suite.Require().NoError(suite.usecase.Deactivate(ctx, "bob", ""))
+	suite.NoError(suite.usecase.RequestPasswordReset(ctx, "bob"))
+	suite.Empty(suite.notifier.token("bob"))
+}
+
+func TestPasswordSuite(t *testing.T) {
+	suite.Run(t, new(PasswordSuite))
+}
@@ -1,42 +1,284 @@
 package usecases
 
 import (
+	"context"
+	"errors"
 	"task_with_clean_arc_and_test/domain"
 	"task_with_clean_arc_and_test/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// TaskUsecase runs every task operation on behalf of an actor. Actors with
+// tasks:manage reach every task; other users only see the tasks they own or are assigned to and
+// only change the ones they own. Tasks outside an actor's view are reported
+// as not found.
+//
+// Deleting and changing a task name the version of the task they are based
+// on, or domain.AnyVersion, and fail with domain.ErrVersionMismatch if the
+// task changed since.
+//
+// Deleted tasks go to the trash, which only actors with tasks:manage see.
+// They restore tasks from it, and PurgeTrash removes the tasks that stayed
+// there longer than the retention period.
 type TaskUsecase interface {
-	GetTasks() ([]domain.Task, error)
-	GetTaskByID(id string) (domain.Task, error)
-	AddTask(task domain.Task) error
-	DeleteTask(id string) error
-	UpdateTask(id string, task domain.Task) error
+	GetTasks(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (domain.TaskPage, error)
+	GetTaskByID(ctx context.Context, id string, actor domain.Actor) (domain.Task, error)
+	AddTask(ctx context.Context, task domain.Task, actor domain.Actor) error
+	DeleteTask(ctx context.Context, id string, version int64, actor domain.Actor) error
+	UpdateTask(ctx context.Context, id string, version int64, task domain.Task, actor domain.Actor) (domain.Task, error)
+	PatchTask(ctx context.Context, id string, version int64, patch []byte, actor domain.Actor) (domain.Task, error)
+	TransitionTask(ctx context.Context, id, status string, actor domain.Actor) (domain.Task, error)
+	GetTrash(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (domain.TaskPage, error)
+	RestoreTask(ctx context.Context, id string, actor domain.Actor) (domain.Task, error)
+	PurgeTrash(ctx context.Context) (int64, error)
 }
 
 type taskUsecase struct {
-	repo repository.TaskRepository
+	repo      repository.TaskRepository
+	userRepo  repository.UserRepository
+	timeouts  domain.Timeouts
+	retention time.Duration
+}
+
+// NewTaskUsecase creates the task use cases, each bounded by timeouts.
+// Deleted tasks stay in the trash for retention.
+func NewTaskUsecase(repo repository.TaskRepository, userRepo repository.UserRepository, timeouts domain.Timeouts, retention time.Duration) TaskUsecase {
+	return &taskUsecase{repo: repo, userRepo: userRepo, timeouts: timeouts, retention: retention}
+}
+
+func (u *taskUsecase) GetTasks(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (_ domain.TaskPage, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	if err := query.Normalize(); err != nil {
+		return domain.TaskPage{}, err
+	}
+	query.VisibleTo = ""
+	query.Trashed = false
+	if !actor.Can(domain.PermTasksManage) {
+		query.VisibleTo = actor.Username
+	}
+	return u.repo.Find(ctx, query)
+}
+
+func (u *taskUsecase) GetTaskByID(ctx context.Context, id string, actor domain.Actor) (_ domain.Task, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	return u.visibleTask(ctx, id, actor)
+}
+
+func (u *taskUsecase) AddTask(ctx context.Context, task domain.Task, actor domain.Actor) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if err := u.validate(ctx, &task, domain.Task{}); err != nil {
+		return err
+	}
+	// the repository hands out the ID, and a new task is never in the trash
+	task.ID = ""
+	task.Deleted = nil
+	task.Owner = actor.Username
+	// new tasks always enter the lifecycle at its start
+	task.Status = domain.StatusPending
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	return u.repo.Add(ctx, task)
+}
+
+// DeleteTask moves a task to the trash, recording the actor as the one who
+// deleted it.
+func (u *taskUsecase) DeleteTask(ctx context.Context, id string, version int64, actor domain.Actor) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	task, err := u.modifiableTask(ctx, id, version, actor)
+	if err != nil {
+		return err
+	}
+	return u.repo.Trash(ctx, id, task.Version, domain.Deletion{By: actor.Username, At: time.Now()})
+}
+
+// GetTrash returns a page of the deleted tasks selected by query.
+func (u *taskUsecase) GetTrash(ctx context.Context, query domain.TaskQuery, actor domain.Actor) (_ domain.TaskPage, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	if !actor.Can(domain.PermTasksManage) {
+		return domain.TaskPage{}, domain.ErrPermissionDenied
+	}
+	if err := query.Normalize(); err != nil {
+		return domain.TaskPage{}, err
+	}
+	query.VisibleTo = ""
+	query.Trashed = true
+	return u.repo.Find(ctx, query)
+}
+
+// RestoreTask takes a task out of the trash, as it was before it was deleted.
+func (u *taskUsecase) RestoreTask(ctx context.Context, id string, actor domain.Actor) (_ domain.Task, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if !actor.Can(domain.PermTasksManage) {
+		return domain.Task{}, domain.ErrPermissionDenied
+	}
+	return u.repo.Restore(ctx, id, time.Now())
+}
+
+// PurgeTrash removes the tasks deleted longer than the retention period ago
+// for good, returning how many it removed.
+func (u *taskUsecase) PurgeTrash(ctx context.Context) (_ int64, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	return u.repo.Purge(ctx, time.Now().Add(-u.retention))
 }
 
-func NewTaskUsecase(repo repository.TaskRepository) TaskUsecase {
-	return &taskUsecase{repo: repo}
+// UpdateTask replaces every field of a task a client may edit: fields left
+// out are cleared. What the server manages, the owner, status and creation
+// time, stays as it is.
+func (u *taskUsecase) UpdateTask(ctx context.Context, id string, version int64, task domain.Task, actor domain.Actor) (_ domain.Task, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	existing, err := u.modifiableTask(ctx, id, version, actor)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	return u.replace(ctx, id, existing, task)
+}
+
+// PatchTask changes a task by a JSON merge patch, see domain.PatchTask, and
+// returns the task as saved.
+func (u *taskUsecase) PatchTask(ctx context.Context, id string, version int64, patch []byte, actor domain.Actor) (_ domain.Task, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	existing, err := u.modifiableTask(ctx, id, version, actor)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	task, err := domain.PatchTask(existing, patch)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	return u.replace(ctx, id, existing, task)
 }
 
-func (u *taskUsecase) GetTasks() ([]domain.Task, error) {
-	return u.repo.GetAll()
+// replace validates task and saves it over existing, keeping the fields the
+// server manages. The save fails if the task changed since existing was
+// loaded.
+func (u *taskUsecase) replace(ctx context.Context, id string, existing, task domain.Task) (domain.Task, error) {
+	task.ID = existing.ID
+	task.Owner = existing.Owner
+	task.Status = existing.Status
+	task.CreatedAt = existing.CreatedAt
+	if err := u.validate(ctx, &task, existing); err != nil {
+		return domain.Task{}, err
+	}
+	task.UpdatedAt = time.Now()
+	if err := u.repo.Update(ctx, id, existing.Version, task); err != nil {
+		return domain.Task{}, err
+	}
+	task.Version = existing.Version + 1
+	return task, nil
 }
 
-func (u *taskUsecase) GetTaskByID(id string) (domain.Task, error) {
-	return u.repo.GetOne(id)
+// TransitionTask moves a task to another lifecycle state if the transition is
+// legal and the actor's permissions allow it.
+func (u *taskUsecase) TransitionTask(ctx context.Context, id, status string, actor domain.Actor) (_ domain.Task, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	to, err := domain.NormalizeStatus(status)
+	if err != nil {
+		return domain.Task{}, err
+	}
+
+	task, err := u.visibleTask(ctx, id, actor)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	from, err := domain.NormalizeStatus(task.Status)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	if err := domain.CheckTransition(from, to, actor); err != nil {
+		return domain.Task{}, err
+	}
+
+	// compare against the stored value, which may still be a legacy spelling
+	now := time.Now()
+	if err := u.repo.SetStatus(ctx, id, task.Status, to, now); err != nil {
+		return domain.Task{}, err
+	}
+	task.Status = to
+	task.UpdatedAt = now
+	task.Version++
+	return task, nil
 }
 
-func (u *taskUsecase) AddTask(task domain.Task) error {
-	return u.repo.Add(task)
+// visibleTask loads a task, hiding it from actors who may not see it.
+func (u *taskUsecase) visibleTask(ctx context.Context, id string, actor domain.Actor) (domain.Task, error) {
+	task, err := u.repo.GetOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.Task{}, domain.ErrTaskNotFound
+		}
+		return domain.Task{}, err
+	}
+	if !actor.CanSee(task) {
+		return domain.Task{}, domain.ErrTaskNotFound
+	}
+	return task, nil
 }
 
-func (u *taskUsecase) DeleteTask(id string) error {
-	return u.repo.Delete(id)
+// modifiableTask loads a task the actor wants to change, if it still is at
+// version. Assignees see the task but are refused, everyone else gets not
+// found.
+func (u *taskUsecase) modifiableTask(ctx context.Context, id string, version int64, actor domain.Actor) (domain.Task, error) {
+	task, err := u.visibleTask(ctx, id, actor)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	if !actor.CanModify(task) {
+		return domain.Task{}, domain.ErrForbidden
+	}
+	if version != domain.AnyVersion && version != task.Version {
+		return domain.Task{}, domain.ErrVersionMismatch
+	}
+	return task, nil
 }
 
-func (u *taskUsecase) UpdateTask(id string, task domain.Task) error {
-	return u.repo.Update(id, task)
+// validate checks task against the rules of its fields and that the
+// assignee is a known user, and normalises the priority. A due date that
+// already passed may stay as it is in existing, the task before the change.
+func (u *taskUsecase) validate(ctx context.Context, task *domain.Task, existing domain.Task) error {
+	var except []string
+	if !existing.DueDate.IsZero() && task.DueDate.Equal(existing.DueDate) {
+		except = append(except, "DueDate")
+	}
+	if err := domain.Validate(task, except...); err != nil {
+		return err
+	}
+	priority, err := domain.ParsePriority(task.Priority)
+	if err != nil {
+		return err
+	}
+	task.Priority = priority
+
+	if task.Assignee != "" {
+		exists, err := u.userRepo.UsernameExists(ctx, task.Assignee)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return domain.ErrUnknownAssignee
+		}
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package usecases_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // MockTaskRepository is a mock implementation of the TaskRepository interface.
@@ -17,66 +19,116 @@ type MockTaskRepository struct {
 	mock.Mock
 }
 
-func (m *MockTaskRepository) GetAll() ([]domain.Task, error) {
+func (m *MockTaskRepository) GetAll(ctx context.Context) ([]domain.Task, error) {
 	args := m.Called()
 	return args.Get(0).([]domain.Task), args.Error(1)
 }
 
-func (m *MockTaskRepository) GetOne(id string) (domain.Task, error) {
+func (m *MockTaskRepository) Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(domain.TaskPage), args.Error(1)
+}
+
+func (m *MockTaskRepository) GetOne(ctx context.Context, id string) (domain.Task, error) {
 	args := m.Called(id)
 	return args.Get(0).(domain.Task), args.Error(1)
 }
 
-func (m *MockTaskRepository) Add(task domain.Task) error {
+func (m *MockTaskRepository) Add(ctx context.Context, task domain.Task) error {
 	args := m.Called(task)
 	return args.Error(0)
 }
 
-func (m *MockTaskRepository) Delete(id string) error {
-	args := m.Called(id)
+func (m *MockTaskRepository) Trash(ctx context.Context, id string, version int64, deletion domain.Deletion) error {
+	args := m.Called(id, version, deletion)
 	return args.Error(0)
 }
 
-func (m *MockTaskRepository) Update(id string, task domain.Task) error {
-	args := m.Called(id, task)
+func (m *MockTaskRepository) Restore(ctx context.Context, id string, updatedAt time.Time) (domain.Task, error) {
+	args := m.Called(id, updatedAt)
+	return args.Get(0).(domain.Task), args.Error(1)
+}
+
+func (m *MockTaskRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTaskRepository) Update(ctx context.Context, id string, version int64, task domain.Task) error {
+	args := m.Called(id, version, task)
 	return args.Error(0)
 }
 
+func (m *MockTaskRepository) SetStatus(ctx context.Context, id, expected, status string, updatedAt time.Time) error {
+	args := m.Called(id, expected, status, updatedAt)
+	return args.Error(0)
+}
+
+func (m *MockTaskRepository) ReassignUser(ctx context.Context, from, to string, updatedAt time.Time) (int64, error) {
+	args := m.Called(from, to, updatedAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+var (
+	admin = domain.DefaultRoles().Actor("root", domain.RoleAdmin)
+	bob   = domain.DefaultRoles().Actor("bob", domain.RoleUser)
+)
+
 // TaskUsecaseSuite defines the suite for TaskUsecase tests.
 type TaskUsecaseSuite struct {
 	suite.Suite
-	mockRepo *MockTaskRepository
-	usecase  usecases.TaskUsecase
+	mockRepo     *MockTaskRepository
+	mockUserRepo *MockUserRepository
+	usecase      usecases.TaskUsecase
 }
 
 // SetupTest sets up the test environment before each test in the suite.
 func (suite *TaskUsecaseSuite) SetupTest() {
 	suite.mockRepo = new(MockTaskRepository)
-	suite.usecase = usecases.NewTaskUsecase(suite.mockRepo)
+	suite.mockUserRepo = new(MockUserRepository)
+	suite.usecase = usecases.NewTaskUsecase(suite.mockRepo, suite.mockUserRepo, domain.DefaultTimeouts(), 30*24*time.Hour)
 }
 
 // TestGetTasks tests the GetTasks method.
 func (suite *TaskUsecaseSuite) TestGetTasks() {
+	ctx := context.Background()
 	mockTasks := []domain.Task{
 		{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"},
 		{ID: "2", Title: "Task 2", Description: "Description 2", DueDate: time.Now(), Status: "Completed"},
 	}
-	suite.mockRepo.On("GetAll").Return(mockTasks, nil)
+	normalized := domain.TaskQuery{SortBy: domain.SortByCreatedAt, Limit: domain.DefaultTaskPageSize}
+	suite.mockRepo.On("Find", normalized).Return(domain.TaskPage{Tasks: mockTasks, Total: 2}, nil)
 
-	tasks, err := suite.usecase.GetTasks()
+	page, err := suite.usecase.GetTasks(ctx, domain.TaskQuery{}, admin)
 
 	suite.Assert().Nil(err)
-	suite.Assert().NotEmpty(tasks)
-	suite.Assert().Equal(len(mockTasks), len(tasks))
+	suite.Assert().NotEmpty(page.Tasks)
+	suite.Assert().Equal(len(mockTasks), len(page.Tasks))
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
+// TestGetTasksInvalidQuery tests that invalid queries never reach the repository.
+func (suite *TaskUsecaseSuite) TestGetTasksInvalidQuery() {
+	ctx := context.Background()
+	_, err := suite.usecase.GetTasks(ctx, domain.TaskQuery{SortBy: "title"}, admin)
+	suite.Assert().ErrorIs(err, domain.ErrInvalidSort)
+
+	_, err = suite.usecase.GetTasks(ctx, domain.TaskQuery{Status: "someday"}, admin)
+	suite.Assert().ErrorIs(err, domain.ErrUnknownStatus)
+
+	_, err = suite.usecase.GetTasks(ctx, domain.TaskQuery{Limit: domain.MaxTaskPageSize + 1}, admin)
+	suite.Assert().ErrorIs(err, domain.ErrInvalidLimit)
+
+	suite.mockRepo.AssertNotCalled(suite.T(), "Find", mock.Anything)
+}
+
 // TestGetTaskByID tests the GetTaskByID method.
 func (suite *TaskUsecaseSuite) TestGetTaskByID() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
 	suite.mockRepo.On("GetOne", "1").Return(task, nil)
 
-	returnedTask, err := suite.usecase.GetTaskByID("1")
+	returnedTask, err := suite.usecase.GetTaskByID(ctx, "1", admin)
 
 	suite.Assert().Nil(err)
 	suite.Assert().Equal(task, returnedTask)
@@ -85,20 +137,85 @@ func (suite *TaskUsecaseSuite) TestGetTaskByID() {
 
 // TestAddTask tests the AddTask method.
 func (suite *TaskUsecaseSuite) TestAddTask() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
-	suite.mockRepo.On("Add", task).Return(nil)
+	suite.mockRepo.On("Add", mock.MatchedBy(func(t domain.Task) bool {
+		return t.Title == task.Title && t.DueDate.Equal(task.DueDate) && t.Status == domain.StatusPending &&
+			t.Priority == domain.PriorityNormal && t.Owner == "bob" && !t.CreatedAt.IsZero() && t.UpdatedAt.Equal(t.CreatedAt)
+	})).Return(nil)
+
+	err := suite.usecase.AddTask(ctx, task, bob)
+
+	suite.Assert().Nil(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestAddTaskDropsDeletion tests that clients cannot create a task that is
+// already in the trash, or pick its ID.
+func (suite *TaskUsecaseSuite) TestAddTaskDropsDeletion() {
+	ctx := context.Background()
+	task := domain.Task{
+		ID: "42", Title: "Task 1", Description: "Description 1",
+		Deleted: &domain.Deletion{By: "alice", At: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	suite.mockRepo.On("Add", mock.MatchedBy(func(t domain.Task) bool {
+		return t.Deleted == nil && t.ID == ""
+	})).Return(nil)
+
+	err := suite.usecase.AddTask(ctx, task, bob)
+
+	suite.Assert().Nil(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestAddTaskWithAssignee tests that the assignee must be an existing user.
+func (suite *TaskUsecaseSuite) TestAddTaskWithAssignee() {
+	ctx := context.Background()
+	task := domain.Task{Title: "Task 1", Description: "Description 1", Priority: domain.PriorityUrgent, Assignee: "alice"}
+	suite.mockUserRepo.On("UsernameExists", "alice").Return(true, nil)
+	suite.mockRepo.On("Add", mock.MatchedBy(func(t domain.Task) bool {
+		return t.Assignee == "alice" && t.Priority == domain.PriorityUrgent
+	})).Return(nil)
 
-	err := suite.usecase.AddTask(task)
+	err := suite.usecase.AddTask(ctx, task, bob)
 
 	suite.Assert().Nil(err)
 	suite.mockRepo.AssertExpectations(suite.T())
+	suite.mockUserRepo.AssertExpectations(suite.T())
+}
+
+// TestAddTaskUnknownAssignee tests that unknown assignees are rejected before storage.
+func (suite *TaskUsecaseSuite) TestAddTaskUnknownAssignee() {
+	ctx := context.Background()
+	task := domain.Task{Title: "Task 1", Description: "Description 1", Assignee: "ghost"}
+	suite.mockUserRepo.On("UsernameExists", "ghost").Return(false, nil)
+
+	err := suite.usecase.AddTask(ctx, task, bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrUnknownAssignee)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Add", mock.Anything)
+}
+
+// TestAddTaskInvalidPriority tests that priorities outside the enum are rejected.
+func (suite *TaskUsecaseSuite) TestAddTaskInvalidPriority() {
+	ctx := context.Background()
+	task := domain.Task{Title: "Task 1", Description: "Description 1", Priority: "critical"}
+
+	err := suite.usecase.AddTask(ctx, task, bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrInvalidPriority)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Add", mock.Anything)
 }
 
 // TestDeleteTask tests the DeleteTask method.
 func (suite *TaskUsecaseSuite) TestDeleteTask() {
-	suite.mockRepo.On("Delete", "1").Return(nil)
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Owner: "bob"}, nil)
+	suite.mockRepo.On("Trash", "1", int64(0), mock.MatchedBy(func(d domain.Deletion) bool {
+		return d.By == "bob" && time.Since(d.At) < time.Minute
+	})).Return(nil)
 
-	err := suite.usecase.DeleteTask("1")
+	err := suite.usecase.DeleteTask(ctx, "1", 0, bob)
 
 	suite.Assert().Nil(err)
 	suite.mockRepo.AssertExpectations(suite.T())
@@ -106,32 +223,161 @@ func (suite *TaskUsecaseSuite) TestDeleteTask() {
 
 // TestUpdateTask tests the UpdateTask method.
 func (suite *TaskUsecaseSuite) TestUpdateTask() {
-	task := domain.Task{ID: "1", Title: "Updated Task", Description: "Updated Description", DueDate: time.Now(), Status: "Completed"}
-	suite.mockRepo.On("Update", "1", task).Return(nil)
+	ctx := context.Background()
+	task := domain.Task{ID: "1", Title: "Updated Task", Description: "Updated Description", DueDate: time.Now(), Status: "Completed", Priority: domain.PriorityLow}
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1"}, nil)
+	suite.mockRepo.On("Update", "1", int64(0), mock.MatchedBy(func(t domain.Task) bool {
+		return t.Title == task.Title && t.DueDate.Equal(task.DueDate) && t.Priority == domain.PriorityLow && !t.UpdatedAt.IsZero()
+	})).Return(nil)
 
-	err := suite.usecase.UpdateTask("1", task)
+	_, err := suite.usecase.UpdateTask(ctx, "1", 0, task, admin)
 
 	suite.Assert().Nil(err)
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
+// TestAddTask_Invalid checks that invalid tasks are refused, field by
+// field, before they reach the repository.
+func (suite *TaskUsecaseSuite) TestAddTask_Invalid() {
+	ctx := context.Background()
+	task := domain.Task{Title: "  ", Description: "Description", DueDate: time.Now().AddDate(0, 0, -2), Priority: "whenever"}
+
+	err := suite.usecase.AddTask(ctx, task, admin)
+
+	var invalid *domain.ValidationError
+	suite.Require().ErrorAs(err, &invalid)
+	suite.Equal([]string{"title", "due_date", "priority"}, fieldNames(invalid))
+	suite.ErrorIs(err, domain.ErrInvalidPriority)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Add", mock.Anything)
+}
+
+// TestUpdateTask_PastDueDate checks that a due date that already passed can
+// be kept, but not set.
+func (suite *TaskUsecaseSuite) TestUpdateTask_PastDueDate() {
+	ctx := context.Background()
+	past := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Title: "Task", Description: "Description", DueDate: past}, nil)
+	suite.mockRepo.On("Update", "1", int64(0), mock.Anything).Return(nil)
+
+	_, err := suite.usecase.UpdateTask(ctx, "1", 0, domain.Task{Title: "Renamed", Description: "Description", DueDate: past}, admin)
+	suite.NoError(err)
+
+	_, err = suite.usecase.UpdateTask(ctx, "1", 0, domain.Task{Title: "Renamed", Description: "Description", DueDate: past.AddDate(0, 0, 1)}, admin)
+	var invalid *domain.ValidationError
+	suite.Require().ErrorAs(err, &invalid)
+	suite.Equal([]string{"due_date"}, fieldNames(invalid))
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Update", 1)
+}
+
+// TestUpdateTask_Replaces checks that a PUT replaces every editable field,
+// clearing those left out, and keeps what the server manages.
+func (suite *TaskUsecaseSuite) TestUpdateTask_Replaces() {
+	ctx := context.Background()
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{
+		ID: "1", Title: "Task", Description: "Description", DueDate: time.Now().AddDate(0, 0, 3),
+		Status: domain.StatusInProgress, Priority: domain.PriorityHigh, Assignee: "bob", Owner: "root", CreatedAt: created,
+	}, nil)
+	suite.mockRepo.On("Update", "1", int64(0), mock.Anything).Return(nil)
+
+	_, err := suite.usecase.UpdateTask(ctx, "1", 0, domain.Task{Title: "Renamed", Description: "Description", Status: domain.StatusDone, Owner: "eve"}, admin)
+
+	suite.Require().NoError(err)
+	saved := suite.mockRepo.Calls[1].Arguments.Get(2).(domain.Task)
+	suite.Equal("Renamed", saved.Title)
+	suite.True(saved.DueDate.IsZero())
+	suite.Empty(saved.Assignee)
+	suite.Equal(domain.PriorityNormal, saved.Priority)
+	suite.Equal(domain.StatusInProgress, saved.Status)
+	suite.Equal("root", saved.Owner)
+	suite.Equal(created, saved.CreatedAt)
+}
+
+// TestPatchTask checks that a merge patch changes only the fields it names
+// and returns the task as saved.
+func (suite *TaskUsecaseSuite) TestPatchTask() {
+	ctx := context.Background()
+	due := time.Now().AddDate(0, 0, 3)
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{
+		ID: "1", Title: "Task", Description: "Description", DueDate: due,
+		Status: domain.StatusPending, Priority: domain.PriorityHigh, Assignee: "bob", Owner: "bob",
+	}, nil)
+	suite.mockRepo.On("Update", "1", int64(0), mock.MatchedBy(func(t domain.Task) bool {
+		return t.Title == "Renamed" && t.Assignee == "" && t.DueDate.Equal(due) && t.Priority == domain.PriorityHigh
+	})).Return(nil)
+
+	task, err := suite.usecase.PatchTask(ctx, "1", 0, []byte(`{"title":"Renamed","assignee":null}`), bob)
+
+	suite.Require().NoError(err)
+	suite.Equal("Renamed", task.Title)
+	suite.Equal("Description", task.Description)
+	suite.Equal("bob", task.Owner)
+	suite.False(task.UpdatedAt.IsZero())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestPatchTask_Invalid checks that a patch leaving the task invalid is
+// refused, and that assignees may not patch the task.
+func (suite *TaskUsecaseSuite) TestPatchTask_Invalid() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Title: "Task", Description: "Description", Owner: "root", Assignee: "bob"}, nil)
+
+	_, err := suite.usecase.PatchTask(ctx, "1", 0, []byte(`{"title":null}`), admin)
+	var invalid *domain.ValidationError
+	suite.Require().ErrorAs(err, &invalid)
+	suite.Equal([]string{"title"}, fieldNames(invalid))
+
+	_, err = suite.usecase.PatchTask(ctx, "1", 0, []byte(`{"title":"Mine"}`), bob)
+	suite.ErrorIs(err, domain.ErrForbidden)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestChangesCheckVersion checks that changes based on an older version of
+// the task are refused, and that the repository is asked to change the
+// version that was checked.
+func (suite *TaskUsecaseSuite) TestChangesCheckVersion() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Title: "Task", Description: "Description", Owner: "bob", Version: 4}, nil)
+	suite.mockRepo.On("Update", "1", int64(4), mock.Anything).Return(nil)
+
+	_, err := suite.usecase.UpdateTask(ctx, "1", 3, domain.Task{Title: "Renamed", Description: "Description"}, bob)
+	suite.ErrorIs(err, domain.ErrVersionMismatch)
+	suite.ErrorIs(suite.usecase.DeleteTask(ctx, "1", 5, bob), domain.ErrVersionMismatch)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything, mock.Anything)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Trash", mock.Anything, mock.Anything, mock.Anything)
+
+	task, err := suite.usecase.PatchTask(ctx, "1", domain.AnyVersion, []byte(`{"title":"Renamed"}`), bob)
+	suite.Require().NoError(err)
+	suite.Equal(int64(5), task.Version)
+}
+
+func fieldNames(err *domain.ValidationError) []string {
+	var names []string
+	for _, f := range err.Fields {
+		names = append(names, f.Field)
+	}
+	return names
+}
+
 // TestGetTasksError tests the GetTasks method when an error occurs.
 func (suite *TaskUsecaseSuite) TestGetTasksError() {
-	suite.mockRepo.On("GetAll").Return([]domain.Task(nil), errors.New("database error"))
+	ctx := context.Background()
+	suite.mockRepo.On("Find", mock.Anything).Return(domain.TaskPage{}, errors.New("database error"))
 
-	tasks, err := suite.usecase.GetTasks()
+	page, err := suite.usecase.GetTasks(ctx, domain.TaskQuery{}, admin)
 
 	suite.Assert().Error(err)
-	suite.Assert().Empty(tasks)
+	suite.Assert().Empty(page.Tasks)
 	suite.Contains(err.Error(), "database error")
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
 // TestGetTaskByIDNotFound tests the GetTaskByID method when the task is not found.
 func (suite *TaskUsecaseSuite) TestGetTaskByIDNotFound() {
+	ctx := context.Background()
 	suite.mockRepo.On("GetOne", "1").Return(domain.Task{}, errors.New("task not found"))
 
-	task, err := suite.usecase.GetTaskByID("1")
+	task, err := suite.usecase.GetTaskByID(ctx, "1", admin)
 
 	suite.Assert().Error(err)
 	suite.Assert().Empty(task)
@@ -141,10 +387,11 @@ func (suite *TaskUsecaseSuite) TestGetTaskByIDNotFound() {
 
 // TestAddTaskError tests the AddTask method when an error occurs.
 func (suite *TaskUsecaseSuite) TestAddTaskError() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Task 1", Description: "Description 1", DueDate: time.Now(), Status: "Pending"}
-	suite.mockRepo.On("Add", task).Return(errors.New("insert error"))
+	suite.mockRepo.On("Add", mock.Anything).Return(errors.New("insert error"))
 
-	err := suite.usecase.AddTask(task)
+	err := suite.usecase.AddTask(ctx, task, bob)
 
 	suite.Assert().Error(err)
 	suite.Contains(err.Error(), "insert error")
@@ -153,9 +400,11 @@ func (suite *TaskUsecaseSuite) TestAddTaskError() {
 
 // TestDeleteTaskError tests the DeleteTask method when an error occurs.
 func (suite *TaskUsecaseSuite) TestDeleteTaskError() {
-	suite.mockRepo.On("Delete", "1").Return(errors.New("delete error"))
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1"}, nil)
+	suite.mockRepo.On("Trash", "1", int64(0), mock.Anything).Return(errors.New("delete error"))
 
-	err := suite.usecase.DeleteTask("1")
+	err := suite.usecase.DeleteTask(ctx, "1", 0, admin)
 
 	suite.Assert().Error(err)
 	suite.Contains(err.Error(), "delete error")
@@ -164,17 +413,186 @@ func (suite *TaskUsecaseSuite) TestDeleteTaskError() {
 
 // TestUpdateTaskError tests the UpdateTask method when an error occurs.
 func (suite *TaskUsecaseSuite) TestUpdateTaskError() {
+	ctx := context.Background()
 	task := domain.Task{ID: "1", Title: "Updated Task", Description: "Updated Description", DueDate: time.Now(), Status: "Completed"}
-	suite.mockRepo.On("Update", "1", task).Return(errors.New("update error"))
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1"}, nil)
+	suite.mockRepo.On("Update", "1", int64(0), mock.Anything).Return(errors.New("update error"))
 
-	err := suite.usecase.UpdateTask("1", task)
+	_, err := suite.usecase.UpdateTask(ctx, "1", 0, task, admin)
 
 	suite.Assert().Error(err)
 	suite.Contains(err.Error(), "update error")
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
+// TestTransitionTask tests a legal transition, starting from a legacy status value.
+func (suite *TaskUsecaseSuite) TestTransitionTask() {
+	ctx := context.Background()
+	task := domain.Task{ID: "1", Title: "Task 1", Status: "Pending", Assignee: "bob"}
+	suite.mockRepo.On("GetOne", "1").Return(task, nil)
+	suite.mockRepo.On("SetStatus", "1", "Pending", domain.StatusInProgress, mock.Anything).Return(nil)
+
+	updated, err := suite.usecase.TransitionTask(ctx, "1", "in_progress", bob)
+
+	suite.Assert().NoError(err)
+	suite.Assert().Equal(domain.StatusInProgress, updated.Status)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestTransitionTaskIllegal tests that skipping lifecycle states is rejected.
+func (suite *TaskUsecaseSuite) TestTransitionTaskIllegal() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Status: domain.StatusPending}, nil)
+
+	_, err := suite.usecase.TransitionTask(ctx, "1", domain.StatusDone, admin)
+
+	var transitionErr *domain.TransitionError
+	suite.Assert().ErrorAs(err, &transitionErr)
+	suite.mockRepo.AssertNotCalled(suite.T(), "SetStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestTransitionTaskRoleNotPermitted tests that archiving is reserved to admins.
+func (suite *TaskUsecaseSuite) TestTransitionTaskRoleNotPermitted() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Status: domain.StatusDone, Owner: "bob"}, nil)
+
+	_, err := suite.usecase.TransitionTask(ctx, "1", domain.StatusArchived, bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrTransitionNotPermitted)
+}
+
+// TestTransitionTaskNotFound tests that a missing task is reported as not found.
+func (suite *TaskUsecaseSuite) TestTransitionTaskNotFound() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{}, mongo.ErrNoDocuments)
+
+	_, err := suite.usecase.TransitionTask(ctx, "1", domain.StatusInProgress, admin)
+
+	suite.Assert().ErrorIs(err, domain.ErrTaskNotFound)
+}
+
+// TestGetTasksScopedToActor tests that non-admin listings only cover the actor's tasks.
+func (suite *TaskUsecaseSuite) TestGetTasksScopedToActor() {
+	ctx := context.Background()
+	suite.mockRepo.On("Find", mock.MatchedBy(func(q domain.TaskQuery) bool {
+		return q.VisibleTo == "bob"
+	})).Return(domain.TaskPage{}, nil).Once()
+	suite.mockRepo.On("Find", mock.MatchedBy(func(q domain.TaskQuery) bool {
+		return q.VisibleTo == ""
+	})).Return(domain.TaskPage{}, nil).Once()
+
+	// clients cannot widen their own view
+	_, err := suite.usecase.GetTasks(ctx, domain.TaskQuery{VisibleTo: "alice"}, bob)
+	suite.Assert().NoError(err)
+	_, err = suite.usecase.GetTasks(ctx, domain.TaskQuery{VisibleTo: "alice"}, admin)
+	suite.Assert().NoError(err)
+
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestGetTaskByIDHiddenFromOtherUsers tests that other users' tasks are reported as not found.
+func (suite *TaskUsecaseSuite) TestGetTaskByIDHiddenFromOtherUsers() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Owner: "alice"}, nil)
+
+	_, err := suite.usecase.GetTaskByID(ctx, "1", bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrTaskNotFound)
+}
+
+// TestGetTaskByIDVisibleToAssignee tests that assignees can read tasks they do not own.
+func (suite *TaskUsecaseSuite) TestGetTaskByIDVisibleToAssignee() {
+	ctx := context.Background()
+	task := domain.Task{ID: "1", Owner: "alice", Assignee: "bob"}
+	suite.mockRepo.On("GetOne", "1").Return(task, nil)
+
+	returnedTask, err := suite.usecase.GetTaskByID(ctx, "1", bob)
+
+	suite.Assert().NoError(err)
+	suite.Assert().Equal(task, returnedTask)
+}
+
+// TestDeleteTaskByAssignee tests that assignees may not delete a task.
+func (suite *TaskUsecaseSuite) TestDeleteTaskByAssignee() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Owner: "alice", Assignee: "bob"}, nil)
+
+	err := suite.usecase.DeleteTask(ctx, "1", 0, bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrForbidden)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Trash", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestUpdateTaskOfOtherUser tests that updating someone else's task reports not found.
+func (suite *TaskUsecaseSuite) TestUpdateTaskOfOtherUser() {
+	ctx := context.Background()
+	suite.mockRepo.On("GetOne", "1").Return(domain.Task{ID: "1", Owner: "alice"}, nil)
+
+	_, err := suite.usecase.UpdateTask(ctx, "1", 0, domain.Task{Title: "Mine now", Description: "Description"}, bob)
+
+	suite.Assert().ErrorIs(err, domain.ErrTaskNotFound)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
 // TestTaskUsecaseSuite runs the test suite.
+// TestGetTrash tests that the trash is listed for managers only.
+func (suite *TaskUsecaseSuite) TestGetTrash() {
+	ctx := context.Background()
+	trashed := domain.TaskQuery{SortBy: domain.SortByCreatedAt, Limit: domain.DefaultTaskPageSize, Trashed: true}
+	suite.mockRepo.On("Find", trashed).Return(domain.TaskPage{Tasks: []domain.Task{{ID: "1"}}, Total: 1}, nil)
+
+	page, err := suite.usecase.GetTrash(ctx, domain.TaskQuery{VisibleTo: "mallory"}, admin)
+	suite.NoError(err)
+	suite.Len(page.Tasks, 1)
+
+	_, err = suite.usecase.GetTrash(ctx, domain.TaskQuery{}, bob)
+	suite.ErrorIs(err, domain.ErrPermissionDenied)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Find", 1)
+}
+
+// TestGetTasksIgnoresTrashed tests that clients cannot list the trash through GetTasks.
+func (suite *TaskUsecaseSuite) TestGetTasksIgnoresTrashed() {
+	ctx := context.Background()
+	normalized := domain.TaskQuery{SortBy: domain.SortByCreatedAt, Limit: domain.DefaultTaskPageSize}
+	suite.mockRepo.On("Find", normalized).Return(domain.TaskPage{}, nil)
+
+	_, err := suite.usecase.GetTasks(ctx, domain.TaskQuery{Trashed: true}, admin)
+	suite.NoError(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestRestoreTask tests that managers restore tasks from the trash.
+func (suite *TaskUsecaseSuite) TestRestoreTask() {
+	ctx := context.Background()
+	suite.mockRepo.On("Restore", "1", mock.AnythingOfType("time.Time")).Return(domain.Task{ID: "1", Version: 3}, nil)
+	suite.mockRepo.On("Restore", "2", mock.AnythingOfType("time.Time")).Return(domain.Task{}, domain.ErrNotInTrash)
+
+	task, err := suite.usecase.RestoreTask(ctx, "1", admin)
+	suite.NoError(err)
+	suite.Equal(int64(3), task.Version)
+
+	_, err = suite.usecase.RestoreTask(ctx, "2", admin)
+	suite.ErrorIs(err, domain.ErrNotInTrash)
+
+	_, err = suite.usecase.RestoreTask(ctx, "1", bob)
+	suite.ErrorIs(err, domain.ErrPermissionDenied)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Restore", 2)
+}
+
+// TestPurgeTrash tests that the trash is purged of tasks older than the retention period.
+func (suite *TaskUsecaseSuite) TestPurgeTrash() {
+	ctx := context.Background()
+	suite.mockRepo.On("Purge", mock.MatchedBy(func(before time.Time) bool {
+		age := time.Since(before)
+		return age >= 30*24*time.Hour && age < 30*24*time.Hour+time.Minute
+	})).Return(int64(2), nil)
+
+	purged, err := suite.usecase.PurgeTrash(ctx)
+	suite.NoError(err)
+	suite.Equal(int64(2), purged)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
 func TestTaskUsecaseSuite(t *testing.T) {
 	suite.Run(t, new(TaskUsecaseSuite))
 }
@@ -0,0 +1,23 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+// bound limits ctx to timeout for one operation. Defer the returned func with
+// the operation's error: it releases the context and reports a failure
+// caused by the deadline as domain.ErrTimeout, while keeping the original
+// error for the logs.
+func bound(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func(err *error) {
+		if *err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(*err, domain.ErrTimeout) {
+			*err = fmt.Errorf("%w: %w", domain.ErrTimeout, *err)
+		}
+		cancel()
+	}
+}
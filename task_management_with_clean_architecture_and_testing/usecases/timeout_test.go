@@ -0,0 +1,43 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stalledTaskRepository never answers a listing, like a storage that hangs,
+// until the context of the call ends.
+type stalledTaskRepository struct {
+	repository.TaskRepository
+}
+
+func (stalledTaskRepository) Find(ctx context.Context, query domain.TaskQuery) (domain.TaskPage, error) {
+	<-ctx.Done()
+	return domain.TaskPage{}, ctx.Err()
+}
+
+func TestOperationsAreBoundedByTheirTimeout(t *testing.T) {
+	timeouts := domain.Timeouts{Read: 20 * time.Millisecond, Write: time.Minute}
+	usecase := usecases.NewTaskUsecase(stalledTaskRepository{}, repository.NewInMemoryUserRepository(), timeouts, time.Hour)
+	actor := domain.DefaultRoles().Actor("bob", domain.RoleUser)
+
+	start := time.Now()
+	_, err := usecase.GetTasks(context.Background(), domain.TaskQuery{}, actor)
+	assert.ErrorIs(t, err, domain.ErrTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// a client that went away is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = usecase.GetTasks(ctx, domain.TaskQuery{}, actor)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, domain.ErrTimeout)
+}
@@ -0,0 +1,185 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// twoFactorIssuer names this service in authenticator apps.
+const twoFactorIssuer = "Task Manager"
+
+// recoveryCodeCount is how many recovery codes a confirmed enrollment yields.
+const recoveryCodeCount = 10
+
+// CompleteLogin finishes the login of a user with two-factor authentication,
+// taking the challenge LoginUser returned and a code from their
+// authenticator or one of their recovery codes. Wrong codes count as failed
+// logins.
+func (u *userUsecase) CompleteLogin(ctx context.Context, challengeToken, code, clientIP string) (_ domain.TokenPair, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	username, err := u.tokens.ParseChallengeToken(challengeToken)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	now := time.Now()
+	if err := u.guard.check(username, clientIP, now); err != nil {
+		return domain.TokenPair{}, err
+	}
+
+	user, err := u.repo.LoginUser(ctx, username)
+	if err == mongo.ErrNoDocuments {
+		return domain.TokenPair{}, domain.ErrInvalidChallenge
+	}
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	if !user.Active() {
+		return domain.TokenPair{}, domain.ErrAccountDeactivated
+	}
+	if !user.TwoFactor.Enabled {
+		// disabled since the password was checked
+		return domain.TokenPair{}, domain.ErrInvalidChallenge
+	}
+
+	twoFactor, ok := verifySecondFactor(user.TwoFactor, code, now)
+	if !ok {
+		if err := u.guard.fail(username, clientIP, now); err != nil {
+			return domain.TokenPair{}, err
+		}
+		return domain.TokenPair{}, fmt.Errorf("%w: %w", domain.ErrLoginNotConfirmed, domain.ErrInvalidTwoFactorCode)
+	}
+	if err := u.repo.SetTwoFactor(ctx, username, twoFactor); err != nil {
+		return domain.TokenPair{}, err
+	}
+	if err := u.guard.succeed(username); err != nil {
+		return domain.TokenPair{}, err
+	}
+	return u.startSession(ctx, user, true, now)
+}
+
+// EnrollTwoFactor creates a new TOTP secret for the user. Logins keep
+// working with the password alone until ConfirmTwoFactor.
+func (u *userUsecase) EnrollTwoFactor(ctx context.Context, username string) (_ domain.TwoFactorEnrollment, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	user, err := u.user(ctx, username)
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, err
+	}
+	if user.TwoFactor.Enabled {
+		return domain.TwoFactorEnrollment{}, domain.ErrTwoFactorEnabled
+	}
+
+	secret, err := infrastructures.GenerateTOTPSecret()
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, err
+	}
+	if err := u.repo.SetTwoFactor(ctx, username, domain.TwoFactor{Secret: secret}); err != nil {
+		return domain.TwoFactorEnrollment{}, err
+	}
+	return domain.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    infrastructures.TOTPURI(twoFactorIssuer, username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor turns two-factor authentication on once code shows that
+// the user's authenticator works. It returns the recovery codes, which are
+// only stored hashed and cannot be shown again.
+func (u *userUsecase) ConfirmTwoFactor(ctx context.Context, username, code string) (_ []string, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	user, err := u.user(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactor.Enabled {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+	if user.TwoFactor.Secret == "" {
+		return nil, domain.ErrTwoFactorNotEnrolled
+	}
+	step, ok := infrastructures.ValidateTOTP(user.TwoFactor.Secret, code, time.Now(), 0)
+	if !ok {
+		return nil, domain.ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = infrastructures.GenerateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = infrastructures.HashRecoveryCode(codes[i])
+	}
+	twoFactor := domain.TwoFactor{Enabled: true, Secret: user.TwoFactor.Secret, LastStep: step, RecoveryCodes: hashes}
+	if err := u.repo.SetTwoFactor(ctx, username, twoFactor); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off. It takes a current
+// code or a recovery code, so a stolen access token is not enough; wrong
+// codes count as failed logins.
+func (u *userUsecase) DisableTwoFactor(ctx context.Context, username, code string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	now := time.Now()
+	if err := u.guard.check(username, "", now); err != nil {
+		return err
+	}
+	user, err := u.user(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactor.Enabled {
+		return domain.ErrTwoFactorNotEnabled
+	}
+	if _, ok := verifySecondFactor(user.TwoFactor, code, now); !ok {
+		if err := u.guard.fail(username, "", now); err != nil {
+			return err
+		}
+		return domain.ErrInvalidTwoFactorCode
+	}
+	return u.repo.SetTwoFactor(ctx, username, domain.TwoFactor{})
+}
+
+// user loads username, reporting a missing user as domain.ErrUserNotFound.
+func (u *userUsecase) user(ctx context.Context, username string) (domain.User, error) {
+	user, err := u.repo.LoginUser(ctx, username)
+	if err == mongo.ErrNoDocuments {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+// verifySecondFactor checks code as a TOTP code, then as a recovery code.
+// It returns the second factor with the code used up.
+func verifySecondFactor(twoFactor domain.TwoFactor, code string, now time.Time) (domain.TwoFactor, bool) {
+	if step, ok := infrastructures.ValidateTOTP(twoFactor.Secret, code, now, twoFactor.LastStep); ok {
+		twoFactor.LastStep = step
+		return twoFactor, true
+	}
+
+	hash := infrastructures.HashRecoveryCode(code)
+	for i, stored := range twoFactor.RecoveryCodes {
+		if stored == hash {
+			remaining := make([]string, 0, len(twoFactor.RecoveryCodes)-1)
+			remaining = append(remaining, twoFactor.RecoveryCodes[:i]...)
+			twoFactor.RecoveryCodes = append(remaining, twoFactor.RecoveryCodes[i+1:]...)
+			return twoFactor, true
+		}
+	}
+	return twoFactor, false
+}
@@ -0,0 +1,171 @@
+package usecases_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TwoFactorSuite runs the two-factor flows against in-memory repositories,
+// since every step reads what the previous one stored.
+type TwoFactorSuite struct {
+	suite.Suite
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	tokens   *infrastructures.TokenService
+	usecase  usecases.UserUsecase
+}
+
+func (suite *TwoFactorSuite) SetupTest() {
+	ctx := context.Background()
+	tokens, hasher := newTestServices(suite.T())
+	suite.tokens = tokens
+	suite.users = repository.NewInMemoryUserRepository()
+	suite.sessions = repository.NewInMemorySessionRepository()
+	suite.usecase = usecases.NewUserUsecase(suite.users, repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0)), suite.sessions, repository.NewInMemoryLoginAttemptRepository(), repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), tokens, hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.users.Register(ctx, domain.User{Username: "bob", Password: string(hashed), Role: domain.RoleUser}))
+}
+
+func (suite *TwoFactorSuite) code(secret string, at time.Time) string {
+	code, err := infrastructures.TOTPCode(secret, at)
+	suite.Require().NoError(err)
+	return code
+}
+
+// enable enrolls bob and returns his secret and recovery codes.
+func (suite *TwoFactorSuite) enable() (string, []string) {
+	ctx := context.Background()
+	enrollment, err := suite.usecase.EnrollTwoFactor(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.Contains(enrollment.URI, "secret="+enrollment.Secret)
+
+	codes, err := suite.usecase.ConfirmTwoFactor(ctx, "bob", suite.code(enrollment.Secret, time.Now()))
+	suite.Require().NoError(err)
+	suite.Len(codes, 10)
+	return enrollment.Secret, codes
+}
+
+func (suite *TwoFactorSuite) challenge() string {
+	ctx := context.Background()
+	result, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: "password"}, "192.0.2.1")
+	suite.Require().NoError(err)
+	suite.Require().True(result.TwoFactorRequired)
+	suite.Empty(result.AccessToken)
+	return result.ChallengeToken
+}
+
+func (suite *TwoFactorSuite) TestEnrollmentNeedsConfirmation() {
+	ctx := context.Background()
+	_, err := suite.usecase.ConfirmTwoFactor(ctx, "bob", "123456")
+	suite.ErrorIs(err, domain.ErrTwoFactorNotEnrolled)
+
+	enrollment, err := suite.usecase.EnrollTwoFactor(ctx, "bob")
+	suite.Require().NoError(err)
+	_, err = suite.usecase.ConfirmTwoFactor(ctx, "bob", "000000")
+	suite.ErrorIs(err, domain.ErrInvalidTwoFactorCode)
+
+	// until confirmed, the password alone is enough
+	result, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: "password"}, "192.0.2.1")
+	suite.Require().NoError(err)
+	suite.False(result.TwoFactorRequired)
+	suite.NotEmpty(result.AccessToken)
+
+	_, err = suite.usecase.ConfirmTwoFactor(ctx, "bob", suite.code(enrollment.Secret, time.Now()))
+	suite.Require().NoError(err)
+	_, err = suite.usecase.EnrollTwoFactor(ctx, "bob")
+	suite.ErrorIs(err, domain.ErrTwoFactorEnabled)
+
+	user, err := suite.users.LoginUser(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.True(user.TwoFactor.Enabled)
+	suite.Len(user.TwoFactor.RecoveryCodes, 10)
+}
+
+func (suite *TwoFactorSuite) TestLoginWithCode() {
+	ctx := context.Background()
+	secret, _ := suite.enable()
+
+	_, err := suite.usecase.CompleteLogin(ctx, suite.challenge(), "000000", "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidTwoFactorCode)
+	_, err = suite.usecase.CompleteLogin(ctx, "not a challenge", suite.code(secret, time.Now()), "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidChallenge)
+
+	// the code used to confirm is spent, the next one works once
+	code := suite.code(secret, time.Now().Add(30*time.Second))
+	tokens, err := suite.usecase.CompleteLogin(ctx, suite.challenge(), code, "192.0.2.1")
+	suite.Require().NoError(err)
+	_, err = suite.usecase.CompleteLogin(ctx, suite.challenge(), code, "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidTwoFactorCode)
+
+	sessionID, _, err := suite.tokens.ParseRefreshToken(tokens.RefreshToken)
+	suite.Require().NoError(err)
+	session, err := suite.sessions.Get(ctx, sessionID)
+	suite.Require().NoError(err)
+	suite.True(session.SecondFactor)
+	refreshed, err := suite.usecase.Refresh(ctx, tokens.RefreshToken)
+	suite.Require().NoError(err)
+	suite.NotEmpty(refreshed.AccessToken)
+}
+
+func (suite *TwoFactorSuite) TestRecoveryCodesWorkOnce() {
+	ctx := context.Background()
+	_, codes := suite.enable()
+
+	_, err := suite.usecase.CompleteLogin(ctx, suite.challenge(), codes[3], "192.0.2.1")
+	suite.Require().NoError(err)
+	_, err = suite.usecase.CompleteLogin(ctx, suite.challenge(), codes[3], "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidTwoFactorCode)
+
+	user, err := suite.users.LoginUser(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.Len(user.TwoFactor.RecoveryCodes, 9)
+}
+
+func (suite *TwoFactorSuite) TestWrongCodesLockTheAccount() {
+	ctx := context.Background()
+	suite.enable()
+	challenge := suite.challenge()
+
+	for i := 0; i < domain.DefaultLoginPolicy().MaxFailures; i++ {
+		_, err := suite.usecase.CompleteLogin(ctx, challenge, "000000", "192.0.2.1")
+		suite.Require().ErrorIs(err, domain.ErrInvalidTwoFactorCode)
+	}
+	_, err := suite.usecase.CompleteLogin(ctx, challenge, "000000", "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrTooManyAttempts)
+}
+
+func (suite *TwoFactorSuite) TestDisable() {
+	ctx := context.Background()
+	secret, codes := suite.enable()
+
+	suite.ErrorIs(suite.usecase.DisableTwoFactor(ctx, "bob", "000000"), domain.ErrInvalidTwoFactorCode)
+	suite.Require().NoError(suite.usecase.DisableTwoFactor(ctx, "bob", codes[0]))
+	suite.ErrorIs(suite.usecase.DisableTwoFactor(ctx, "bob", suite.code(secret, time.Now())), domain.ErrTwoFactorNotEnabled)
+
+	result, err := suite.usecase.LoginUser(ctx, domain.User{Username: "bob", Password: "password"}, "192.0.2.1")
+	suite.Require().NoError(err)
+	suite.False(result.TwoFactorRequired)
+
+	// a challenge issued before disabling no longer completes
+	_, codes = suite.enable()
+	challenge := suite.challenge()
+	suite.Require().NoError(suite.usecase.DisableTwoFactor(ctx, "bob", codes[0]))
+	_, err = suite.usecase.CompleteLogin(ctx, challenge, codes[1], "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidChallenge)
+}
+
+func TestTwoFactorSuite(t *testing.T) {
+	suite.Run(t, new(TwoFactorSuite))
+}
@@ -0,0 +1,90 @@
+package usecases
+
+import (
+	"context"
+	"task_with_clean_arc_and_test/domain"
+	"time"
+)
+
+// ListUsers returns a page of the users selected by query.
+func (u *userUsecase) ListUsers(ctx context.Context, query domain.UserQuery) (_ domain.UserPage, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	if err := query.Normalize(); err != nil {
+		return domain.UserPage{}, err
+	}
+	return u.repo.Find(ctx, query)
+}
+
+// GetUser returns what administrators see of username.
+func (u *userUsecase) GetUser(ctx context.Context, username string) (_ domain.UserProfile, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	user, err := u.user(ctx, username)
+	if err != nil {
+		return domain.UserProfile{}, err
+	}
+	return user.Profile(), nil
+}
+
+// Demote takes every role but the basic one from the user and ends their
+// sessions, so tokens carrying the old role stop working at once. Actors
+// cannot demote themselves, which could leave nobody to manage users.
+func (u *userUsecase) Demote(ctx context.Context, username string, actor domain.Actor) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if username == actor.Username {
+		return domain.ErrSelfAdministration
+	}
+	if err := u.repo.SetRole(ctx, username, domain.RoleUser); err != nil {
+		return err
+	}
+	u.statuses.forget(username)
+	return u.sessions.RevokeUser(ctx, username)
+}
+
+// DeleteUser removes the user and everything tied to their account. Their
+// tasks, owned or assigned, go to reassignTo, or are left without owner or
+// assignee if it is empty; it returns how many tasks changed hands.
+func (u *userUsecase) DeleteUser(ctx context.Context, username, reassignTo string, actor domain.Actor) (_ int64, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if username == actor.Username {
+		return 0, domain.ErrSelfAdministration
+	}
+	if _, err := u.user(ctx, username); err != nil {
+		return 0, err
+	}
+	if reassignTo != "" {
+		exists, err := u.repo.UsernameExists(ctx, reassignTo)
+		if err != nil {
+			return 0, err
+		}
+		if !exists || reassignTo == username {
+			return 0, domain.ErrUnknownAssignee.Reword("reassign_to names no existing user")
+		}
+	}
+
+	reassigned, err := u.tasks.ReassignUser(ctx, username, reassignTo, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if err := u.repo.Delete(ctx, username); err != nil {
+		return reassigned, err
+	}
+	u.statuses.forget(username)
+	if err := u.sessions.RevokeUser(ctx, username); err != nil {
+		return reassigned, err
+	}
+	if err := u.resets.DeleteUser(ctx, username); err != nil {
+		return reassigned, err
+	}
+	if err := u.apiKeys.DeleteUser(ctx, username); err != nil {
+		return reassigned, err
+	}
+	return reassigned, u.guard.unlock(username)
+}
@@ -0,0 +1,151 @@
+package usecases_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"task_with_clean_arc_and_test/domain"
+	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
+	"task_with_clean_arc_and_test/usecases"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// UserAdminSuite runs the user administration use cases against in-memory
+// repositories, since deleting a user reaches into tasks and sessions.
+type UserAdminSuite struct {
+	suite.Suite
+	users    repository.UserRepository
+	tasks    repository.TaskRepository
+	sessions repository.SessionRepository
+	usecase  usecases.UserUsecase
+	admin    domain.Actor
+}
+
+func (suite *UserAdminSuite) SetupTest() {
+	ctx := context.Background()
+	suite.users = repository.NewInMemoryUserRepository()
+	suite.tasks = repository.NewInMemoryTaskRepository(repository.NewInMemorySequence(0))
+	suite.sessions = repository.NewInMemorySessionRepository()
+	tokens, hasher := newTestServices(suite.T())
+	suite.usecase = usecases.NewUserUsecase(suite.users, suite.tasks, suite.sessions, repository.NewInMemoryLoginAttemptRepository(), repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), tokens, hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+	suite.admin = domain.Actor{Username: "root", Role: domain.RoleAdmin}
+
+	for _, user := range []domain.User{
+		{Username: "root", Password: "hash", Role: domain.RoleAdmin},
+		{Username: "alice", Password: "hash", Role: domain.RoleAdmin},
+		{Username: "bob", Password: "hash", Role: domain.RoleUser},
+	} {
+		user.Status = domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+		suite.Require().NoError(suite.users.Register(ctx, user))
+	}
+}
+
+func (suite *UserAdminSuite) TestListUsers() {
+	ctx := context.Background()
+	page, err := suite.usecase.ListUsers(ctx, domain.UserQuery{Role: domain.RoleAdmin})
+	suite.Require().NoError(err)
+	suite.Require().Len(page.Users, 2)
+	suite.Equal("alice", page.Users[0].Username)
+	suite.Equal(domain.AccountActive, page.Users[0].Status)
+
+	_, err = suite.usecase.ListUsers(ctx, domain.UserQuery{Status: "banned"})
+	suite.ErrorIs(err, domain.ErrInvalidAccountState)
+	_, err = suite.usecase.ListUsers(ctx, domain.UserQuery{Limit: 1000})
+	suite.ErrorIs(err, domain.ErrInvalidUserLimit)
+}
+
+func (suite *UserAdminSuite) TestGetUser() {
+	ctx := context.Background()
+	profile, err := suite.usecase.GetUser(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.Equal(domain.RoleUser, profile.Role)
+
+	_, err = suite.usecase.GetUser(ctx, "ghost")
+	suite.ErrorIs(err, domain.ErrUserNotFound)
+}
+
+func (suite *UserAdminSuite) TestDemoteEndsSessions() {
+	ctx := context.Background()
+	session := domain.Session{ID: "s1", Username: "alice", ExpiresAt: time.Now().Add(time.Hour)}
+	suite.Require().NoError(suite.sessions.Create(ctx, session))
+
+	suite.Require().NoError(suite.usecase.Demote(ctx, "alice", suite.admin))
+	profile, err := suite.usecase.GetUser(ctx, "alice")
+	suite.Require().NoError(err)
+	suite.Equal(domain.RoleUser, profile.Role)
+	active, err := suite.usecase.SessionActive(ctx, "s1")
+	suite.NoError(err)
+	suite.False(active)
+
+	suite.ErrorIs(suite.usecase.Demote(ctx, "root", suite.admin), domain.ErrSelfAdministration)
+	suite.ErrorIs(suite.usecase.Demote(ctx, "ghost", suite.admin), domain.ErrUserNotFound)
+}
+
+func (suite *UserAdminSuite) TestAssignRoleEndsSessions() {
+	ctx := context.Background()
+	session := domain.Session{ID: "s1", Username: "alice", ExpiresAt: time.Now().Add(time.Hour)}
+	suite.Require().NoError(suite.sessions.Create(ctx, session))
+
+	suite.Require().NoError(suite.usecase.AssignRole(ctx, "alice", domain.RoleAdmin, suite.admin))
+	profile, err := suite.usecase.GetUser(ctx, "alice")
+	suite.Require().NoError(err)
+	suite.Equal(domain.RoleAdmin, profile.Role)
+	active, err := suite.usecase.SessionActive(ctx, "s1")
+	suite.NoError(err)
+	suite.False(active)
+
+	// otherwise an admin could demote themselves past the guard in Demote
+	suite.ErrorIs(suite.usecase.AssignRole(ctx, "root", domain.RoleUser, suite.admin), domain.ErrSelfAdministration)
+	suite.ErrorIs(suite.usecase.AssignRole(ctx, "ghost", domain.RoleUser, suite.admin), domain.ErrUserNotFound)
+}
+
+func (suite *UserAdminSuite) TestDeleteUserReassignsTasks() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.tasks.Add(ctx, domain.Task{Title: "t1", Description: "d", Owner: "bob"}))
+	suite.Require().NoError(suite.tasks.Add(ctx, domain.Task{Title: "t2", Description: "d", Owner: "alice", Assignee: "bob"}))
+
+	_, err := suite.usecase.DeleteUser(ctx, "bob", "ghost", suite.admin)
+	suite.ErrorIs(err, domain.ErrUnknownAssignee)
+	_, err = suite.usecase.DeleteUser(ctx, "bob", "bob", suite.admin)
+	suite.ErrorIs(err, domain.ErrUnknownAssignee)
+	_, err = suite.usecase.DeleteUser(ctx, "root", "", suite.admin)
+	suite.ErrorIs(err, domain.ErrSelfAdministration)
+
+	reassigned, err := suite.usecase.DeleteUser(ctx, "bob", "alice", suite.admin)
+	suite.Require().NoError(err)
+	suite.Equal(int64(2), reassigned)
+	for _, id := range []string{"1", "2"} {
+		task, err := suite.tasks.GetOne(ctx, id)
+		suite.Require().NoError(err)
+		suite.Equal("alice", task.Owner)
+	}
+	task, err := suite.tasks.GetOne(ctx, "2")
+	suite.Require().NoError(err)
+	suite.Equal("alice", task.Assignee)
+
+	_, err = suite.usecase.GetUser(ctx, "bob")
+	suite.ErrorIs(err, domain.ErrUserNotFound)
+	_, err = suite.usecase.DeleteUser(ctx, "bob", "", suite.admin)
+	suite.ErrorIs(err, domain.ErrUserNotFound)
+}
+
+func (suite *UserAdminSuite) TestDeletedUserIsInactive() {
+	ctx := context.Background()
+	active, err := suite.usecase.UserActive(ctx, "bob")
+	suite.Require().NoError(err)
+	suite.True(active)
+
+	_, err = suite.usecase.DeleteUser(ctx, "bob", "", suite.admin)
+	suite.Require().NoError(err)
+	active, err = suite.usecase.UserActive(ctx, "bob")
+	suite.NoError(err)
+	suite.False(active)
+}
+
+func TestUserAdminSuite(t *testing.T) {
+	suite.Run(t, new(UserAdminSuite))
+}
@@ -0,0 +1,75 @@
+package usecases
+
+import (
+	"sync"
+	"time"
+)
+
+// userStatusTTL bounds how long another server instance may keep accepting a
+// user after they were deactivated. Changes made through this instance apply
+// at once, because they evict the entry.
+const userStatusTTL = 30 * time.Second
+
+// maxCachedUsers caps the cache; expired entries are swept when it fills up.
+const maxCachedUsers = 10000
+
+// userStatusCache remembers whether users are active and which role they
+// have, so the auth middleware does not hit storage on every request.
+type userStatusCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]userStatusEntry
+}
+
+// userStatus is what the cache remembers of a user.
+type userStatus struct {
+	exists bool // false once the user was deleted
+	active bool
+	role   string
+}
+
+type userStatusEntry struct {
+	status  userStatus
+	expires time.Time
+}
+
+func newUserStatusCache(ttl time.Duration) *userStatusCache {
+	return &userStatusCache{ttl: ttl, entries: make(map[string]userStatusEntry)}
+}
+
+// get returns the cached status of username, if it is still fresh at now.
+func (c *userStatusCache) get(username string, now time.Time) (_ userStatus, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[username]
+	if !ok || !now.Before(entry.expires) {
+		return userStatus{}, false
+	}
+	return entry.status, true
+}
+
+func (c *userStatusCache) put(username string, status userStatus, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCachedUsers {
+		for name, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, name)
+			}
+		}
+	}
+	if len(c.entries) >= maxCachedUsers {
+		// still full of fresh entries: start over rather than grow
+		c.entries = make(map[string]userStatusEntry)
+	}
+	c.entries[username] = userStatusEntry{status: status, expires: now.Add(c.ttl)}
+}
+
+func (c *userStatusCache) forget(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, username)
+}
@@ -1,120 +1,422 @@
 package usecases
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"task_with_clean_arc_and_test/domain"
 	"task_with_clean_arc_and_test/infrastructures"
 	"task_with_clean_arc_and_test/repository"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserUsecase interface {
-	Register(user domain.User) error
-	LoginUser(user domain.User) (string, error)
-	RegisterAdmin(user domain.User) error
-	UpdateUser(username string) error
-	Activate(username string) error
-	Deactivate(username string) error
+	Register(ctx context.Context, user domain.User) error
+	LoginUser(ctx context.Context, user domain.User, clientIP string) (domain.LoginResult, error)
+	CompleteLogin(ctx context.Context, challengeToken, code, clientIP string) (domain.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error)
+	Logout(ctx context.Context, sessionID string) error
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+	UserActive(ctx context.Context, username string) (bool, error)
+	RegisterAdmin(ctx context.Context, user domain.User) error
+	AssignRole(ctx context.Context, username, role string, actor domain.Actor) error
+	Activate(ctx context.Context, username string) error
+	Deactivate(ctx context.Context, username, reason string) error
+	Unlock(ctx context.Context, username string) error
+	EnrollTwoFactor(ctx context.Context, username string) (domain.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, username, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, username, code string) error
+	ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, username string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	ListUsers(ctx context.Context, query domain.UserQuery) (domain.UserPage, error)
+	GetUser(ctx context.Context, username string) (domain.UserProfile, error)
+	Demote(ctx context.Context, username string, actor domain.Actor) error
+	DeleteUser(ctx context.Context, username, reassignTo string, actor domain.Actor) (int64, error)
+	CreateAPIKey(ctx context.Context, actor domain.Actor, secondFactor bool, request domain.APIKeyRequest) (domain.CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context, username string) ([]domain.APIKeyInfo, error)
+	RevokeAPIKey(ctx context.Context, username, id string) error
+	AuthenticateAPIKey(ctx context.Context, token string) (domain.APIKey, string, error)
 }
 
 type userUsecase struct {
-	repo repository.UserRepository
+	repo     repository.UserRepository
+	tasks    repository.TaskRepository
+	sessions repository.SessionRepository
+	resets   repository.PasswordResetRepository
+	apiKeys  repository.APIKeyRepository
+	notifier infrastructures.Notifier
+	tokens   *infrastructures.TokenService
+	hasher   *infrastructures.PasswordHasher
+	roles    domain.RoleSet
+	statuses *userStatusCache
+	guard    loginGuard
+	// passwords decides which new passwords are accepted
+	passwords domain.PasswordPolicy
+	timeouts  domain.Timeouts
 }
 
-func NewUserUsecase(repo repository.UserRepository) UserUsecase {
-	return &userUsecase{repo: repo}
+// NewUserUsecase creates the user use cases; tasks are handed over when
+// their user is deleted, roles lists the roles that can be assigned to users,
+// policy limits failed logins, which are counted in attempts, and passwords
+// is checked for every new password. Password reset tokens are kept in resets
+// and sent through notifier, API keys in apiKeys. Tokens are issued by tokens
+// and passwords hashed by hasher. Every operation is bounded by timeouts.
+func NewUserUsecase(repo repository.UserRepository, tasks repository.TaskRepository, sessions repository.SessionRepository, attempts repository.LoginAttemptRepository, resets repository.PasswordResetRepository, apiKeys repository.APIKeyRepository, notifier infrastructures.Notifier, tokens *infrastructures.TokenService, hasher *infrastructures.PasswordHasher, roles domain.RoleSet, policy domain.LoginPolicy, passwords domain.PasswordPolicy, timeouts domain.Timeouts) UserUsecase {
+	return &userUsecase{
+		repo:     repo,
+		tasks:    tasks,
+		sessions: sessions,
+		resets:   resets,
+		apiKeys:  apiKeys,
+		notifier: notifier,
+		tokens:   tokens,
+		hasher:   hasher,
+		roles:    roles,
+		statuses: newUserStatusCache(userStatusTTL),
+		guard:    loginGuard{attempts: attempts, policy: policy},
+
+		passwords: passwords,
+		timeouts:  timeouts,
+	}
 }
 
-func (u *userUsecase) Register(user domain.User) error {
+func (u *userUsecase) Register(ctx context.Context, user domain.User) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if err := u.passwords.Check(user.Username, user.Password); err != nil {
+		return err
+	}
+
 	// Check if username already exists
-	exists, err := u.repo.UsernameExists(user.Username)
+	exists, err := u.repo.UsernameExists(ctx, user.Username)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return errors.New("username already exists")
+		return domain.ErrUsernameTaken
 	}
 
 	// Hash the user's password
-	hashedPassword, err := infrastructures.HashPassword(user.Password)
+	hashedPassword, err := u.hasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
 	user.Password = hashedPassword
 
 	// Set user role and activation status
-	user.Activate = "true"
-	err = u.repo.Register(user)
+	user.Role = domain.RoleUser
+	user.Status = domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+	user.LegacyActivate = ""
+	user.TwoFactor = domain.TwoFactor{}
+	err = u.repo.Register(ctx, user)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (u *userUsecase) LoginUser(user domain.User) (string, error) {
-	// Check if the username exists
-	exists, err := u.repo.UsernameExists(user.Username)
+// LoginUser checks the credentials of user, coming from clientIP. Users
+// without two-factor authentication get a session right away, the others a
+// challenge to complete with CompleteLogin. Every failure is reported as
+// domain.ErrInvalidCredentials, and repeated failures throttle the account
+// and the client.
+func (u *userUsecase) LoginUser(ctx context.Context, user domain.User, clientIP string) (_ domain.LoginResult, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	now := time.Now()
+	if err := u.guard.check(user.Username, clientIP, now); err != nil {
+		return domain.LoginResult{}, err
+	}
+
+	existingUser, err := u.repo.LoginUser(ctx, user.Username)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return domain.LoginResult{}, err
+	}
+	if err == mongo.ErrNoDocuments {
+		u.hasher.CheckUnknown(user.Password)
+	} else {
+		err = u.hasher.Check(user.Password, existingUser.Password)
+	}
 	if err != nil {
-		return "", err
+		if err := u.guard.fail(user.Username, clientIP, now); err != nil {
+			return domain.LoginResult{}, err
+		}
+		return domain.LoginResult{}, domain.ErrInvalidCredentials
 	}
-	if !exists {
-		return "", errors.New("user not found")
+	if err := u.guard.succeed(user.Username); err != nil {
+		return domain.LoginResult{}, err
+	}
+	if u.hasher.NeedsRehash(existingUser.Password) {
+		u.rehashPassword(ctx, existingUser.Username, user.Password)
+	}
+
+	// only tell the right password holder that the account is disabled
+	if !existingUser.Active() {
+		return domain.LoginResult{}, domain.ErrAccountDeactivated
+	}
+
+	if existingUser.TwoFactor.Enabled {
+		challenge, err := u.tokens.GenerateChallengeToken(existingUser.Username)
+		if err != nil {
+			return domain.LoginResult{}, err
+		}
+		return domain.LoginResult{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+	tokens, err := u.startSession(ctx, existingUser, false, now)
+	if err != nil {
+		return domain.LoginResult{}, err
 	}
-	// Fetch the user from the repository by username
-	existingUser, err := u.repo.LoginUser(user.Username)
+	return domain.LoginResult{TokenPair: tokens}, nil
+}
+
+// startSession starts the session every login's tokens are bound to.
+func (u *userUsecase) startSession(ctx context.Context, user domain.User, secondFactor bool, now time.Time) (domain.TokenPair, error) {
+	sessionID, err := newSessionID()
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return "", errors.New("user not found")
+		return domain.TokenPair{}, err
+	}
+	session := domain.Session{
+		ID:           sessionID,
+		Username:     user.Username,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(infrastructures.RefreshTokenTTL),
+		SecondFactor: secondFactor,
+	}
+	if err := u.sessions.Create(ctx, session); err != nil {
+		return domain.TokenPair{}, err
+	}
+	return u.issueTokens(user, session)
+}
+
+// Refresh trades a refresh token for a new token pair. Each refresh token
+// works once: presenting one that was already traded means it leaked, so the
+// whole session is revoked.
+func (u *userUsecase) Refresh(ctx context.Context, refreshToken string) (_ domain.TokenPair, err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	sessionID, generation, err := u.tokens.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	session, err := u.sessions.Get(ctx, sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return domain.TokenPair{}, domain.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	if !session.Active(time.Now()) {
+		return domain.TokenPair{}, domain.ErrInvalidRefreshToken
+	}
+
+	if generation != session.Generation {
+		return domain.TokenPair{}, u.revokeReused(ctx, sessionID)
+	}
+	expiresAt := time.Now().Add(infrastructures.RefreshTokenTTL)
+	err = u.sessions.Rotate(ctx, sessionID, generation, expiresAt)
+	if errors.Is(err, domain.ErrSessionChanged) {
+		// another request traded the same token first
+		return domain.TokenPair{}, u.revokeReused(ctx, sessionID)
+	}
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	session.Generation++
+	session.ExpiresAt = expiresAt
+
+	// reload the user so a new role applies from this token on
+	user, err := u.repo.LoginUser(ctx, session.Username)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	if !user.Active() {
+		if err := u.sessions.Revoke(ctx, sessionID); err != nil {
+			return domain.TokenPair{}, err
 		}
-		return "", err
+		return domain.TokenPair{}, domain.ErrAccountDeactivated
 	}
+	return u.issueTokens(user, session)
+}
 
-	// Check if the provided password matches the stored hashed password
-	err = infrastructures.CheckPasswordHash(user.Password, existingUser.Password)
+func (u *userUsecase) revokeReused(ctx context.Context, sessionID string) error {
+	if err := u.sessions.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	return domain.ErrRefreshTokenReused
+}
+
+// Logout ends the session, invalidating its access and refresh tokens.
+func (u *userUsecase) Logout(ctx context.Context, sessionID string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	return u.sessions.Revoke(ctx, sessionID)
+}
+
+// SessionActive reports whether tokens of the session are still accepted.
+func (u *userUsecase) SessionActive(ctx context.Context, sessionID string) (_ bool, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
+
+	session, err := u.sessions.Get(ctx, sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return false, nil
+	}
 	if err != nil {
-		return "", errors.New("invalid password")
+		return false, err
 	}
+	return session.Active(time.Now()), nil
+}
+
+// UserActive reports whether the user may still use their tokens. Results
+// are cached briefly; see userStatusTTL.
+func (u *userUsecase) UserActive(ctx context.Context, username string) (_ bool, err error) {
+	ctx, release := bound(ctx, u.timeouts.Read)
+	defer release(&err)
 
-	// Generate a JWT token for the authenticated user
-	token, err := infrastructures.GenerateToken(existingUser)
+	status, err := u.status(ctx, username)
 	if err != nil {
-		return "", err
+		return false, err
+	}
+	// deleted users are as good as deactivated
+	return status.exists && status.active, nil
+}
+
+// status returns what the cache knows of username, reading it from storage
+// when the cache does not know.
+func (u *userUsecase) status(ctx context.Context, username string) (userStatus, error) {
+	now := time.Now()
+	if status, ok := u.statuses.get(username, now); ok {
+		return status, nil
 	}
 
-	return token, nil
+	user, err := u.repo.LoginUser(ctx, username)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return userStatus{}, err
+	}
+	status := userStatus{exists: err == nil}
+	if status.exists {
+		status.active = user.Active()
+		status.role = user.Role
+	}
+	u.statuses.put(username, status, now)
+	return status, nil
+}
+
+func (u *userUsecase) issueTokens(user domain.User, session domain.Session) (domain.TokenPair, error) {
+	access, err := u.tokens.GenerateToken(user, session)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	refresh, err := u.tokens.GenerateRefreshToken(session)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	return domain.TokenPair{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
-func (u *userUsecase) RegisterAdmin(user domain.User) error {
+func (u *userUsecase) RegisterAdmin(ctx context.Context, user domain.User) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if err := u.passwords.Check(user.Username, user.Password); err != nil {
+		return err
+	}
+
 	// Check if username already exists
-	exists, err := u.repo.UsernameExists(user.Username)
+	exists, err := u.repo.UsernameExists(ctx, user.Username)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return errors.New("username already exists")
+		return domain.ErrUsernameTaken
 	}
 
 	// Hash the user's password
-	hashedPassword, err := infrastructures.HashPassword(user.Password)
+	hashedPassword, err := u.hasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
 	user.Password = hashedPassword
-	user.Role = "admin"
-	user.Activate = "true"
+	user.Role = domain.RoleAdmin
+	user.Status = domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+	user.LegacyActivate = ""
+	user.TwoFactor = domain.TwoFactor{}
+
+	return u.repo.RegisterAdmin(ctx, user)
+}
 
-	return u.repo.RegisterAdmin(user)
+// AssignRole gives the user one of the configured roles. Tokens carry the
+// role, so it ends the user's sessions and the change applies from their
+// next login. Like Demote, it refuses to change the actor's own role.
+func (u *userUsecase) AssignRole(ctx context.Context, username, role string, actor domain.Actor) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	if !u.roles.Defines(role) {
+		return domain.ErrUnknownRole
+	}
+	if username == actor.Username {
+		return domain.ErrSelfAdministration
+	}
+	if err := u.repo.SetRole(ctx, username, role); err != nil {
+		return err
+	}
+	u.statuses.forget(username)
+	return u.sessions.RevokeUser(ctx, username)
 }
 
-func (u *userUsecase) UpdateUser(username string) error {
-	return u.repo.UpdateUser(username)
+func (u *userUsecase) Activate(ctx context.Context, username string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	status := domain.AccountStatus{State: domain.AccountActive, ChangedAt: time.Now()}
+	if err := u.repo.SetAccountStatus(ctx, username, status); err != nil {
+		return err
+	}
+	u.statuses.forget(username)
+	return nil
 }
 
-func (u *userUsecase) Activate(username string) error {
-	return u.repo.Activate(username)
+// Deactivate disables the user and ends all of their sessions at once.
+func (u *userUsecase) Deactivate(ctx context.Context, username, reason string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	status := domain.AccountStatus{State: domain.AccountDeactivated, Reason: reason, ChangedAt: time.Now()}
+	if err := u.repo.SetAccountStatus(ctx, username, status); err != nil {
+		return err
+	}
+	u.statuses.forget(username)
+	return u.sessions.RevokeUser(ctx, username)
 }
 
-func (u *userUsecase) Deactivate(username string) error {
-	return u.repo.Deactivate(username)
+// Unlock lifts the lockout that failed logins put on the account.
+func (u *userUsecase) Unlock(ctx context.Context, username string) (err error) {
+	ctx, release := bound(ctx, u.timeouts.Write)
+	defer release(&err)
+
+	exists, err := u.repo.UsernameExists(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return domain.ErrUserNotFound
+	}
+	return u.guard.unlock(username)
 }
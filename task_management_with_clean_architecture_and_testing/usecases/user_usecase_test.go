@@ -1,14 +1,20 @@
 package usecases_test
 
 import (
+	"context"
+	"io"
 	"testing"
 
 	"task_with_clean_arc_and_test/domain"
 	"task_with_clean_arc_and_test/infrastructures"
+	"task_with_clean_arc_and_test/repository"
 	"task_with_clean_arc_and_test/usecases"
 
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // MockUserRepository is a mock implementation of the UserRepository interface.
@@ -16,85 +22,156 @@ type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockUserRepository) Register(user domain.User) error {
+func (m *MockUserRepository) Register(ctx context.Context, user domain.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) LoginUser(username string) (domain.User, error) {
+func (m *MockUserRepository) LoginUser(ctx context.Context, username string) (domain.User, error) {
 	args := m.Called(username)
 	return args.Get(0).(domain.User), args.Error(1)
 }
 
-func (m *MockUserRepository) RegisterAdmin(user domain.User) error {
+func (m *MockUserRepository) RegisterAdmin(ctx context.Context, user domain.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) UpdateUser(username string) error {
-	args := m.Called(username)
+func (m *MockUserRepository) SetRole(ctx context.Context, username, role string) error {
+	args := m.Called(username, role)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) Activate(username string) error {
-	args := m.Called(username)
+func (m *MockUserRepository) SetAccountStatus(ctx context.Context, username string, status domain.AccountStatus) error {
+	args := m.Called(username, status)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) Deactivate(username string) error {
-	args := m.Called(username)
+func (m *MockUserRepository) SetTwoFactor(ctx context.Context, username string, twoFactor domain.TwoFactor) error {
+	args := m.Called(username, twoFactor)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetPassword(ctx context.Context, username, hashedPassword string) error {
+	args := m.Called(username, hashedPassword)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) UsernameExists(username string) (bool, error) {
+func (m *MockUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
 	args := m.Called(username)
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockUserRepository) Find(ctx context.Context, query domain.UserQuery) (domain.UserPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(domain.UserPage), args.Error(1)
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, username string) error {
+	args := m.Called(username)
+	return args.Error(0)
+}
+
 // UserUsecaseSuite defines the suite for UserUsecase tests.
 type UserUsecaseSuite struct {
 	suite.Suite
 	mockRepo *MockUserRepository
+	sessions repository.SessionRepository
+	attempts repository.LoginAttemptRepository
+	tokens   *infrastructures.TokenService
+	hasher   *infrastructures.PasswordHasher
 	usecase  usecases.UserUsecase
 }
 
+// newTestServices returns what the use cases sign tokens and hash passwords
+// with in these tests: a fresh key, and the cheapest bcrypt cost so that
+// logins stay fast.
+func newTestServices(t *testing.T) (*infrastructures.TokenService, *infrastructures.PasswordHasher) {
+	keys, err := infrastructures.GenerateKeySet(infrastructures.SigningMethodEdDSA.Alg())
+	require.NoError(t, err)
+	hasher, err := infrastructures.NewPasswordHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	return infrastructures.NewTokenService(keys), hasher
+}
+
 // SetupTest sets up the test environment before each test in the suite.
 func (suite *UserUsecaseSuite) SetupTest() {
+	suite.tokens, suite.hasher = newTestServices(suite.T())
 	suite.mockRepo = new(MockUserRepository)
-	suite.usecase = usecases.NewUserUsecase(suite.mockRepo)
+	suite.sessions = repository.NewInMemorySessionRepository()
+	suite.attempts = repository.NewInMemoryLoginAttemptRepository()
+	suite.usecase = usecases.NewUserUsecase(suite.mockRepo, new(MockTaskRepository), suite.sessions, suite.attempts, repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), suite.tokens, suite.hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
 }
 
 // TestRegisterUser tests the Register method.
 func (suite *UserUsecaseSuite) TestRegisterUser() {
+	ctx := context.Background()
 	user := domain.User{Username: "testuser", Password: "password"}
 
 	// Check if username already exists
 	suite.mockRepo.On("UsernameExists", user.Username).Return(false, nil)
 
 	// Hash the password before passing it to the mock
-	hashedPassword, err := infrastructures.HashPassword(user.Password)
+	hashedPassword, err := suite.hasher.Hash(user.Password)
 	suite.Require().Nil(err)
 
 	user.Password = hashedPassword // Update the user with the hashed password
 
 	// Use a wildcard matcher to ignore the specific value of the password
 	suite.mockRepo.On("Register", mock.MatchedBy(func(u domain.User) bool {
-		return u.Username == user.Username && u.Password != "" // Check username and ensure password is not empty
+		return u.Username == user.Username && u.Password != "" && u.Role == domain.RoleUser // Check username and ensure password is not empty
 	})).Return(nil)
 
-	err = suite.usecase.Register(user)
+	err = suite.usecase.Register(ctx, user)
 
 	suite.Assert().Nil(err)
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
+// TestRegisterWeakPassword tests that the password policy applies before
+// anything is stored.
+func (suite *UserUsecaseSuite) TestRegisterWeakPassword() {
+	ctx := context.Background()
+	err := suite.usecase.Register(ctx, domain.User{Username: "testuser", Password: "short"})
+
+	suite.ErrorIs(err, domain.ErrWeakPassword)
+	suite.ErrorIs(suite.usecase.RegisterAdmin(ctx, domain.User{Username: "testuser", Password: "testuser"}), domain.ErrWeakPassword)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Register", mock.Anything)
+	suite.mockRepo.AssertNotCalled(suite.T(), "RegisterAdmin", mock.Anything)
+}
+
+// TestLoginRehashesOutdatedCost tests that a hash made with another cost is
+// replaced once the password is known to be right.
+func (suite *UserUsecaseSuite) TestLoginRehashesOutdatedCost() {
+	ctx := context.Background()
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.mockRepo.On("LoginUser", "testuser").Return(domain.User{Username: "testuser", Password: string(hashed)}, nil)
+	suite.mockRepo.On("SetPassword", "testuser", mock.MatchedBy(func(hash string) bool {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err == nil && cost == bcrypt.MinCost+1 && bcrypt.CompareHashAndPassword([]byte(hash), []byte("password")) == nil
+	})).Return(nil).Once()
+	suite.hasher, err = infrastructures.NewPasswordHasher(bcrypt.MinCost + 1)
+	suite.Require().NoError(err)
+	suite.usecase = usecases.NewUserUsecase(suite.mockRepo, new(MockTaskRepository), suite.sessions, suite.attempts, repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), suite.tokens, suite.hasher, domain.DefaultRoles(), domain.DefaultLoginPolicy(), domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+
+	_, err = suite.usecase.LoginUser(ctx, domain.User{Username: "testuser", Password: "wrong"}, "192.0.2.1")
+	suite.ErrorIs(err, domain.ErrInvalidCredentials)
+	suite.mockRepo.AssertNotCalled(suite.T(), "SetPassword", mock.Anything, mock.Anything)
+
+	_, err = suite.usecase.LoginUser(ctx, domain.User{Username: "testuser", Password: "password"}, "192.0.2.1")
+	suite.NoError(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
 // TestRegisterUserExists tests registration of an existing username.
 func (suite *UserUsecaseSuite) TestRegisterUserExists() {
+	ctx := context.Background()
 	user := domain.User{Username: "testuser", Password: "password"}
 
 	suite.mockRepo.On("UsernameExists", user.Username).Return(true, nil)
 
-	err := suite.usecase.Register(user)
+	err := suite.usecase.Register(ctx, user)
 
 	suite.Assert().EqualError(err, "username already exists")
 	suite.mockRepo.AssertExpectations(suite.T())
@@ -102,50 +179,319 @@ func (suite *UserUsecaseSuite) TestRegisterUserExists() {
 
 // TestLoginUserSuccess tests successful login.
 func (suite *UserUsecaseSuite) TestLoginUserSuccess() {
+	ctx := context.Background()
 	user := domain.User{Username: "testuser", Password: "password"}
-	hashedPassword, _ := infrastructures.HashPassword(user.Password)
+	hashedPassword, _ := suite.hasher.Hash(user.Password)
 
 	// Set the expected user with the hashed password
 	suite.mockRepo.On("LoginUser", user.Username).Return(domain.User{Username: user.Username, Password: hashedPassword}, nil)
-	suite.mockRepo.On("UsernameExists", user.Username).Return(true, nil)
 
 	// Attempt to login with the plain password
-	token, err := suite.usecase.LoginUser(domain.User{Username: user.Username, Password: user.Password})
+	tokens, err := suite.usecase.LoginUser(ctx, domain.User{Username: user.Username, Password: user.Password}, "192.0.2.1")
 
 	suite.Assert().Nil(err)
-	suite.Assert().NotEmpty(token)
+	suite.Assert().NotEmpty(tokens.AccessToken)
+	suite.Assert().NotEmpty(tokens.RefreshToken)
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
 // TestLoginUserInvalidPassword tests login with an invalid password.
 func (suite *UserUsecaseSuite) TestLoginUserInvalidPassword() {
+	ctx := context.Background()
 	user := domain.User{Username: "testuser", Password: "wrongpassword"}
-	hashedPassword, _ := infrastructures.HashPassword("password") // Original password
+	hashedPassword, _ := suite.hasher.Hash("password") // Original password
 
-	suite.mockRepo.On("UsernameExists", user.Username).Return(true, nil)
 	suite.mockRepo.On("LoginUser", user.Username).Return(domain.User{Username: user.Username, Password: hashedPassword}, nil)
 
-	err := infrastructures.CheckPasswordHash(user.Password, hashedPassword)
+	err := suite.hasher.Check(user.Password, hashedPassword)
 	suite.Assert().Error(err)
 
-	_, err = suite.usecase.LoginUser(user)
+	_, err = suite.usecase.LoginUser(ctx, user, "192.0.2.1")
 
-	suite.Assert().EqualError(err, "invalid password")
+	suite.Assert().ErrorIs(err, domain.ErrInvalidCredentials)
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
 // TestLoginUserNotFound tests login for a non-existent user.
 func (suite *UserUsecaseSuite) TestLoginUserNotFound() {
+	ctx := context.Background()
 	user := domain.User{Username: "nonexistent", Password: "password"}
 
-	suite.mockRepo.On("UsernameExists", user.Username).Return(false, nil)
-	_, err := suite.usecase.LoginUser(user)
+	suite.mockRepo.On("LoginUser", user.Username).Return(domain.User{}, mongo.ErrNoDocuments)
+	_, err := suite.usecase.LoginUser(ctx, user, "192.0.2.1")
 
-	suite.Assert().Error(err)
-	suite.Contains(err.Error(), "user not found")
+	// the same answer as for a wrong password
+	suite.Assert().ErrorIs(err, domain.ErrInvalidCredentials)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestRegisterUserCannotChooseRole tests that self-registration always yields a regular user.
+func (suite *UserUsecaseSuite) TestRegisterUserCannotChooseRole() {
+	ctx := context.Background()
+	suite.mockRepo.On("UsernameExists", "mallory").Return(false, nil)
+	suite.mockRepo.On("Register", mock.MatchedBy(func(u domain.User) bool {
+		return u.Role == domain.RoleUser
+	})).Return(nil)
+
+	err := suite.usecase.Register(ctx, domain.User{Username: "mallory", Password: "password", Role: domain.RoleAdmin})
+
+	suite.Assert().Nil(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestAssignRole tests assigning a configured role.
+func (suite *UserUsecaseSuite) TestAssignRole() {
+	ctx := context.Background()
+	suite.mockRepo.On("SetRole", "testuser", domain.RoleAdmin).Return(nil)
+
+	err := suite.usecase.AssignRole(ctx, "testuser", domain.RoleAdmin, admin)
+
+	suite.Assert().Nil(err)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestAssignUnknownRole tests that only configured roles can be assigned.
+func (suite *UserUsecaseSuite) TestAssignUnknownRole() {
+	ctx := context.Background()
+	err := suite.usecase.AssignRole(ctx, "testuser", "superuser", admin)
+
+	suite.Assert().ErrorIs(err, domain.ErrUnknownRole)
+	suite.mockRepo.AssertNotCalled(suite.T(), "SetRole", mock.Anything, mock.Anything)
+}
+
+// login signs testuser in against the mock repository.
+func (suite *UserUsecaseSuite) login() domain.TokenPair {
+	ctx := context.Background()
+	hashedPassword, _ := suite.hasher.Hash("password")
+	suite.mockRepo.On("LoginUser", "testuser").Return(domain.User{Username: "testuser", Password: hashedPassword, Role: domain.RoleUser}, nil)
+
+	tokens, err := suite.usecase.LoginUser(ctx, domain.User{Username: "testuser", Password: "password"}, "192.0.2.1")
+	suite.Require().NoError(err)
+	suite.Require().False(tokens.TwoFactorRequired)
+	return tokens.TokenPair
+}
+
+// TestRefreshRotatesTokens tests that a refresh token works once and that reusing it ends the session.
+func (suite *UserUsecaseSuite) TestRefreshRotatesTokens() {
+	ctx := context.Background()
+	first := suite.login()
+
+	second, err := suite.usecase.Refresh(ctx, first.RefreshToken)
+	suite.Require().NoError(err)
+	suite.Assert().NotEqual(first.RefreshToken, second.RefreshToken)
+
+	_, err = suite.usecase.Refresh(ctx, first.RefreshToken)
+	suite.Assert().ErrorIs(err, domain.ErrRefreshTokenReused)
+
+	// the legitimate holder is logged out too, as we cannot tell them apart
+	_, err = suite.usecase.Refresh(ctx, second.RefreshToken)
+	suite.Assert().ErrorIs(err, domain.ErrInvalidRefreshToken)
+}
+
+// TestRefreshRejectsAccessTokens tests that only refresh tokens can be traded.
+func (suite *UserUsecaseSuite) TestRefreshRejectsAccessTokens() {
+	ctx := context.Background()
+	tokens := suite.login()
+
+	_, err := suite.usecase.Refresh(ctx, tokens.AccessToken)
+	suite.Assert().ErrorIs(err, domain.ErrInvalidRefreshToken)
+	_, err = suite.usecase.Refresh(ctx, "garbage")
+	suite.Assert().ErrorIs(err, domain.ErrInvalidRefreshToken)
+}
+
+// TestLogout tests that logging out ends the session and its refresh token.
+func (suite *UserUsecaseSuite) TestLogout() {
+	ctx := context.Background()
+	tokens := suite.login()
+	sessionID, _, err := suite.tokens.ParseRefreshToken(tokens.RefreshToken)
+	suite.Require().NoError(err)
+
+	active, err := suite.usecase.SessionActive(ctx, sessionID)
+	suite.NoError(err)
+	suite.True(active)
+
+	suite.NoError(suite.usecase.Logout(ctx, sessionID))
+
+	active, err = suite.usecase.SessionActive(ctx, sessionID)
+	suite.NoError(err)
+	suite.False(active)
+	_, err = suite.usecase.Refresh(ctx, tokens.RefreshToken)
+	suite.Assert().ErrorIs(err, domain.ErrInvalidRefreshToken)
+}
+
+// TestDeactivateEndsSessions tests that deactivating a user revokes every session they have.
+func (suite *UserUsecaseSuite) TestDeactivateEndsSessions() {
+	ctx := context.Background()
+	tokens := suite.login()
+	sessionID, _, err := suite.tokens.ParseRefreshToken(tokens.RefreshToken)
+	suite.Require().NoError(err)
+	suite.mockRepo.On("SetAccountStatus", "testuser", mock.MatchedBy(func(s domain.AccountStatus) bool {
+		return s.State == domain.AccountDeactivated && s.Reason == "left the team"
+	})).Return(nil)
+
+	suite.NoError(suite.usecase.Deactivate(ctx, "testuser", "left the team"))
+
+	active, err := suite.usecase.SessionActive(ctx, sessionID)
+	suite.NoError(err)
+	suite.False(active)
+}
+
+// TestLoginDeactivatedUser tests that a deactivated user cannot log in, and
+// only learns why after giving the right password.
+func (suite *UserUsecaseSuite) TestLoginDeactivatedUser() {
+	ctx := context.Background()
+	hashedPassword, _ := suite.hasher.Hash("password")
+	suite.mockRepo.On("LoginUser", "testuser").Return(domain.User{
+		Username: "testuser",
+		Password: hashedPassword,
+		Status:   domain.AccountStatus{State: domain.AccountDeactivated},
+	}, nil)
+
+	_, err := suite.usecase.LoginUser(ctx, domain.User{Username: "testuser", Password: "wrongpassword"}, "192.0.2.1")
+	suite.Assert().ErrorIs(err, domain.ErrInvalidCredentials)
+
+	_, err = suite.usecase.LoginUser(ctx, domain.User{Username: "testuser", Password: "password"}, "192.0.2.1")
+	suite.Assert().ErrorIs(err, domain.ErrAccountDeactivated)
+}
+
+// TestUserActiveIsCached tests that the status is read from storage once and
+// that Deactivate drops the cached answer.
+func (suite *UserUsecaseSuite) TestUserActiveIsCached() {
+	ctx := context.Background()
+	active := domain.User{Username: "testuser", Status: domain.AccountStatus{State: domain.AccountActive}}
+	suite.mockRepo.On("LoginUser", "testuser").Return(active, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		ok, err := suite.usecase.UserActive(ctx, "testuser")
+		suite.NoError(err)
+		suite.True(ok)
+	}
+
+	suite.mockRepo.On("SetAccountStatus", "testuser", mock.Anything).Return(nil)
+	suite.Require().NoError(suite.usecase.Deactivate(ctx, "testuser", ""))
+	deactivated := domain.User{Username: "testuser", Status: domain.AccountStatus{State: domain.AccountDeactivated}}
+	suite.mockRepo.On("LoginUser", "testuser").Return(deactivated, nil).Once()
+
+	ok, err := suite.usecase.UserActive(ctx, "testuser")
+	suite.NoError(err)
+	suite.False(ok)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// TestAPIKeyStatusIsCached tests that API keys read their user's status and
+// role through the same cache, and that a role change drops it.
+func (suite *UserUsecaseSuite) TestAPIKeyStatusIsCached() {
+	ctx := context.Background()
+	actor := domain.DefaultRoles().Actor("testuser", domain.RoleUser)
+	created, err := suite.usecase.CreateAPIKey(ctx, actor, false, domain.APIKeyRequest{Name: "ci", Scopes: []domain.Permission{domain.PermTasksRead}})
+	suite.Require().NoError(err)
+	user := domain.User{Username: "testuser", Role: domain.RoleUser, Status: domain.AccountStatus{State: domain.AccountActive}}
+	suite.mockRepo.On("LoginUser", "testuser").Return(user, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		_, role, err := suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+		suite.NoError(err)
+		suite.Equal(domain.RoleUser, role)
+	}
+
+	suite.mockRepo.On("SetRole", "testuser", domain.RoleAdmin).Return(nil)
+	suite.Require().NoError(suite.usecase.AssignRole(ctx, "testuser", domain.RoleAdmin, admin))
+	user.Role = domain.RoleAdmin
+	suite.mockRepo.On("LoginUser", "testuser").Return(user, nil).Once()
+
+	_, role, err := suite.usecase.AuthenticateAPIKey(ctx, created.Key)
+	suite.NoError(err)
+	suite.Equal(domain.RoleAdmin, role)
 	suite.mockRepo.AssertExpectations(suite.T())
 }
 
+// TestUserActiveUnknownUser tests that a deleted user counts as inactive.
+func (suite *UserUsecaseSuite) TestUserActiveUnknownUser() {
+	ctx := context.Background()
+	suite.mockRepo.On("LoginUser", "ghost").Return(domain.User{}, mongo.ErrNoDocuments)
+
+	ok, err := suite.usecase.UserActive(ctx, "ghost")
+	suite.NoError(err)
+	suite.False(ok)
+}
+
+// withLoginPolicy rebuilds the use case with policy and makes testuser's
+// password cheap to check, since these tests log in many times.
+func (suite *UserUsecaseSuite) withLoginPolicy(policy domain.LoginPolicy) {
+	suite.usecase = usecases.NewUserUsecase(suite.mockRepo, new(MockTaskRepository), suite.sessions, suite.attempts, repository.NewInMemoryPasswordResetRepository(), repository.NewInMemoryAPIKeyRepository(), infrastructures.NewLogNotifier(io.Discard), suite.tokens, suite.hasher, domain.DefaultRoles(), policy, domain.DefaultPasswordPolicy(), domain.DefaultTimeouts())
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.mockRepo.On("LoginUser", "testuser").Return(domain.User{Username: "testuser", Password: string(hashed)}, nil)
+	suite.mockRepo.On("LoginUser", "otheruser").Return(domain.User{Username: "otheruser", Password: string(hashed)}, nil)
+}
+
+func (suite *UserUsecaseSuite) loginAs(username, password, clientIP string) error {
+	ctx := context.Background()
+	_, err := suite.usecase.LoginUser(ctx, domain.User{Username: username, Password: password}, clientIP)
+	return err
+}
+
+// TestLoginLockout tests that an account locks after repeated failures, even
+// for the right password, until an admin unlocks it.
+func (suite *UserUsecaseSuite) TestLoginLockout() {
+	ctx := context.Background()
+	policy := domain.DefaultLoginPolicy()
+	policy.MaxFailures = 3
+	suite.withLoginPolicy(policy)
+	suite.mockRepo.On("UsernameExists", "testuser").Return(true, nil)
+
+	for i := 0; i < 3; i++ {
+		suite.Require().ErrorIs(suite.loginAs("testuser", "wrong", "192.0.2.1"), domain.ErrInvalidCredentials)
+	}
+
+	err := suite.loginAs("testuser", "password", "192.0.2.2")
+	var throttled *domain.ThrottledError
+	suite.Require().ErrorAs(err, &throttled)
+	suite.ErrorIs(err, domain.ErrTooManyAttempts)
+	suite.InDelta(policy.Lockout.Seconds(), throttled.RetryAfter.Seconds(), 5)
+	suite.NoError(suite.loginAs("otheruser", "password", "192.0.2.1"))
+
+	suite.Require().NoError(suite.usecase.Unlock(ctx, "testuser"))
+	suite.NoError(suite.loginAs("testuser", "password", "192.0.2.1"))
+}
+
+// TestLoginSuccessResetsFailures tests that failures only lock when they
+// follow each other.
+func (suite *UserUsecaseSuite) TestLoginSuccessResetsFailures() {
+	policy := domain.DefaultLoginPolicy()
+	policy.MaxFailures = 3
+	suite.withLoginPolicy(policy)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			suite.Require().ErrorIs(suite.loginAs("testuser", "wrong", "192.0.2.1"), domain.ErrInvalidCredentials)
+		}
+		suite.Require().NoError(suite.loginAs("testuser", "password", "192.0.2.1"))
+	}
+}
+
+// TestLoginClientThrottled tests that one address guessing across many
+// accounts is blocked, while other addresses are not.
+func (suite *UserUsecaseSuite) TestLoginClientThrottled() {
+	policy := domain.DefaultLoginPolicy()
+	policy.IPMaxFailures = 2
+	suite.withLoginPolicy(policy)
+
+	suite.Require().ErrorIs(suite.loginAs("testuser", "wrong", "192.0.2.1"), domain.ErrInvalidCredentials)
+	suite.Require().ErrorIs(suite.loginAs("otheruser", "wrong", "192.0.2.1"), domain.ErrInvalidCredentials)
+
+	suite.ErrorIs(suite.loginAs("otheruser", "password", "192.0.2.1"), domain.ErrTooManyAttempts)
+	suite.NoError(suite.loginAs("otheruser", "password", "198.51.100.7"))
+}
+
+// TestUnlockUnknownUser tests that only existing accounts can be unlocked.
+func (suite *UserUsecaseSuite) TestUnlockUnknownUser() {
+	ctx := context.Background()
+	suite.mockRepo.On("UsernameExists", "ghost").Return(false, nil)
+
+	suite.ErrorIs(suite.usecase.Unlock(ctx, "ghost"), domain.ErrUserNotFound)
+}
+
 // TestUserUsecaseSuite runs the test suite.
 func TestUserUsecaseSuite(t *testing.T) {
 	suite.Run(t, new(UserUsecaseSuite))
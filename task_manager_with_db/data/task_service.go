@@ -11,6 +11,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -79,33 +80,102 @@ func GetAllTasks() []models.Task {
     return result
 }
 
+// this function prepares the db once at startup: tasks used to be numbered by reading the
+// highest id, so it starts the counter after the highest numeric id, gives new ids to tasks
+// that concurrent adds gave the same id, and adds a unique index on id.
+func Migrate() {
+	var client = ConnectToDB()
+	var collection = TaskCollection(client)
+
+	// comparing ids as numbers, as a string "9" sorts above "10"
+	cursor, err := collection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"max": bson.M{"$max": bson.M{"$convert": bson.M{"input": "$id", "to": "long", "onError": nil, "onNull": nil}}},
+		}}},
+	})
+	if err != nil {
+		log.Fatal("error finding the highest task id: ", err)
+	}
+	var highest []struct {
+		Max int64 `bson:"max"`
+	}
+	if err := cursor.All(context.TODO(), &highest); err != nil {
+		log.Fatal("error finding the highest task id: ", err)
+	}
+	if len(highest) > 0 {
+		_, err = counters(client).UpdateOne(context.TODO(), bson.M{"_id": "tasks"}, bson.M{"$max": bson.M{"seq": highest[0].Max}}, options.Update().SetUpsert(true))
+		if err != nil {
+			log.Fatal("error starting the task counter: ", err)
+		}
+	}
+
+	// the oldest task keeps a shared id, the others get new ones
+	cursor, err = collection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$id", "docs": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"docs.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		log.Fatal("error finding tasks with the same id: ", err)
+	}
+	var duplicates []struct {
+		Docs []primitive.ObjectID `bson:"docs"`
+	}
+	if err := cursor.All(context.TODO(), &duplicates); err != nil {
+		log.Fatal("error finding tasks with the same id: ", err)
+	}
+	for _, duplicate := range duplicates {
+		for _, doc := range duplicate.Docs[1:] {
+			id, err := nextTaskID(client)
+			if err != nil {
+				log.Fatal("error renumbering a task: ", err)
+			}
+			if _, err := collection.UpdateByID(context.TODO(), doc, bson.M{"$set": bson.M{"id": id}}); err != nil {
+				log.Fatal("error renumbering a task: ", err)
+			}
+		}
+	}
+
+	// a unique index on id refuses a second task with the same id
+	_, err = collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal("error indexing task ids: ", err)
+	}
+}
+
+func counters(client *mongo.Client) *mongo.Collection {
+	return client.Database("task_manager").Collection("counters") // one counter document per sequence
+}
+
+// this function hands out the next task id from the counter Migrate started. the counter is
+// increased atomically, so two requests never get the same id.
+func nextTaskID(client *mongo.Client) (string, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := counters(client).FindOneAndUpdate(context.TODO(), bson.M{"_id": "tasks"}, bson.M{"$inc": bson.M{"seq": int64(1)}}, opts).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(counter.Seq, 10), nil
+}
+
 // this function is used in the adding of new task
 func AddTask(newTask models.Task) error{
 	var client = ConnectToDB()
 	var collection = TaskCollection(client)
-	opts := options.FindOne().SetSort(bson.D{{Key: "id", Value: -1}})
-
-	// Iterate ti get the last task
-    var lastTask models.Task
-    err := collection.FindOne(context.TODO(), bson.D{}, opts).Decode(&lastTask)
-	// fmt.Println("one||||||\n")
-	if err != nil && err != mongo.ErrNoDocuments {
-        log.Fatal("error, ",err)
-    }
-	newTask.Status = "Pending"
 
-	// taking the last id from the db and converting to int.
-	LastID, err := strconv.Atoi(lastTask.ID)
-    if err!= nil && err == mongo.ErrNoDocuments {
-		LastID = 0
-    } else if err!= nil{
-		log.Fatal(err)
+	var err error
+	newTask.Status = "Pending"
+	newTask.ID, err = nextTaskID(client)
+	if err != nil {
+		return err
 	}
-
-	// add one to the last id to create new one
-	LastID+=1
-	t := strconv.Itoa(LastID)
-	newTask.ID = t
 	newTask.DueDate = time.Now()
 	insertOne, err := collection.InsertOne(context.TODO(),newTask)
 	if err!=nil{
@@ -1,7 +1,11 @@
 package main
 
-import "task_manager_with_db/router"
+import (
+	"task_manager_with_db/data"
+	"task_manager_with_db/router"
+)
 
 func main() {
+	data.Migrate() // once, before any task is added
 	router.CreateRouting()
-}
\ No newline at end of file
+}